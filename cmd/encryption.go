@@ -0,0 +1,72 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/spf13/cobra"
+	"goflylivechat/common"
+	"goflylivechat/models"
+	"goflylivechat/tools"
+	"log"
+	"os"
+)
+
+var encryptionBatch int
+
+var encryptionCmd = &cobra.Command{
+	Use:   "encryption",
+	Short: "Manage field encryption of messages and visitor data",
+}
+
+var encryptionKeygenCmd = &cobra.Command{
+	Use:     "keygen",
+	Short:   "Generate a random key for encryption.keys or encryption.blind_index_key",
+	Example: "gochat encryption keygen",
+	Run: func(cmd *cobra.Command, args []string) {
+		fmt.Println(tools.RandomFieldKey())
+	},
+}
+
+var encryptionRotateCmd = &cobra.Command{
+	Use:     "rotate",
+	Short:   "Re-encrypt all encrypted fields with the current key and rebuild blind indexes",
+	Example: "gochat encryption rotate --batch 500",
+	Run: func(cmd *cobra.Command, args []string) {
+		encryptionRotate()
+	},
+}
+
+func init() {
+	encryptionRotateCmd.Flags().IntVarP(&encryptionBatch, "batch", "b", 500, "Rows per batch")
+	encryptionCmd.AddCommand(encryptionKeygenCmd)
+	encryptionCmd.AddCommand(encryptionRotateCmd)
+	rootCmd.AddCommand(encryptionCmd)
+}
+
+// initEncryption 加载字段加密密钥, 密钥配置错误或数据库字段长度不够时退出, 避免写入错误的数据
+func initEncryption() {
+	if err := common.InitEncryption(); err != nil {
+		log.Fatal(err)
+	}
+	if !tools.FieldEncryptionEnabled() {
+		return
+	}
+	if err := models.CheckEncryptionSchema(); err != nil {
+		log.Fatal("field encryption needs a wider schema: ", err)
+	}
+}
+
+// encryptionRotate 更换 current_kid 后执行, 旧密钥需保留到执行完成
+func encryptionRotate() {
+	initEncryption()
+	if encryptionBatch <= 0 {
+		encryptionBatch = 500
+	}
+	result, err := models.RotateEncryptedFields(encryptionBatch)
+	out, _ := json.MarshalIndent(result, "", "  ")
+	log.Printf("Rotate result:\n%s\n", out)
+	if err != nil {
+		log.Printf("Rotate failed: %v\n", err)
+		os.Exit(1)
+	}
+}
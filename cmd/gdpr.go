@@ -0,0 +1,107 @@
+package cmd
+
+import (
+	"encoding/json"
+	"github.com/spf13/cobra"
+	"goflylivechat/controller"
+	"goflylivechat/models"
+	"log"
+	"os"
+	"os/user"
+)
+
+var (
+	gdprOutput string
+	gdprYes    bool
+)
+
+var gdprCmd = &cobra.Command{
+	Use:   "gdpr",
+	Short: "Export or erase a visitor's personal data",
+}
+
+var gdprExportCmd = &cobra.Command{
+	Use:     "export <visitor_id>",
+	Short:   "Export all data of a visitor as a zip archive",
+	Example: "gochat gdpr export 0a1b2c -o visitor.zip",
+	Args:    cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		gdprExport(args[0])
+	},
+}
+
+var gdprEraseCmd = &cobra.Command{
+	Use:     "erase <visitor_id>",
+	Short:   "Delete all data and uploaded files of a visitor",
+	Example: "gochat gdpr erase 0a1b2c --yes",
+	Args:    cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		gdprErase(args[0])
+	},
+}
+
+func init() {
+	gdprExportCmd.Flags().StringVarP(&gdprOutput, "output", "o", "", "Output file, defaults to visitor-<visitor_id>.zip")
+	gdprEraseCmd.Flags().BoolVarP(&gdprYes, "yes", "y", false, "Confirm the deletion, it can not be undone")
+	gdprCmd.AddCommand(gdprExportCmd)
+	gdprCmd.AddCommand(gdprEraseCmd)
+	rootCmd.AddCommand(gdprCmd)
+}
+
+func gdprExport(visitorId string) {
+	initEncryption()
+	initStorage()
+	data, err := models.FindVisitorData(visitorId)
+	if err != nil {
+		log.Printf("Export failed: %v\n", err)
+		os.Exit(1)
+	}
+	if gdprOutput == "" {
+		gdprOutput = "visitor-" + visitorId + ".zip"
+	}
+	f, err := os.OpenFile(gdprOutput, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		log.Printf("Failed to create %s: %v\n", gdprOutput, err)
+		os.Exit(1)
+	}
+	defer f.Close()
+	if err := models.ExportVisitorData(f, data); err != nil {
+		log.Printf("Export failed: %v\n", err)
+		os.Exit(1)
+	}
+	cliAudit(controller.AuditVisitorExport, visitorId, map[string]int{"messages": len(data.Messages), "files": len(data.Files)})
+	log.Printf("Exported %d messages and %d files to %s\n", len(data.Messages), len(data.Files), gdprOutput)
+}
+
+func gdprErase(visitorId string) {
+	if !gdprYes {
+		log.Println("Erasing can not be undone, run again with --yes to confirm")
+		os.Exit(1)
+	}
+	initEncryption()
+	initStorage()
+	result, err := models.EraseVisitorData(visitorId)
+	if err != nil {
+		log.Printf("Erase failed: %v\n", err)
+		os.Exit(1)
+	}
+	cliAudit(controller.AuditVisitorErase, visitorId, result)
+	out, _ := json.Marshal(result)
+	log.Printf("Erased visitor %s: %s\n", visitorId, out)
+}
+
+// cliAudit 命令行操作写入审计日志, 操作人记为cli:系统用户名
+func cliAudit(action string, target string, after interface{}) {
+	actor := "cli"
+	if u, err := user.Current(); err == nil {
+		actor += ":" + u.Username
+	}
+	out, _ := json.Marshal(after)
+	models.CreateAudit(models.Audit{
+		Actor:      actor,
+		Action:     action,
+		Target:     target,
+		AfterValue: string(out),
+		UserAgent:  "gochat " + action,
+	})
+}
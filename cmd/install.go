@@ -2,6 +2,7 @@ package cmd
 
 import (
 	"github.com/spf13/cobra"
+	"goflylivechat/common"
 	"goflylivechat/models"
 	"goflylivechat/tools"
 	"log"
@@ -9,14 +10,57 @@ import (
 	"strings"
 )
 
+var webInstall bool
+
 var installCmd = &cobra.Command{
-	Use:   "install",
-	Short: "Initialize database and import data", // More precise description
+	Use:     "install",
+	Short:   "Initialize database and import data", // More precise description
+	Example: "gochat install\ngochat install --web",
 	Run: func(cmd *cobra.Command, args []string) {
+		if webInstall {
+			setupToken()
+			return
+		}
 		install()
 	},
 }
 
+func init() {
+	installCmd.PersistentFlags().BoolVarP(&webInstall, "web", "w", false, "Print a one-time setup token for the web installer instead of importing data")
+}
+
+// setupToken prints the token required by POST /install
+func setupToken() {
+	if ok, _ := tools.IsFileNotExist("./install.lock"); !ok {
+		log.Println("Please remove ./install.lock file to reinstall")
+		os.Exit(1)
+	}
+	token, err := common.NewSetupToken()
+	if err != nil {
+		log.Printf("Failed to create setup token: %v\n", err)
+		os.Exit(1)
+	}
+	log.Printf("Setup token: %s\n", token)
+	log.Println("Enter it on the /install page to finish the installation, it is removed once the installation succeeds")
+}
+
+// serverSetupToken 未安装时启动服务也输出网页安装需要的令牌, 已有令牌时不覆盖
+func serverSetupToken() {
+	if ok, _ := tools.IsFileNotExist("./install.lock"); !ok {
+		return
+	}
+	if exist, _ := tools.IsFileExist(common.SetupTokenFile); exist {
+		log.Println("Not installed yet, run gochat install --web to get a new setup token for the /install page")
+		return
+	}
+	token, err := common.NewSetupToken()
+	if err != nil {
+		log.Printf("Failed to create setup token: %v\n", err)
+		return
+	}
+	log.Printf("Not installed yet, setup token for the /install page: %s\n", token)
+}
+
 func install() {
 	// Check if already installed
 	if ok, _ := tools.IsFileNotExist("./install.lock"); !ok {
@@ -67,5 +111,6 @@ func install() {
 		os.Exit(1)
 	}
 
+	common.RemoveSetupToken()
 	log.Println("Database initialization completed successfully")
 }
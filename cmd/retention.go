@@ -0,0 +1,38 @@
+package cmd
+
+import (
+	"encoding/json"
+	"github.com/spf13/cobra"
+	"goflylivechat/common"
+	"goflylivechat/controller"
+	"log"
+)
+
+var retentionDryRun bool
+
+var retentionCmd = &cobra.Command{
+	Use:     "retention",
+	Short:   "Purge data older than the retention policy in config/app.json",
+	Example: "gochat retention --dry-run",
+	Run: func(cmd *cobra.Command, args []string) {
+		retention()
+	},
+}
+
+func init() {
+	retentionCmd.Flags().BoolVarP(&retentionDryRun, "dry-run", "n", false, "Only report what would be removed")
+	rootCmd.AddCommand(retentionCmd)
+}
+
+// retention 立即执行一次清理, 不要求开启定时清理
+func retention() {
+	initEncryption()
+	initStorage()
+	policy := common.GetRetention()
+	report := controller.RunRetention(policy, retentionDryRun || policy.DryRun)
+	out, _ := json.MarshalIndent(report, "", "  ")
+	if !report.DryRun {
+		cliAudit(controller.AuditRetention, "", report)
+	}
+	log.Printf("Retention report:\n%s\n", out)
+}
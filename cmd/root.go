@@ -4,6 +4,7 @@ import (
 	"errors"
 	"fmt"
 	"github.com/spf13/cobra"
+	"goflylivechat/models"
 	"os"
 )
 
@@ -12,6 +13,10 @@ var rootCmd = &cobra.Command{
 	Short: "GoChat CLI",                              // Changed from just "gochat"
 	Long:  `Fast and lightweight Go web chat system`, // More descriptive
 	Args:  args,
+	// 所有命令执行前连接数据库
+	PersistentPreRun: func(cmd *cobra.Command, args []string) {
+		models.Connect()
+	},
 	Run: func(cmd *cobra.Command, args []string) {
 		// Original logic preserved
 	},
@@ -5,12 +5,15 @@ import (
 	"github.com/spf13/cobra"
 	"github.com/zh-five/xdaemon"
 	"goflylivechat/common"
+	"goflylivechat/controller"
 	"goflylivechat/middleware"
+	"goflylivechat/models"
 	"goflylivechat/router"
 	"goflylivechat/tools"
 	"goflylivechat/ws"
 	"log"
 	"os"
+	"time"
 )
 
 var (
@@ -50,6 +53,25 @@ func run() {
 		d.Run()
 	}
 
+	if err := common.InitJwt(); err != nil {
+		log.Fatal(err)
+	}
+	initEncryption()
+	initStorage()
+	if err := common.InitRedaction(); err != nil {
+		log.Fatal(err)
+	}
+	if err := common.InitUploadScan(); err != nil {
+		log.Fatal(err)
+	}
+	if scanner := common.GetUploadScanner(); scanner != nil {
+		if err := scanner.Ping(); err != nil {
+			log.Println("clamd is not available:", err)
+		}
+	}
+	startTokenRevokeCleaner()
+	serverSetupToken()
+
 	baseServer := "0.0.0.0:" + port
 	log.Println("Starting server...\nURL: http://" + baseServer)
 	tools.Logger().Println("Starting server...\nURL: http://" + baseServer)
@@ -58,15 +80,17 @@ func run() {
 	engine := gin.Default()
 	engine.LoadHTMLGlob("static/templates/*")
 
-	// 设置双重静态资源路由支持
+	// 设置双重静态资源路由支持, 上传目录下的文件由 StaticFile 加上安全响应头输出
 	if common.IsPrefixEnabled() {
 		// 带前缀的静态资源（代理访问）
-		staticPrefix := common.GetPrefix() + "/static"
-		engine.Static(staticPrefix, "./static")
+		staticPrefix := common.GetPrefix() + "/static/*filepath"
+		engine.GET(staticPrefix, controller.StaticFile)
+		engine.HEAD(staticPrefix, controller.StaticFile)
 	}
 
 	// 无前缀的静态资源（直接访问）
-	engine.Static("/static", "./static")
+	engine.GET("/static/*filepath", controller.StaticFile)
+	engine.HEAD("/static/*filepath", controller.StaticFile)
 
 	engine.Use(middleware.SessionHandler())
 	engine.Use(middleware.CrossSite)
@@ -81,8 +105,30 @@ func run() {
 	// Background services
 	tools.NewLimitQueue()
 	ws.CleanVisitorExpire()
+	controller.StartScheduleWorker()
+	controller.StartRetentionWorker()
 	go ws.WsServerBackend()
+	go ws.UpdateVisitorStatusCron()
 
 	// Start server
 	engine.Run(baseServer)
 }
+
+// startTokenRevokeCleaner 定时删除已过期的吊销记录, 过期的令牌本身已经无效
+func startTokenRevokeCleaner() {
+	go func() {
+		ticker := time.NewTicker(time.Hour)
+		defer ticker.Stop()
+		for {
+			models.DeleteExpiredTokenRevokes()
+			<-ticker.C
+		}
+	}()
+}
+
+// initStorage 创建上传文件存储, 配置错误时退出
+func initStorage() {
+	if err := common.InitStorage(); err != nil {
+		log.Fatal(err)
+	}
+}
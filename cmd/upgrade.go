@@ -0,0 +1,70 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+	"goflylivechat/models"
+	"log"
+	"os"
+	"regexp"
+	"strings"
+)
+
+var upgradeCmd = &cobra.Command{
+	Use:     "upgrade",
+	Short:   "Upgrade the database schema of an existing installation",
+	Example: "gochat upgrade",
+	Run: func(cmd *cobra.Command, args []string) {
+		upgrade()
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(upgradeCmd)
+}
+
+var importTableRegexp = regexp.MustCompile("^(?i)(CREATE TABLE|INSERT INTO)\\s+`(\\w+)`")
+
+// upgrade 不删除已有数据: 创建 import.sql 中缺少的表并导入这些表的初始数据, 再新增和加宽旧表的字段
+func upgrade() {
+	sqls, err := os.ReadFile("import.sql")
+	if err != nil {
+		log.Printf("Failed to read SQL file import.sql: %v\n", err)
+		os.Exit(1)
+	}
+	created := make(map[string]bool)
+	for _, sql := range strings.Split(string(sqls), ";") {
+		sql = strings.TrimSpace(sql)
+		m := importTableRegexp.FindStringSubmatch(sql)
+		if m == nil {
+			continue
+		}
+		table := m[2]
+		if strings.EqualFold(m[1], "CREATE TABLE") {
+			exists, err := models.TableExists(table)
+			if err != nil {
+				log.Printf("Failed to check table %s: %v\n", table, err)
+				os.Exit(1)
+			}
+			if exists {
+				continue
+			}
+			created[table] = true
+		} else if !created[table] {
+			continue
+		}
+		if err := models.Execute(sql); err != nil {
+			log.Printf("SQL execution failed: %s\nError: %v\n", sql, err)
+			os.Exit(1)
+		}
+		log.Printf("Executed successfully: %s\n", sql)
+	}
+	executed, err := models.UpgradeColumns()
+	for _, sql := range executed {
+		log.Printf("Executed successfully: %s\n", sql)
+	}
+	if err != nil {
+		log.Printf("Database upgrade failed: %v\n", err)
+		os.Exit(1)
+	}
+	log.Println("Database upgrade completed successfully")
+}
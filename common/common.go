@@ -9,5 +9,6 @@ var (
 	Dir               string  = "config/"
 	MysqlConf         string  = Dir + "mysql.json"
 	AppConf           string  = Dir + "app.json"
+	SetupTokenFile    string  = Dir + "setup.token"
 	IsCompireTemplate bool    = false //是否编译静态模板到二进制
 )
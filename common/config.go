@@ -2,9 +2,12 @@ package common
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"goflylivechat/tools"
 	"io/ioutil"
+	"net/url"
+	"os"
 	"strings"
 
 	"github.com/gin-gonic/gin"
@@ -23,8 +26,108 @@ type AppConfig struct {
 }
 
 type App struct {
-	Prefix       string `json:"prefix"`
-	EnablePrefix bool   `json:"enable_prefix"`
+	Prefix       string       `json:"prefix"`
+	EnablePrefix bool         `json:"enable_prefix"`
+	BaseUrl      string       `json:"base_url"`
+	Jwt          Jwt          `json:"jwt"`
+	Security     Security     `json:"security"`
+	Retention    Retention    `json:"retention"`
+	Encryption   Encryption   `json:"encryption"`
+	Redaction    Redaction    `json:"redaction"`
+	Upload       UploadPolicy `json:"upload"`
+	Storage      FileStorage  `json:"storage"`
+	Scan         UploadScan   `json:"scan"`
+}
+
+// 登录安全配置, LoginCaptcha: off关闭 always每次登录 failed登录失败后才需要
+// RegisterMode: disabled关闭注册 invite只能通过邀请链接注册 open开放注册
+type Security struct {
+	LoginCaptcha     string `json:"login_captcha"`
+	RegisterCaptcha  bool   `json:"register_captcha"`
+	RegisterMode     string `json:"register_mode"`
+	MaxLoginFailures int    `json:"max_login_failures"`
+	LockoutMinutes   int    `json:"lockout_minutes"`
+}
+
+// 数据保留配置, 天数为0表示永久保留; DryRun 只统计不删除; ArchiveDir 不为空时删除前先归档
+type Retention struct {
+	Enable        bool   `json:"enable"`
+	DryRun        bool   `json:"dry_run"`
+	MessageDays   int    `json:"message_days"`
+	VisitorDays   int    `json:"visitor_days"`
+	UploadDays    int    `json:"upload_days"`
+	LogDays       int    `json:"log_days"`
+	BatchSize     int    `json:"batch_size"`
+	IntervalHours int    `json:"interval_hours"`
+	ArchiveDir    string `json:"archive_dir"`
+}
+
+// 字段加密配置, Keys 中 Kid 等于 CurrentKid 的密钥用于加密, 其余只用于解密
+// BlindIndexKey 用于计算可搜索的盲索引, 设置后不能修改
+type Encryption struct {
+	Keys          []tools.FieldKey `json:"keys"`
+	CurrentKid    string           `json:"current_kid"`
+	BlindIndexKey string           `json:"blind_index_key"`
+}
+
+// 消息敏感信息配置, Card IdCard Phone 为内置规则的策略: mask reject encrypt, off关闭, 默认mask
+// Patterns 为自定义正则规则, 在内置规则之后匹配
+type Redaction struct {
+	Enable   bool               `json:"enable"`
+	Card     string             `json:"card"`
+	IdCard   string             `json:"id_card"`
+	Phone    string             `json:"phone"`
+	Patterns []tools.RedactRule `json:"patterns"`
+}
+
+// 上传配置, AllowTypes 为允许上传的MIME类型, 为空时使用内置列表
+// MaxSizeMB 按MIME类型或大类限制大小, 如 {"image":10,"application/pdf":20,"default":90}
+// ThumbSizes 为图片缩略图长边的像素, 默认 [200,800], 聊天中显示最小的缩略图
+// VisitorDailyMB VisitorDailyFiles 为每个访客每天的上传限额, 默认200M和100个文件
+// KefuDailyMB KefuDailyFiles 为每个客服每天的上传限额, 默认2048M和1000个文件, 小于0时不限制
+type UploadPolicy struct {
+	AllowTypes        []string       `json:"allow_types"`
+	MaxSizeMB         map[string]int `json:"max_size_mb"`
+	ThumbSizes        []int          `json:"thumb_sizes"`
+	VisitorDailyMB    int            `json:"visitor_daily_mb"`
+	VisitorDailyFiles int            `json:"visitor_daily_files"`
+	KefuDailyMB       int            `json:"kefu_daily_mb"`
+	KefuDailyFiles    int            `json:"kefu_daily_files"`
+}
+
+// 文件存储配置, Type: local本地磁盘(默认) s3兼容S3的对象存储, MinIO 需要开启 PathStyle
+// UrlExpireMinutes 为下载地址的有效期, 默认60分钟
+type FileStorage struct {
+	Type             string `json:"type"`
+	Endpoint         string `json:"endpoint"`
+	Region           string `json:"region"`
+	Bucket           string `json:"bucket"`
+	AccessKey        string `json:"access_key"`
+	SecretKey        string `json:"secret_key"`
+	PathStyle        bool   `json:"path_style"`
+	Prefix           string `json:"prefix"`
+	UrlExpireMinutes int    `json:"url_expire_minutes"`
+}
+
+// 上传文件病毒扫描配置, Address 为clamd地址, 如 tcp://127.0.0.1:3310 或 unix:///var/run/clamav/clamd.ctl
+// Mode: reject 发现病毒拒绝上传(默认) quarantine 可疑文件隔离, 客服审核通过后访客才能下载
+// Suspicious 为隔离模式下视为可疑而不是病毒的特征前缀, 默认 Heuristics. 和 PUA.
+// FailOpen 扫描服务不可用时是否接受文件, 默认拒绝, 隔离模式下隔离
+type UploadScan struct {
+	Enable         bool     `json:"enable"`
+	Address        string   `json:"address"`
+	TimeoutSeconds int      `json:"timeout_seconds"`
+	Mode           string   `json:"mode"`
+	Suspicious     []string `json:"suspicious"`
+	FailOpen       bool     `json:"fail_open"`
+}
+
+// 令牌配置, Keys 中 Kid 等于 CurrentKid 的密钥用于签发, 其余只用于校验
+type Jwt struct {
+	Keys          []tools.JwtKey `json:"keys"`
+	CurrentKid    string         `json:"current_kid"`
+	AccessMinutes int            `json:"access_minutes"`
+	RefreshHours  int            `json:"refresh_hours"`
 }
 
 func GetMysqlConf() *Mysql {
@@ -69,6 +172,23 @@ func GetPrefix() string {
 	return ""
 }
 
+// GetBaseUrl 站点的完整访问地址(包含前缀), 用于生成邮件中的链接
+// 不能使用请求中的Host, 否则攻击者伪造Host就能让邮件中的令牌发到自己的域名; 环境变量 GOFLY_BASE_URL 优先
+func GetBaseUrl() (string, error) {
+	base := GetAppConf().App.BaseUrl
+	if env := os.Getenv("GOFLY_BASE_URL"); env != "" {
+		base = env
+	}
+	if base == "" {
+		return "", errors.New("base_url is not configured")
+	}
+	u, err := url.Parse(base)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return "", errors.New("base_url must be an http or https url")
+	}
+	return strings.TrimRight(base, "/"), nil
+}
+
 // GetBasePath 获取基础路径，用于模板渲染
 func GetBasePath() string {
 	return GetPrefix()
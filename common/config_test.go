@@ -0,0 +1,24 @@
+package common
+
+import "testing"
+
+func TestGetBaseUrl(t *testing.T) {
+	cases := []struct {
+		env  string
+		want string
+		ok   bool
+	}{
+		{"", "", false},
+		{"https://chat.example.com/", "https://chat.example.com", true},
+		{"http://example.com/goflychat", "http://example.com/goflychat", true},
+		{"javascript:alert(1)", "", false},
+		{"chat.example.com", "", false},
+	}
+	for _, c := range cases {
+		t.Setenv("GOFLY_BASE_URL", c.env)
+		got, err := GetBaseUrl()
+		if got != c.want || (err == nil) != c.ok {
+			t.Errorf("GetBaseUrl() with %q == %q, %v, want %q", c.env, got, err, c.want)
+		}
+	}
+}
@@ -0,0 +1,35 @@
+package common
+
+import (
+	"goflylivechat/tools"
+	"os"
+	"strings"
+)
+
+// InitEncryption 加载字段加密密钥, 环境变量优先于配置文件, 未配置密钥时不加密
+// GOFLY_ENCRYPTION_KEYS 格式为 kid1:base64key1,kid2:base64key2, GOFLY_ENCRYPTION_KID 指定加密使用的kid
+// GOFLY_BLIND_INDEX_KEY 为盲索引密钥
+func InitEncryption() error {
+	conf := GetAppConf().App.Encryption
+	keys := conf.Keys
+	current := conf.CurrentKid
+	indexKey := conf.BlindIndexKey
+	if env := os.Getenv("GOFLY_ENCRYPTION_KEYS"); env != "" {
+		keys = nil
+		for _, item := range strings.Split(env, ",") {
+			kv := strings.SplitN(strings.TrimSpace(item), ":", 2)
+			if len(kv) != 2 {
+				continue
+			}
+			keys = append(keys, tools.FieldKey{Kid: kv[0], Key: kv[1]})
+		}
+		current = os.Getenv("GOFLY_ENCRYPTION_KID")
+	}
+	if env := os.Getenv("GOFLY_BLIND_INDEX_KEY"); env != "" {
+		indexKey = env
+	}
+	if len(keys) > 0 && current == "" {
+		current = keys[len(keys)-1].Kid
+	}
+	return tools.SetFieldKeys(keys, current, indexKey)
+}
@@ -0,0 +1,56 @@
+package common
+
+import (
+	"goflylivechat/tools"
+	"log"
+	"os"
+	"strings"
+	"time"
+)
+
+// InitJwt 加载令牌签名密钥, 环境变量优先于配置文件
+// GOFLY_JWT_KEYS 格式为 kid1:secret1,kid2:secret2, GOFLY_JWT_KID 指定签发使用的kid
+func InitJwt() error {
+	conf := GetAppConf().App.Jwt
+	keys := conf.Keys
+	current := conf.CurrentKid
+	if env := os.Getenv("GOFLY_JWT_KEYS"); env != "" {
+		keys = nil
+		for _, item := range strings.Split(env, ",") {
+			kv := strings.SplitN(strings.TrimSpace(item), ":", 2)
+			if len(kv) != 2 {
+				continue
+			}
+			keys = append(keys, tools.JwtKey{Kid: kv[0], Secret: kv[1]})
+		}
+		current = os.Getenv("GOFLY_JWT_KID")
+	}
+	if len(keys) == 0 {
+		log.Println("jwt keys are not configured, using a random key, tokens will be invalid after restart")
+		key := tools.RandomJwtKey()
+		keys = []tools.JwtKey{key}
+		current = key.Kid
+	}
+	if current == "" {
+		current = keys[len(keys)-1].Kid
+	}
+	return tools.SetJwtKeys(keys, current)
+}
+
+// AccessTokenExpire 访问令牌有效期,默认30分钟
+func AccessTokenExpire() time.Duration {
+	minutes := GetAppConf().App.Jwt.AccessMinutes
+	if minutes <= 0 {
+		minutes = 30
+	}
+	return time.Duration(minutes) * time.Minute
+}
+
+// RefreshTokenExpire 刷新令牌有效期,默认7天
+func RefreshTokenExpire() time.Duration {
+	hours := GetAppConf().App.Jwt.RefreshHours
+	if hours <= 0 {
+		hours = 7 * 24
+	}
+	return time.Duration(hours) * time.Hour
+}
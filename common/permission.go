@@ -0,0 +1,136 @@
+package common
+
+import "strings"
+
+// 权限标识, PermAll 表示拥有全部权限
+const (
+	PermAll          = "*"
+	PermProfile      = "profile"
+	PermKefuManage   = "kefu_manage"
+	PermRoleManage   = "role_manage"
+	PermConfig       = "config"
+	PermReply        = "reply"
+	PermPrechat      = "prechat"
+	PermInvite       = "invite"
+	PermIpblack      = "ipblack"
+	PermIpblackAll   = "ipblack_all"
+	PermAboutManage  = "about_manage"
+	PermCsatReport   = "csat_report"
+	PermSecurity     = "security"
+	PermAudit        = "audit"
+	PermVisitorData  = "visitor_data"
+	PermUploadReview = "upload_review"
+	PermUploadUsage  = "upload_usage"
+	DefaultKefuRole  = 2
+	SuperAdminRoleId = 1
+)
+
+type Permission struct {
+	Key  string `json:"key"`
+	Name string `json:"name"`
+}
+
+// 全部权限,用于角色配置
+var Permissions = []Permission{
+	{PermProfile, "修改个人资料"},
+	{PermKefuManage, "客服管理"},
+	{PermRoleManage, "角色管理"},
+	{PermConfig, "个人配置"},
+	{PermReply, "快捷回复"},
+	{PermPrechat, "售前表单"},
+	{PermInvite, "主动邀请"},
+	{PermIpblack, "IP黑名单"},
+	{PermIpblackAll, "查看全部IP黑名单"},
+	{PermAboutManage, "关于页面管理"},
+	{PermCsatReport, "满意度报表"},
+	{PermSecurity, "安全设置"},
+	{PermAudit, "审计日志"},
+	{PermVisitorData, "访客数据导出与删除"},
+	{PermUploadReview, "上传文件审核"},
+	{PermUploadUsage, "上传存储统计"},
+}
+
+// 路由需要的权限, key为"请求方法 路径",路径不含路由前缀
+var RoutePermissions = map[string]string{
+	"GET /kefuinfo":                 PermProfile,
+	"POST /kefuinfo":                PermProfile,
+	"POST /modifypass":              PermProfile,
+	"POST /modifyavator":            PermProfile,
+	"GET /kefuinfo_setting":         PermKefuManage,
+	"DELETE /kefuinfo":              PermKefuManage,
+	"GET /kefulist":                 PermKefuManage,
+	"POST /user_role":               PermKefuManage,
+	"GET /roles":                    PermRoleManage,
+	"POST /role":                    PermRoleManage,
+	"DELETE /role":                  PermRoleManage,
+	"GET /permissions":              PermRoleManage,
+	"GET /configs":                  PermConfig,
+	"POST /config":                  PermConfig,
+	"POST /reply":                   PermReply,
+	"POST /reply_content":           PermReply,
+	"POST /reply_content_save":      PermReply,
+	"DELETE /reply_content":         PermReply,
+	"DELETE /reply":                 PermReply,
+	"POST /prechat_field":           PermPrechat,
+	"DELETE /prechat_field":         PermPrechat,
+	"POST /invite_rule":             PermInvite,
+	"DELETE /invite_rule":           PermInvite,
+	"DELETE /ipblack":               PermIpblack,
+	"GET /ipblacks_all":             PermIpblackAll,
+	"POST /about":                   PermAboutManage,
+	"GET /aboutpages":               PermAboutManage,
+	"GET /csat_statistics":          PermCsatReport,
+	"GET /totp":                     PermProfile,
+	"POST /totp_setup":              PermProfile,
+	"POST /totp_enable":             PermProfile,
+	"POST /totp_recovery":           PermProfile,
+	"POST /totp_disable":            PermProfile,
+	"POST /totp_reset":              PermSecurity,
+	"POST /totp_policy":             PermSecurity,
+	"GET /login_attempts":           PermSecurity,
+	"POST /login_unlock":            PermSecurity,
+	"GET /register_invites":         PermKefuManage,
+	"POST /register_invite":         PermKefuManage,
+	"DELETE /register_invite":       PermKefuManage,
+	"POST /visitor_identity_secret": PermConfig,
+	"GET /site_domains":             PermSecurity,
+	"POST /site_domains":            PermSecurity,
+	"GET /audits":                   PermAudit,
+	"GET /audits_export":            PermAudit,
+	"GET /visitor_data_export":      PermVisitorData,
+	"DELETE /visitor_data":          PermVisitorData,
+	"GET /upload_scans":             PermUploadReview,
+	"POST /upload_scan_approve":     PermUploadReview,
+	"DELETE /upload_scan":           PermUploadReview,
+	"GET /upload_scan_file":         PermUploadReview,
+	"GET /upload_usage":             PermUploadUsage,
+}
+
+// RoutePermission 获取路由需要的权限,未配置的路由返回空
+func RoutePermission(method, path string) string {
+	return RoutePermissions[method+" "+path]
+}
+
+// IsPermission 判断是否是已定义的权限
+func IsPermission(perm string) bool {
+	if perm == PermAll {
+		return true
+	}
+	for _, p := range Permissions {
+		if p.Key == perm {
+			return true
+		}
+	}
+	return false
+}
+
+// HasPermission 判断权限集合中是否包含指定权限
+func HasPermission(perms []string, perm string) bool {
+	for _, p := range perms {
+		p = strings.TrimSpace(p)
+		if p == PermAll || p == perm {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,35 @@
+package common
+
+import "testing"
+
+// 路由是否都配置了权限由 router 包的 TestRbacRoutesHavePermission 检查
+func TestRoutePermissionsDefined(t *testing.T) {
+	for route, perm := range RoutePermissions {
+		if !IsPermission(perm) {
+			t.Errorf("route %q uses undefined permission %q", route, perm)
+		}
+	}
+	if got := RoutePermission("PUT", "/kefuinfo"); got != "" {
+		t.Errorf("RoutePermission for unknown route == %q, want empty", got)
+	}
+}
+
+func TestHasPermission(t *testing.T) {
+	cases := []struct {
+		perms []string
+		perm  string
+		want  bool
+	}{
+		{[]string{PermAll}, PermKefuManage, true},
+		{[]string{PermProfile, PermReply}, PermReply, true},
+		{[]string{PermProfile, " " + PermReply}, PermReply, true},
+		{[]string{PermProfile, PermReply}, PermKefuManage, false},
+		{nil, PermProfile, false},
+	}
+	for _, c := range cases {
+		got := HasPermission(c.perms, c.perm)
+		if got != c.want {
+			t.Errorf("HasPermission(%v, %q) == %v, want %v", c.perms, c.perm, got, c.want)
+		}
+	}
+}
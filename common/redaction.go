@@ -0,0 +1,36 @@
+package common
+
+import "goflylivechat/tools"
+
+// 关闭内置规则的策略
+const RedactOff = "off"
+
+// InitRedaction 加载消息敏感信息规则, 身份证号和手机号先于银行卡号匹配, 避免被当作卡号
+func InitRedaction() error {
+	conf := GetAppConf().App.Redaction
+	if !conf.Enable {
+		return tools.SetRedactRules(nil)
+	}
+	rules := make([]tools.RedactRule, 0, len(conf.Patterns)+3)
+	builtin := []tools.RedactRule{
+		{Name: tools.RedactIdCard, Label: "身份证号", Policy: conf.IdCard},
+		{Name: tools.RedactPhone, Label: "手机号", Policy: conf.Phone},
+		{Name: tools.RedactCard, Label: "银行卡号", Policy: conf.Card},
+	}
+	for _, rule := range builtin {
+		if rule.Policy == RedactOff {
+			continue
+		}
+		if rule.Policy == "" {
+			rule.Policy = tools.RedactMask
+		}
+		rules = append(rules, rule)
+	}
+	for _, rule := range conf.Patterns {
+		if rule.Policy == "" {
+			rule.Policy = tools.RedactMask
+		}
+		rules = append(rules, rule)
+	}
+	return tools.SetRedactRules(rules)
+}
@@ -0,0 +1,13 @@
+package common
+
+// GetRetention 数据保留配置, 未配置时不清理任何数据
+func GetRetention() Retention {
+	r := GetAppConf().App.Retention
+	if r.BatchSize <= 0 {
+		r.BatchSize = 500
+	}
+	if r.IntervalHours <= 0 {
+		r.IntervalHours = 24
+	}
+	return r
+}
@@ -0,0 +1,93 @@
+package common
+
+import (
+	"errors"
+	"goflylivechat/tools"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 上传文件的扫描状态, 为空表示未扫描
+const (
+	ScanClean          = "clean"
+	ScanInfected       = "infected"
+	ScanQuarantined    = "quarantined"
+	ScanApproved       = "approved"
+	ScanSkipped        = "skipped"
+	ScanModeReject     = "reject"
+	ScanModeQuarantine = "quarantine"
+)
+
+var uploadScanner = struct {
+	sync.RWMutex
+	s *tools.ClamdScanner
+}{}
+
+// InitUploadScan 按配置创建clamd扫描客户端, 未开启时不扫描
+func InitUploadScan() error {
+	conf := GetAppConf().App.Scan
+	var scanner *tools.ClamdScanner
+	if conf.Enable {
+		if conf.Mode != "" && conf.Mode != ScanModeReject && conf.Mode != ScanModeQuarantine {
+			return errors.New("unknown scan mode " + conf.Mode)
+		}
+		var err error
+		scanner, err = tools.NewClamdScanner(conf.Address, time.Duration(conf.TimeoutSeconds)*time.Second)
+		if err != nil {
+			return err
+		}
+	}
+	uploadScanner.Lock()
+	uploadScanner.s = scanner
+	uploadScanner.Unlock()
+	return nil
+}
+
+// GetUploadScanner 扫描客户端, 未开启扫描时为nil
+func GetUploadScanner() *tools.ClamdScanner {
+	uploadScanner.RLock()
+	defer uploadScanner.RUnlock()
+	return uploadScanner.s
+}
+
+// ScanDecision 扫描结果的处理, Reject 为true时拒绝上传
+type ScanDecision struct {
+	Status string
+	Detail string
+	Reject bool
+}
+
+// DecideScan 按配置处理扫描结果
+// 隔离模式下可疑特征和扫描失败的文件隔离, 其他病毒仍然拒绝
+func (u UploadScan) DecideScan(res tools.ScanResult, err error) ScanDecision {
+	quarantine := u.Mode == ScanModeQuarantine
+	if err != nil {
+		switch {
+		case quarantine:
+			return ScanDecision{Status: ScanQuarantined, Detail: err.Error()}
+		case u.FailOpen:
+			return ScanDecision{Status: ScanSkipped, Detail: err.Error()}
+		}
+		return ScanDecision{Status: ScanSkipped, Detail: err.Error(), Reject: true}
+	}
+	if !res.Infected {
+		return ScanDecision{Status: ScanClean}
+	}
+	if quarantine && u.isSuspicious(res.Signature) {
+		return ScanDecision{Status: ScanQuarantined, Detail: res.Signature}
+	}
+	return ScanDecision{Status: ScanInfected, Detail: res.Signature, Reject: true}
+}
+func (u UploadScan) isSuspicious(signature string) bool {
+	prefixes := u.Suspicious
+	if len(prefixes) == 0 {
+		prefixes = []string{"Heuristics.", "PUA."}
+	}
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(signature, prefix) {
+			return true
+		}
+	}
+	return false
+}
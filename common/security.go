@@ -0,0 +1,40 @@
+package common
+
+import "time"
+
+// 登录验证码模式
+const (
+	CaptchaOff    = "off"
+	CaptchaAlways = "always"
+	CaptchaFailed = "failed"
+)
+
+// 注册模式
+const (
+	RegisterDisabled = "disabled"
+	RegisterInvite   = "invite"
+	RegisterOpen     = "open"
+)
+
+// GetSecurity 登录安全配置, 未配置时使用默认值
+func GetSecurity() Security {
+	s := GetAppConf().App.Security
+	if s.LoginCaptcha == "" {
+		s.LoginCaptcha = CaptchaFailed
+	}
+	if s.RegisterMode != RegisterDisabled && s.RegisterMode != RegisterOpen {
+		s.RegisterMode = RegisterInvite
+	}
+	if s.MaxLoginFailures <= 0 {
+		s.MaxLoginFailures = 5
+	}
+	if s.LockoutMinutes <= 0 {
+		s.LockoutMinutes = 15
+	}
+	return s
+}
+
+// LockoutWindow 统计失败次数的时间窗口, 也是锁定时长
+func (s Security) LockoutWindow() time.Duration {
+	return time.Duration(s.LockoutMinutes) * time.Minute
+}
@@ -0,0 +1,35 @@
+package common
+
+import (
+	"crypto/subtle"
+	"goflylivechat/tools"
+	"os"
+	"strings"
+)
+
+// NewSetupToken 生成网页安装使用的一次性令牌, 文件中只保存sha256
+func NewSetupToken() (string, error) {
+	token := tools.NewTokenId()
+	if err := os.MkdirAll(Dir, 0700); err != nil {
+		return "", err
+	}
+	if err := os.WriteFile(SetupTokenFile, []byte(tools.Sha256(token)), 0600); err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// CheckSetupToken 校验安装令牌, 未生成令牌时一律拒绝
+func CheckSetupToken(token string) bool {
+	hash, err := os.ReadFile(SetupTokenFile)
+	token = strings.TrimSpace(token)
+	if err != nil || token == "" {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(strings.TrimSpace(string(hash))), []byte(tools.Sha256(token))) == 1
+}
+
+// RemoveSetupToken 安装完成后删除令牌
+func RemoveSetupToken() {
+	os.Remove(SetupTokenFile)
+}
@@ -0,0 +1,67 @@
+package common
+
+import (
+	"errors"
+	"goflylivechat/tools"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+var fileStorage = struct {
+	sync.RWMutex
+	s tools.Storage
+}{}
+
+// InitStorage 按配置创建文件存储, 对象存储的密钥可以用环境变量 GOFLY_S3_ACCESS_KEY GOFLY_S3_SECRET_KEY 设置
+func InitStorage() error {
+	conf := GetAppConf().App.Storage
+	var s tools.Storage
+	switch conf.Type {
+	case "", "local":
+		s = localStorage()
+	case "s3":
+		accessKey, secretKey := conf.AccessKey, conf.SecretKey
+		if env := os.Getenv("GOFLY_S3_ACCESS_KEY"); env != "" {
+			accessKey = env
+		}
+		if env := os.Getenv("GOFLY_S3_SECRET_KEY"); env != "" {
+			secretKey = env
+		}
+		var err error
+		s, err = tools.NewS3Storage(conf.Endpoint, conf.Region, conf.Bucket, accessKey, secretKey, conf.PathStyle, conf.Prefix)
+		if err != nil {
+			return err
+		}
+	default:
+		return errors.New("unknown storage type " + conf.Type)
+	}
+	fileStorage.Lock()
+	fileStorage.s = s
+	fileStorage.Unlock()
+	return nil
+}
+
+// GetStorage 文件存储, 未初始化时使用本地磁盘
+func GetStorage() tools.Storage {
+	fileStorage.RLock()
+	s := fileStorage.s
+	fileStorage.RUnlock()
+	if s == nil {
+		return localStorage()
+	}
+	return s
+}
+func localStorage() *tools.LocalStorage {
+	return &tools.LocalStorage{Dir: Upload, BaseURL: "/" + strings.TrimSuffix(Upload, "/")}
+}
+
+// StorageUrlExpire 下载地址的有效期
+func StorageUrlExpire() time.Duration {
+	minutes := GetAppConf().App.Storage.UrlExpireMinutes
+	if minutes <= 0 {
+		minutes = 60
+	}
+	return time.Duration(minutes) * time.Minute
+}
@@ -0,0 +1,92 @@
+package common
+
+import (
+	"goflylivechat/tools"
+	"strings"
+)
+
+// GetUploadPolicy 上传配置, 未配置的类型使用默认值: 图片10M, 其他文件90M
+// 缩略图尺寸限制在16到4096像素之间, 重复的尺寸只保留一个
+func GetUploadPolicy() UploadPolicy {
+	u := GetAppConf().App.Upload
+	if len(u.AllowTypes) == 0 {
+		u.AllowTypes = tools.DefaultUploadTypes()
+	}
+	sizes := map[string]int{"image": 10, "default": 90}
+	for k, v := range u.MaxSizeMB {
+		if v > 0 {
+			sizes[k] = v
+		}
+	}
+	u.MaxSizeMB = sizes
+	if len(u.ThumbSizes) == 0 {
+		u.ThumbSizes = tools.DefaultThumbnailSizes
+	}
+	thumbs := make([]int, 0, len(u.ThumbSizes))
+	seen := make(map[int]bool)
+	for _, size := range u.ThumbSizes {
+		if size >= 16 && size <= 4096 && !seen[size] {
+			seen[size] = true
+			thumbs = append(thumbs, size)
+		}
+	}
+	u.ThumbSizes = thumbs
+	return u
+}
+
+// Allowed 是否允许上传该类型
+func (u UploadPolicy) Allowed(ctype string) bool {
+	for _, t := range u.AllowTypes {
+		if t == ctype {
+			return true
+		}
+	}
+	return false
+}
+
+// MaxSize 该类型允许的最大字节数, 依次匹配完整类型、大类和default
+func (u UploadPolicy) MaxSize(ctype string) int64 {
+	mb, ok := u.MaxSizeMB[ctype]
+	if !ok {
+		mb, ok = u.MaxSizeMB[strings.SplitN(ctype, "/", 2)[0]]
+	}
+	if !ok {
+		mb = u.MaxSizeMB["default"]
+	}
+	return int64(mb) * 1024 * 1024
+}
+
+// DailyQuota 每天允许上传的文件数和字节数, 返回0时不限制
+// 配置为0时使用默认值, 访客100个文件和200M, 客服1000个文件和2048M, 小于0时不限制
+func (u UploadPolicy) DailyQuota(isKefu bool) (int64, int64) {
+	files, mb := u.VisitorDailyFiles, u.VisitorDailyMB
+	defaultFiles, defaultMB := 100, 200
+	if isKefu {
+		files, mb = u.KefuDailyFiles, u.KefuDailyMB
+		defaultFiles, defaultMB = 1000, 2048
+	}
+	if files == 0 {
+		files = defaultFiles
+	}
+	if mb == 0 {
+		mb = defaultMB
+	}
+	if files < 0 {
+		files = 0
+	}
+	if mb < 0 {
+		mb = 0
+	}
+	return int64(files), int64(mb) * 1024 * 1024
+}
+
+// MaxRequestSize 上传请求体的上限, 为最大的类型限制加上表单开销
+func (u UploadPolicy) MaxRequestSize() int64 {
+	var max int
+	for _, mb := range u.MaxSizeMB {
+		if mb > max {
+			max = mb
+		}
+	}
+	return int64(max+1) * 1024 * 1024
+}
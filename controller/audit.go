@@ -0,0 +1,167 @@
+package controller
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"github.com/gin-gonic/gin"
+	"goflylivechat/common"
+	"goflylivechat/models"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 审计操作类型
+const (
+	AuditKefuDelete       = "kefu.delete"
+	AuditUserRole         = "kefu.role"
+	AuditRoleSave         = "role.save"
+	AuditRoleDelete       = "role.delete"
+	AuditConfigUpdate     = "config.update"
+	AuditSiteDomains      = "config.site_domains"
+	AuditIdentitySecret   = "config.identity_secret"
+	AuditIpblackCreate    = "ipblack.create"
+	AuditIpblackDelete    = "ipblack.delete"
+	AuditInviteCreate     = "invite.create"
+	AuditInviteDelete     = "invite.delete"
+	AuditVisitorTransfer  = "visitor.transfer"
+	AuditVisitorClose     = "visitor.close"
+	AuditVisitorExport    = "visitor.export"
+	AuditVisitorErase     = "visitor.erase"
+	AuditExport           = "audit.export"
+	AuditRetention        = "retention.purge"
+	AuditUploadApprove    = "upload.approve"
+	AuditUploadDelete     = "upload.delete"
+	auditExportBatch      = 500
+	auditExportMaxRows    = 100000
+	auditUserAgentMaxSize = 500
+)
+
+var AuditActions = []string{
+	AuditKefuDelete, AuditUserRole, AuditRoleSave, AuditRoleDelete,
+	AuditConfigUpdate, AuditSiteDomains, AuditIdentitySecret,
+	AuditIpblackCreate, AuditIpblackDelete, AuditInviteCreate, AuditInviteDelete,
+	AuditVisitorTransfer, AuditVisitorClose, AuditVisitorExport, AuditVisitorErase, AuditExport,
+	AuditRetention, AuditUploadApprove, AuditUploadDelete,
+}
+
+// saveAudit 记录当前客服的操作, before/after 为字符串时原样保存, 其他类型保存为json
+func saveAudit(c *gin.Context, action string, target string, before, after interface{}) {
+	actor, _ := c.Get("kefu_name")
+	actorName, _ := actor.(string)
+	userAgent := c.Request.UserAgent()
+	if len(userAgent) > auditUserAgentMaxSize {
+		userAgent = userAgent[:auditUserAgentMaxSize]
+	}
+	models.CreateAudit(models.Audit{
+		Actor:       actorName,
+		Action:      action,
+		Target:      target,
+		BeforeValue: auditValue(before),
+		AfterValue:  auditValue(after),
+		Ip:          c.ClientIP(),
+		UserAgent:   userAgent,
+	})
+}
+func auditValue(v interface{}) string {
+	switch val := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return val
+	}
+	b, _ := json.Marshal(v)
+	return string(b)
+}
+
+// auditConfigValue 密码、密钥类配置不记录明文
+func auditConfigValue(key string, value string) string {
+	lower := strings.ToLower(key)
+	if value != "" && (strings.Contains(lower, "password") || strings.Contains(lower, "secret") || strings.Contains(lower, "token")) {
+		return "******"
+	}
+	return value
+}
+
+// auditQuery 审计日志的筛选条件
+func auditQuery(c *gin.Context) (string, []interface{}) {
+	query := "1 = 1"
+	args := make([]interface{}, 0)
+	if actor := c.Query("actor"); actor != "" {
+		query += " and actor = ?"
+		args = append(args, actor)
+	}
+	if action := c.Query("action"); action != "" {
+		query += " and action = ?"
+		args = append(args, action)
+	}
+	if target := c.Query("target"); target != "" {
+		query += " and target = ?"
+		args = append(args, target)
+	}
+	if c.Query("start") != "" || c.Query("end") != "" {
+		start, end := parsePeriod(c.Query("start"), c.Query("end"))
+		query += " and created_at >= ? and created_at < ?"
+		args = append(args, start, end)
+	}
+	return query, args
+}
+func GetAudits(c *gin.Context) {
+	page, _ := strconv.Atoi(c.Query("page"))
+	if page == 0 {
+		page = 1
+	}
+	query, args := auditQuery(c)
+	c.JSON(200, gin.H{
+		"code": 200,
+		"msg":  "ok",
+		"result": gin.H{
+			"list":     models.FindAudits(uint(page), common.PageSize, query, args...),
+			"count":    models.CountAudits(query, args...),
+			"pagesize": common.PageSize,
+			"actions":  AuditActions,
+		},
+	})
+}
+
+// GetAuditsExport 按筛选条件导出csv, 最多导出auditExportMaxRows条
+func GetAuditsExport(c *gin.Context) {
+	query, args := auditQuery(c)
+	saveAudit(c, AuditExport, "", nil, c.Request.URL.RawQuery)
+	c.Header("Content-Type", "text/csv; charset=utf-8")
+	c.Header("Content-Disposition", "attachment; filename=audit-"+time.Now().Format("20060102150405")+".csv")
+	c.Writer.WriteString("\xEF\xBB\xBF")
+	w := csv.NewWriter(c.Writer)
+	w.Write([]string{"id", "created_at", "actor", "action", "target", "before", "after", "ip", "user_agent"})
+	var lastId uint
+	for rows := 0; rows < auditExportMaxRows; {
+		audits := models.FindAuditsBefore(lastId, auditExportBatch, query, args...)
+		for _, audit := range audits {
+			w.Write([]string{
+				strconv.Itoa(int(audit.ID)),
+				audit.CreatedAt.Format("2006-01-02 15:04:05"),
+				csvCell(audit.Actor),
+				csvCell(audit.Action),
+				csvCell(audit.Target),
+				csvCell(audit.BeforeValue),
+				csvCell(audit.AfterValue),
+				csvCell(audit.Ip),
+				csvCell(audit.UserAgent),
+			})
+			lastId = audit.ID
+		}
+		rows += len(audits)
+		w.Flush()
+		if len(audits) < auditExportBatch {
+			break
+		}
+	}
+}
+
+// csvCell 防止表格软件把单元格当作公式执行
+func csvCell(s string) string {
+	if s != "" && strings.ContainsRune("=+-@\t\r", rune(s[0])) {
+		return "'" + s
+	}
+	return s
+}
@@ -9,14 +9,31 @@ import (
 	"time"
 )
 
+// GetCaptcha 验证码图片, 带captcha_id时显示GetCaptchaId创建的验证码, 否则新建验证码并保存到会话
 func GetCaptcha(c *gin.Context) {
-	l := captcha.DefaultLen
 	w, h := 107, 36
-	captchaId := captcha.NewLen(l)
-	session := sessions.Default(c)
-	session.Set("captcha", captchaId)
-	_ = session.Save()
-	_ = Serve(c.Writer, c.Request, captchaId, ".png", "zh", false, w, h)
+	captchaId := c.Query("captcha_id")
+	if captchaId == "" {
+		captchaId = captcha.NewLen(captcha.DefaultLen)
+		session := sessions.Default(c)
+		session.Set("captcha", captchaId)
+		_ = session.Save()
+	}
+	if err := Serve(c.Writer, c.Request, captchaId, ".png", "zh", false, w, h); err != nil {
+		c.Status(http.StatusNotFound)
+	}
+}
+
+// GetCaptchaId 新建验证码, 提交时把ID和答案一起带上
+// 不依赖会话cookie, 会话cookie为Secure时HTTP部署也能通过验证
+func GetCaptchaId(c *gin.Context) {
+	c.JSON(200, gin.H{
+		"code": 200,
+		"msg":  "ok",
+		"result": gin.H{
+			"captcha_id": captcha.NewLen(captcha.DefaultLen),
+		},
+	})
 }
 
 func Serve(w http.ResponseWriter, r *http.Request, id, ext, lang string, download bool, width, height int) error {
@@ -27,11 +44,15 @@ func Serve(w http.ResponseWriter, r *http.Request, id, ext, lang string, downloa
 	var content bytes.Buffer
 	switch ext {
 	case ".png":
+		if err := captcha.WriteImage(&content, id, width, height); err != nil {
+			return err
+		}
 		w.Header().Set("Content-Type", "image/png")
-		_ = captcha.WriteImage(&content, id, width, height)
 	case ".wav":
+		if err := captcha.WriteAudio(&content, id, lang); err != nil {
+			return err
+		}
 		w.Header().Set("Content-Type", "audio/x-wav")
-		_ = captcha.WriteAudio(&content, id, lang)
 	default:
 		return captcha.ErrNotFound
 	}
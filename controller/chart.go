@@ -1,6 +1,7 @@
 package controller
 
 import (
+	"fmt"
 	"github.com/gin-gonic/gin"
 	"goflylivechat/models"
 	"goflylivechat/tools"
@@ -16,6 +17,11 @@ func GetChartStatistic(c *gin.Context) {
 		dayNumMap[item.Day] = tools.Int2Str(item.Num)
 	}
 
+	csatMap := make(map[string]models.RateSummary)
+	for _, item := range models.SumRatesEveryDay(kefuName.(string)) {
+		csatMap[item.Day] = item
+	}
+
 	nowTime := time.Now()
 	list := make([]map[string]string, 0)
 	for i := 0; i > -46; i-- {
@@ -24,6 +30,11 @@ func GetChartStatistic(c *gin.Context) {
 		tmp := make(map[string]string)
 		tmp["day"] = resTime
 		tmp["num"] = dayNumMap[resTime]
+		if csat, ok := csatMap[resTime]; ok {
+			tmp["csat_num"] = tools.Int2Str(csat.Num)
+			tmp["csat_satisfied"] = tools.Int2Str(csat.Satisfied)
+			tmp["csat_avg"] = fmt.Sprintf("%.2f", csat.Avg)
+		}
 		list = append(list, tmp)
 	}
 
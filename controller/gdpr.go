@@ -0,0 +1,50 @@
+package controller
+
+import (
+	"github.com/gin-gonic/gin"
+	"goflylivechat/models"
+	"goflylivechat/tools"
+	"goflylivechat/ws"
+)
+
+// GetVisitorDataExport 导出访客的全部数据, 返回zip压缩包
+func GetVisitorDataExport(c *gin.Context) {
+	visitorId := c.Query("visitor_id")
+	data, err := models.FindVisitorData(visitorId)
+	if err != nil {
+		c.JSON(200, gin.H{
+			"code": 400,
+			"msg":  err.Error(),
+		})
+		return
+	}
+	saveAudit(c, AuditVisitorExport, visitorId, nil, gin.H{"messages": len(data.Messages), "files": len(data.Files)})
+	c.Header("Content-Type", "application/zip")
+	c.Header("Content-Disposition", "attachment; filename=visitor-"+visitorId+".zip")
+	if err := models.ExportVisitorData(c.Writer, data); err != nil {
+		tools.Logger().Println("export visitor data", visitorId, err)
+	}
+}
+
+// DeleteVisitorData 删除访客的全部数据, 在线访客同时断开连接
+func DeleteVisitorData(c *gin.Context) {
+	visitorId := c.Query("visitor_id")
+	result, err := models.EraseVisitorData(visitorId)
+	if err != nil {
+		c.JSON(200, gin.H{
+			"code": 400,
+			"msg":  err.Error(),
+		})
+		return
+	}
+	if visitor, ok := ws.ClientList[visitorId]; ok && visitor != nil {
+		visitor.Conn.Close()
+		delete(ws.ClientList, visitorId)
+	}
+	saveAudit(c, AuditVisitorErase, visitorId, nil, result)
+	c.JSON(200, gin.H{
+		"code":   200,
+		"msg":    "ok",
+		"result": result,
+	})
+}
@@ -0,0 +1,195 @@
+package controller
+
+import (
+	"github.com/gin-gonic/gin"
+	"goflylivechat/models"
+	"goflylivechat/tools"
+	"goflylivechat/ws"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// 访客浏览轨迹,只保存在内存中
+type pageVisit struct {
+	Url      string
+	Pages    uint
+	PageTime time.Time
+	LastTime time.Time
+	Invited  map[uint]bool
+}
+type pageVisitMap struct {
+	sync.Mutex
+	visits map[string]*pageVisit
+}
+
+var pageVisits = &pageVisitMap{
+	visits: make(map[string]*pageVisit),
+}
+
+// 访问记录过期时间
+const pageVisitExpire = 30 * time.Minute
+
+// track 记录访客浏览事件,返回当前轨迹的副本(不含已邀请记录)
+func (m *pageVisitMap) track(visitorId string, url string, event string) pageVisit {
+	m.Lock()
+	defer m.Unlock()
+	now := time.Now()
+	for id, visit := range m.visits {
+		if now.Sub(visit.LastTime) > pageVisitExpire {
+			delete(m.visits, id)
+		}
+	}
+	visit, ok := m.visits[visitorId]
+	if !ok {
+		visit = &pageVisit{
+			Invited: make(map[uint]bool),
+		}
+		m.visits[visitorId] = visit
+	}
+	if event == "view" || visit.Url != url {
+		visit.Url = url
+		visit.Pages++
+		visit.PageTime = now
+	}
+	visit.LastTime = now
+	return pageVisit{
+		Url:      visit.Url,
+		Pages:    visit.Pages,
+		PageTime: visit.PageTime,
+		LastTime: visit.LastTime,
+	}
+}
+
+// markInvited 标记规则已对访客触发,同一规则在一次访问中只触发一次
+func (m *pageVisitMap) markInvited(visitorId string, ruleId uint) bool {
+	m.Lock()
+	defer m.Unlock()
+	visit, ok := m.visits[visitorId]
+	if !ok || visit.Invited[ruleId] {
+		return false
+	}
+	visit.Invited[ruleId] = true
+	return true
+}
+
+// PostVisitorPageview 访客端上报浏览事件, event为view(打开页面)或stay(停留心跳)
+func PostVisitorPageview(c *gin.Context) {
+	visitorId := c.GetString("visitor_id")
+	url := c.PostForm("url")
+	event := c.DefaultPostForm("event", "view")
+	if visitorId == "" || url == "" {
+		c.JSON(200, gin.H{
+			"code": 400,
+			"msg":  "参数不能为空",
+		})
+		return
+	}
+	visitor := models.FindVisitorByVistorId(visitorId)
+	if visitor.ID == 0 {
+		c.JSON(200, gin.H{
+			"code": 400,
+			"msg":  "访客不存在",
+		})
+		return
+	}
+	visit := pageVisits.track(visitorId, url, event)
+	go checkInviteRules(visitor, visit)
+	c.JSON(200, gin.H{
+		"code": 200,
+		"msg":  "ok",
+	})
+}
+
+// checkInviteRules 按规则判断是否主动邀请访客
+func checkInviteRules(visitor models.Visitor, visit pageVisit) {
+	//正在对话的访客不打扰
+	if models.CountMessage("visitor_id = ? and mes_type = ? and created_at > ?", visitor.VisitorId, "visitor", time.Now().Add(-pageVisitExpire)) > 0 {
+		return
+	}
+	returning := time.Since(visitor.CreatedAt) > pageVisitExpire
+	seconds := uint(time.Since(visit.PageTime).Seconds())
+	for _, rule := range models.FindEnabledInviteRules(visitor.ToId) {
+		if seconds < rule.MinSeconds || visit.Pages < rule.MinPages {
+			continue
+		}
+		if (rule.Returning == 1 && !returning) || (rule.Returning == 2 && returning) {
+			continue
+		}
+		if !tools.MatchUrlPattern(rule.UrlPattern, visit.Url) {
+			continue
+		}
+		if !pageVisits.markInvited(visitor.VisitorId, rule.ID) {
+			continue
+		}
+		fromKefu := models.FindUser(rule.FromKefu)
+		if fromKefu.ID == 0 {
+			fromKefu = models.FindUser(visitor.ToId)
+		}
+		if ws.VisitorInvite(visitor.VisitorId, rule.Content, visitor.ToId, fromKefu) {
+			models.CreateInviteLog(rule.ID, visitor.VisitorId, visitor.ToId)
+		}
+		return
+	}
+}
+func GetInviteRules(c *gin.Context) {
+	kefuName, _ := c.Get("kefu_name")
+	c.JSON(200, gin.H{
+		"code": 200,
+		"msg":  "ok",
+		"result": gin.H{
+			"list":       models.FindInviteRulesByUserId(kefuName),
+			"statistics": models.SumInvitesGroupByRule(kefuName.(string)),
+		},
+	})
+}
+func PostInviteRule(c *gin.Context) {
+	kefuName, _ := c.Get("kefu_name")
+	id, _ := strconv.Atoi(c.PostForm("id"))
+	minSeconds, _ := strconv.Atoi(c.PostForm("min_seconds"))
+	minPages, _ := strconv.Atoi(c.PostForm("min_pages"))
+	returning, _ := strconv.Atoi(c.PostForm("returning"))
+	enabled, _ := strconv.Atoi(c.DefaultPostForm("enabled", "1"))
+	rule := &models.InviteRule{
+		ID:         uint(id),
+		UserId:     kefuName.(string),
+		Name:       c.PostForm("name"),
+		UrlPattern: c.PostForm("url_pattern"),
+		FromKefu:   c.PostForm("from_kefu"),
+		Content:    c.PostForm("content"),
+	}
+	if rule.Name == "" || rule.Content == "" || minSeconds < 0 || minPages < 0 || returning < 0 || returning > 2 {
+		c.JSON(200, gin.H{
+			"code": 400,
+			"msg":  "参数不正确",
+		})
+		return
+	}
+	if rule.FromKefu != "" && models.FindUser(rule.FromKefu).ID == 0 {
+		c.JSON(200, gin.H{
+			"code": 400,
+			"msg":  "客服不存在",
+		})
+		return
+	}
+	rule.MinSeconds = uint(minSeconds)
+	rule.MinPages = uint(minPages)
+	rule.Returning = uint(returning)
+	if enabled > 0 {
+		rule.Enabled = 1
+	}
+	models.SaveInviteRule(rule)
+	c.JSON(200, gin.H{
+		"code":   200,
+		"msg":    "ok",
+		"result": rule,
+	})
+}
+func DelInviteRule(c *gin.Context) {
+	kefuName, _ := c.Get("kefu_name")
+	models.DeleteInviteRule(kefuName, c.Query("id"))
+	c.JSON(200, gin.H{
+		"code": 200,
+		"msg":  "ok",
+	})
+}
@@ -4,35 +4,149 @@ import (
 	"github.com/gin-gonic/gin"
 	"goflylivechat/common"
 	"goflylivechat/models"
+	"goflylivechat/tools"
+	"net"
 	"strconv"
+	"strings"
+	"time"
 )
 
+const (
+	// 网段封禁的最短掩码, 防止误封大量访客
+	minIpv4BlackBits = 8
+	minIpv6BlackBits = 16
+	maxIpblackDays   = 3650
+)
+
+// hasPermission 当前客服的角色是否拥有某项权限
+func hasPermission(c *gin.Context, perm string) bool {
+	roleId, _ := c.Get("role_id")
+	return roleId != nil && common.HasPermission(models.FindRolePermissions(roleId), perm)
+}
+
+// PostIpblack 添加黑名单
+// type: ip 按IP或网段, visitor 按访客ID, fingerprint 按访客设备指纹
+// scope: global 全局生效, 需要查看全部黑名单的权限; kefu 只对自己的访客生效
 func PostIpblack(c *gin.Context) {
-	ip := c.PostForm("ip")
-	if ip == "" {
+	kefuName, _ := c.Get("kefu_name")
+	black := models.Ipblack{
+		KefuId: kefuName.(string),
+		Reason: strings.TrimSpace(c.PostForm("reason")),
+	}
+	switch c.DefaultPostForm("type", "ip") {
+	case "ip":
+		ip, bits, err := tools.ParseIpPrefix(c.PostForm("ip"))
+		if err != nil {
+			c.JSON(200, gin.H{
+				"code": 400,
+				"msg":  "请输入正确的IP或网段!",
+			})
+			return
+		}
+		if (len(ip) == net.IPv4len && bits < minIpv4BlackBits) || (len(ip) == net.IPv6len && bits < minIpv6BlackBits) {
+			c.JSON(200, gin.H{
+				"code": 400,
+				"msg":  "网段范围过大!",
+			})
+			return
+		}
+		black.IP, _ = tools.NormalizeIpPrefix(c.PostForm("ip"))
+	case "visitor":
+		black.VisitorId = c.PostForm("visitor_id")
+	case "fingerprint":
+		black.Fingerprint = c.PostForm("fingerprint")
+		if black.Fingerprint == "" && c.PostForm("visitor_id") != "" {
+			black.Fingerprint = models.FindVisitorAttr(c.PostForm("visitor_id"), "fingerprint").AttrValue
+		}
+	}
+	if black.IP == "" && black.VisitorId == "" && black.Fingerprint == "" {
 		c.JSON(200, gin.H{
 			"code": 400,
-			"msg":  "请输入IP!",
+			"msg":  "请输入IP、访客或设备指纹!",
 		})
 		return
 	}
-	kefuId, _ := c.Get("kefu_name")
-	models.CreateIpblack(ip, kefuId.(string))
+
+	global := hasPermission(c, common.PermIpblackAll)
+	switch c.PostForm("scope") {
+	case "global":
+		if !global {
+			c.JSON(200, gin.H{
+				"code": 403,
+				"msg":  "没有添加全局黑名单的权限!",
+			})
+			return
+		}
+	case "kefu":
+		black.ToId = black.KefuId
+	default:
+		if !global {
+			black.ToId = black.KefuId
+		}
+	}
+
+	minutes, _ := strconv.Atoi(c.DefaultPostForm("minutes", "0"))
+	if minutes < 0 || minutes > maxIpblackDays*24*60 {
+		c.JSON(200, gin.H{
+			"code": 400,
+			"msg":  "封禁时长不正确!",
+		})
+		return
+	}
+	if minutes > 0 {
+		expireAt := time.Now().Add(time.Duration(minutes) * time.Minute)
+		black.ExpireAt = &expireAt
+	}
+	black.ID = models.CreateIpblack(black)
+	saveAudit(c, AuditIpblackCreate, black.IP+black.VisitorId+black.Fingerprint, nil, black)
 	c.JSON(200, gin.H{
 		"code": 200,
 		"msg":  "添加黑名单成功!",
 	})
 }
+
+// DelIpblack 删除黑名单, 没有查看全部黑名单权限时只能删除自己添加的
 func DelIpblack(c *gin.Context) {
+	id := c.Query("id")
 	ip := c.Query("ip")
-	if ip == "" {
+	if id == "" && ip == "" {
 		c.JSON(200, gin.H{
 			"code": 400,
 			"msg":  "请输入IP!",
 		})
 		return
 	}
-	models.DeleteIpblackByIp(ip)
+	kefuName, _ := c.Get("kefu_name")
+	global := hasPermission(c, common.PermIpblackAll)
+	if id == "" {
+		// 按IP删除时只删除自己添加的, 管理员和其他客服对同一IP的封禁不受影响
+		owner := kefuName.(string)
+		if global {
+			owner = ""
+		}
+		blacks := models.FindIpblacksByIp(ip, owner)
+		models.DeleteIpblackByIp(ip, owner)
+		for _, black := range blacks {
+			saveAudit(c, AuditIpblackDelete, black.IP+black.VisitorId+black.Fingerprint, black, nil)
+		}
+		c.JSON(200, gin.H{
+			"code": 200,
+			"msg":  "删除黑名单成功!",
+		})
+		return
+	}
+	black := models.FindIpblackById(id)
+	if black.ID != 0 && black.KefuId != kefuName && !global {
+		c.JSON(200, gin.H{
+			"code": 403,
+			"msg":  "只能删除自己添加的黑名单!",
+		})
+		return
+	}
+	models.DeleteIpblackById(id)
+	if black.ID != 0 {
+		saveAudit(c, AuditIpblackDelete, black.IP+black.VisitorId+black.Fingerprint, black, nil)
+	}
 	c.JSON(200, gin.H{
 		"code": 200,
 		"msg":  "删除黑名单成功!",
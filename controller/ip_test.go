@@ -0,0 +1,40 @@
+package controller
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gin-gonic/gin"
+	"goflylivechat/models"
+	"goflylivechat/models/dbtest"
+)
+
+// TestDelIpblackByIpOwnRows 按IP删除时只删除自己添加的封禁, 管理员对同一IP的全局封禁保留
+func TestDelIpblackByIpOwnRows(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	mock := dbtest.Mock(t, &models.DB)
+	mock.ExpectQuery("SELECT permission FROM `role_permission`").WithArgs(2).
+		WillReturnRows(sqlmock.NewRows([]string{"permission"}).AddRow("ipblack"))
+	mock.ExpectQuery("SELECT \\* FROM `ipblack` WHERE \\(ip = \\?\\) AND \\(kefu_id = \\?\\)").WithArgs("1.2.3.4", "kefu1").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "ip", "kefu_id"}).AddRow(5, "1.2.3.4", "kefu1"))
+	mock.ExpectBegin()
+	mock.ExpectExec("DELETE FROM `ipblack` WHERE \\(ip = \\?\\) AND \\(kefu_id = \\?\\)").WithArgs("1.2.3.4", "kefu1").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	mock.ExpectQuery("SELECT \\* FROM `ipblack` WHERE \\(expire_at IS NULL").WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	mock.ExpectBegin()
+	mock.ExpectExec("INSERT INTO `audit`").WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodDelete, "/ipblack?ip=1.2.3.4", nil)
+	c.Set("kefu_name", "kefu1")
+	c.Set("role_id", 2)
+	DelIpblack(c)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", w.Code, w.Body.String())
+	}
+}
@@ -6,7 +6,10 @@ import (
 	"goflylivechat/models"
 	"goflylivechat/tools"
 	"goflylivechat/ws"
+	"log"
 	"net/http"
+	"strconv"
+	"time"
 )
 
 func PostKefuAvator(c *gin.Context) {
@@ -21,6 +24,14 @@ func PostKefuAvator(c *gin.Context) {
 		return
 	}
 	kefuName, _ := c.Get("kefu_name")
+	if err := checkAvatar(kefuName.(string), avator); err != nil {
+		c.JSON(200, gin.H{
+			"code":   400,
+			"msg":    err.Error(),
+			"result": "",
+		})
+		return
+	}
 	models.UpdateUserAvator(kefuName.(string), avator)
 	c.JSON(200, gin.H{
 		"code":   200,
@@ -42,7 +53,7 @@ func PostKefuPass(c *gin.Context) {
 		return
 	}
 	user := models.FindUser(kefuName.(string))
-	if user.Password != tools.Md5(old_pass) {
+	if ok, _ := tools.VerifyPassword(user.Password, old_pass); !ok {
 		c.JSON(200, gin.H{
 			"code":   400,
 			"msg":    "旧密码不正确",
@@ -50,7 +61,31 @@ func PostKefuPass(c *gin.Context) {
 		})
 		return
 	}
-	models.UpdateUserPass(kefuName.(string), tools.Md5(newPass))
+	if err := tools.CheckPasswordPolicy(newPass); err != nil {
+		c.JSON(200, gin.H{
+			"code":   400,
+			"msg":    err.Error(),
+			"result": "",
+		})
+		return
+	}
+	hash, err := tools.HashPassword(newPass)
+	if err != nil {
+		c.JSON(200, gin.H{
+			"code":   500,
+			"msg":    err.Error(),
+			"result": "",
+		})
+		return
+	}
+	if err := models.UpdateUserPass(kefuName.(string), hash); err != nil {
+		c.JSON(200, gin.H{
+			"code":   500,
+			"msg":    err.Error(),
+			"result": "",
+		})
+		return
+	}
 	c.JSON(200, gin.H{
 		"code":   200,
 		"msg":    "ok",
@@ -141,6 +176,7 @@ func PostTransKefu(c *gin.Context) {
 	}
 	models.UpdateVisitorKefu(visitorId, kefuId)
 	ws.UpdateVisitorUser(visitorId, kefuId)
+	saveAudit(c, AuditVisitorTransfer, visitorId, visitor.ToId, kefuId)
 	go ws.VisitorOnline(kefuId, visitor)
 	go ws.VisitorOffline(curKefuId.(string), visitor.VisitorId, visitor.Name)
 	go ws.VisitorNotice(visitor.VisitorId, "客服转接到"+user.Nickname)
@@ -176,6 +212,49 @@ func PostKefuRegister(c *gin.Context) {
 		return
 	}
 
+	// 注册模式: 关闭 / 仅邀请 / 开放, 带邀请链接时任何模式都按邀请注册
+	var invite models.RegisterInvite
+	inviteToken := c.PostForm("invite")
+	mode := common.GetSecurity().RegisterMode
+	if inviteToken != "" && mode != common.RegisterDisabled {
+		var ok bool
+		if invite, ok = checkRegisterInvite(inviteToken); !ok {
+			c.JSON(http.StatusOK, gin.H{
+				"code":   403,
+				"msg":    "The invitation link is invalid or has expired",
+				"result": nil,
+			})
+			return
+		}
+	} else if mode != common.RegisterOpen {
+		c.JSON(http.StatusOK, gin.H{
+			"code":   403,
+			"msg":    "Registration is closed",
+			"result": nil,
+		})
+		return
+	}
+
+	if common.GetSecurity().RegisterCaptcha && !verifyCaptcha(c) {
+		c.JSON(http.StatusOK, gin.H{
+			"code": 428,
+			"msg":  "Please enter the captcha",
+			"result": gin.H{
+				"captcha": true,
+			},
+		})
+		return
+	}
+
+	if err := tools.CheckPasswordPolicy(password); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"code":   400,
+			"msg":    err.Error(),
+			"result": nil,
+		})
+		return
+	}
+
 	existingUser := models.FindUser(name)
 	if existingUser.Name != "" {
 		c.JSON(http.StatusOK, gin.H{
@@ -186,8 +265,33 @@ func PostKefuRegister(c *gin.Context) {
 		return
 	}
 
-	userID := models.CreateUser(name, tools.Md5(password), avatar, nickname)
+	hash, err := tools.HashPassword(password)
+	if err == nil {
+		err = models.CheckPasswordColumn(hash)
+	}
+	if err != nil {
+		log.Println("register:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code":   500,
+			"msg":    "Registration Failed",
+			"result": nil,
+		})
+		return
+	}
+	// 先占用邀请, 避免同一链接被并发注册多次
+	if invite.ID != 0 && !models.UseRegisterInvite(invite.Jti, name) {
+		c.JSON(http.StatusOK, gin.H{
+			"code":   403,
+			"msg":    "The invitation link is invalid or has expired",
+			"result": nil,
+		})
+		return
+	}
+	userID := models.CreateUser(name, hash, avatar, nickname)
 	if userID == 0 {
+		if invite.ID != 0 {
+			models.ReleaseRegisterInvite(invite.Jti)
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"code":   500,
 			"msg":    "Registration Failed",
@@ -195,12 +299,22 @@ func PostKefuRegister(c *gin.Context) {
 		})
 		return
 	}
+	roleId := uint(common.DefaultKefuRole)
+	if invite.ID != 0 {
+		roleId = invite.RoleId
+		models.UpdateUserEmail(name, invite.Email)
+		if err := sendVerifyEmail(models.FindUser(name)); err != nil {
+			log.Println("send verify email:", err)
+		}
+	}
+	models.CreateUserRole(userID, roleId)
 
 	c.JSON(http.StatusOK, gin.H{
 		"code": 200,
 		"msg":  "Registration successful",
 		"result": gin.H{
-			"user_id": userID,
+			"user_id":      userID,
+			"verify_email": invite.Email,
 		},
 	})
 }
@@ -210,7 +324,25 @@ func PostKefuInfo(c *gin.Context) {
 	avator := c.PostForm("avator")
 	nickname := c.PostForm("nickname")
 	if password != "" {
-		password = tools.Md5(password)
+		if err := tools.CheckPasswordPolicy(password); err != nil {
+			c.JSON(200, gin.H{
+				"code": 400,
+				"msg":  err.Error(),
+			})
+			return
+		}
+		hash, err := tools.HashPassword(password)
+		if err == nil {
+			err = models.CheckPasswordColumn(hash)
+		}
+		if err != nil {
+			c.JSON(200, gin.H{
+				"code": 500,
+				"msg":  err.Error(),
+			})
+			return
+		}
+		password = hash
 	}
 	if name == "" {
 		c.JSON(200, gin.H{
@@ -219,6 +351,16 @@ func PostKefuInfo(c *gin.Context) {
 		})
 		return
 	}
+	// 未修改的头像不再校验, 兼容之前上传的头像
+	if avator != "" && avator != models.FindUser(name.(string)).Avator {
+		if err := checkAvatar(name.(string), avator); err != nil {
+			c.JSON(200, gin.H{
+				"code": 400,
+				"msg":  err.Error(),
+			})
+			return
+		}
+	}
 	models.UpdateUser(name.(string), password, avator, nickname)
 
 	c.JSON(200, gin.H{
@@ -237,6 +379,24 @@ func GetKefuList(c *gin.Context) {
 }
 func DeleteKefuInfo(c *gin.Context) {
 	kefuId := c.Query("id")
+	curId, _ := c.Get("kefu_id")
+	if id, ok := curId.(float64); ok && strconv.Itoa(int(id)) == kefuId {
+		c.JSON(200, gin.H{
+			"code": 400,
+			"msg":  "不能删除自己",
+		})
+		return
+	}
+	//被删除客服已签发的令牌立即失效
+	if user := models.FindUserByUid(kefuId); user.ID != 0 {
+		models.RevokeUserTokens(user.Name, time.Now().Add(common.RefreshTokenExpire()))
+		saveAudit(c, AuditKefuDelete, user.Name, gin.H{
+			"id":       user.ID,
+			"name":     user.Name,
+			"nickname": user.Nickname,
+			"email":    user.Email,
+		}, nil)
+	}
 	models.DeleteUserById(kefuId)
 	models.DeleteRoleByUserId(kefuId)
 	c.JSON(200, gin.H{
@@ -2,8 +2,10 @@ package controller
 
 import (
 	"github.com/gin-gonic/gin"
+	"goflylivechat/common"
 	"goflylivechat/models"
 	"goflylivechat/tools"
+	"log"
 	"time"
 )
 
@@ -22,10 +24,35 @@ import (
 func LoginCheckPass(c *gin.Context) {
 	password := c.PostForm("password")
 	username := c.PostForm("username")
+	ip := c.ClientIP()
+
+	// Too many failures for this account or address
+	if wait := loginRetryAfter(username, ip); wait > 0 {
+		c.JSON(200, gin.H{
+			"code":    429,
+			"message": "Too many failed attempts, please try again later",
+			"result": gin.H{
+				"retry_after": retryAfterSeconds(wait),
+			},
+		})
+		return
+	}
+	if needLoginCaptcha(username, ip) && !verifyCaptcha(c) {
+		c.JSON(200, gin.H{
+			"code":    428,
+			"message": "Please enter the captcha",
+			"result": gin.H{
+				"captcha": true,
+			},
+		})
+		return
+	}
 	info := models.FindUser(username)
 
 	// Authentication failed case
-	if info.Name == "" || info.Password != tools.Md5(password) {
+	ok, rehash := tools.VerifyPassword(info.Password, password)
+	if info.Name == "" || !ok {
+		models.CreateLoginAttempt(username, ip, false, "password")
 		c.JSON(200, gin.H{
 			"code":    401,
 			"message": "Incorrect username or password", // User-friendly message
@@ -33,15 +60,40 @@ func LoginCheckPass(c *gin.Context) {
 		return
 	}
 
-	// Prepare user session data
-	userinfo := map[string]interface{}{
-		"kefu_name":   info.Name,
-		"kefu_id":     info.ID,
-		"create_time": time.Now().Unix(),
+	// Invited agents must verify their email address first
+	if info.EmailUnverified() {
+		c.JSON(200, gin.H{
+			"code":    403,
+			"message": verifyEmailPending(c, info),
+		})
+		return
+	}
+
+	// Upgrade legacy md5 or outdated hashes now that we know the plain password
+	if rehash {
+		rehashPassword(info.Name, password)
+	}
+
+	// Agents with two-factor authentication get a short-lived mfa token instead
+	mfa, err := loginTotpStep(info)
+	if err != nil {
+		c.JSON(200, gin.H{
+			"code":    500,
+			"message": "Login temporarily unavailable",
+		})
+		return
+	}
+	if mfa != nil {
+		c.JSON(200, gin.H{
+			"code":    202,
+			"message": "Two-factor authentication required",
+			"result":  mfa,
+		})
+		return
 	}
 
 	// Token generation
-	token, err := tools.MakeToken(userinfo)
+	tokens, err := makeLoginTokens(info)
 	if err != nil {
 		c.JSON(200, gin.H{
 			"code":    500,
@@ -49,14 +101,116 @@ func LoginCheckPass(c *gin.Context) {
 		})
 		return
 	}
+	models.CreateLoginAttempt(username, ip, true, "")
 
 	// Successful response
 	c.JSON(200, gin.H{
 		"code":    200,
 		"message": "Login successful",
-		"result": gin.H{
-			"token":      token,
-			"created_at": userinfo["create_time"],
-		},
+		"result":  tokens,
+	})
+}
+
+// makeLoginTokens issues a short-lived access token and a long-lived refresh token
+func makeLoginTokens(info models.User) (gin.H, error) {
+	// Role is carried in the token so RbacAuth needs no extra lookup
+	roleId := models.FindRoleByUserId(info.ID).RoleId
+	if roleId == 0 {
+		roleId = common.DefaultKefuRole
+	}
+	userinfo := map[string]interface{}{
+		"kefu_name": info.Name,
+		"kefu_id":   info.ID,
+		"role_id":   roleId,
+	}
+	token, err := tools.MakeToken(userinfo, tools.TokenAccess, common.AccessTokenExpire())
+	if err != nil {
+		return nil, err
+	}
+	refreshToken, err := tools.MakeToken(map[string]interface{}{
+		"kefu_name": info.Name,
+	}, tools.TokenRefresh, common.RefreshTokenExpire())
+	if err != nil {
+		return nil, err
+	}
+	return gin.H{
+		"token":         token,
+		"refresh_token": refreshToken,
+		"expires_in":    int64(common.AccessTokenExpire().Seconds()),
+		"created_at":    time.Now().Unix(),
+	}, nil
+}
+
+// PostTokenRefresh exchanges a refresh token for a new token pair, the old refresh token is revoked
+func PostTokenRefresh(c *gin.Context) {
+	claims := tools.ParseToken(c.PostForm("refresh_token"), tools.TokenRefresh)
+	if claims == nil || isClaimsRevoked(claims) {
+		c.JSON(200, gin.H{
+			"code": 401,
+			"msg":  "token失效",
+		})
+		return
+	}
+	kefuName, _ := claims["kefu_name"].(string)
+	info := models.FindUser(kefuName)
+	if info.ID == 0 {
+		c.JSON(200, gin.H{
+			"code": 401,
+			"msg":  "token失效",
+		})
+		return
+	}
+	revokeClaims(claims)
+	tokens, err := makeLoginTokens(info)
+	if err != nil {
+		c.JSON(200, gin.H{
+			"code": 500,
+			"msg":  err.Error(),
+		})
+		return
+	}
+	c.JSON(200, gin.H{
+		"code":   200,
+		"msg":    "ok",
+		"result": tokens,
+	})
+}
+
+// PostLogout revokes the current access token and the refresh token if given
+func PostLogout(c *gin.Context) {
+	kefuName, _ := c.Get("kefu_name")
+	jti, _ := c.Get("jti")
+	exp, _ := c.Get("token_exp")
+	models.RevokeToken(jti.(string), kefuName.(string), exp.(time.Time))
+	if claims := tools.ParseToken(c.PostForm("refresh_token"), tools.TokenRefresh); claims != nil && claims["kefu_name"] == kefuName {
+		revokeClaims(claims)
+	}
+	c.JSON(200, gin.H{
+		"code": 200,
+		"msg":  "ok",
 	})
 }
+func isClaimsRevoked(claims map[string]interface{}) bool {
+	jti, _ := claims["jti"].(string)
+	kefuName, _ := claims["kefu_name"].(string)
+	return models.IsTokenRevoked(jti, kefuName, tools.TokenIssuedAt(claims))
+}
+func revokeClaims(claims map[string]interface{}) {
+	jti, _ := claims["jti"].(string)
+	kefuName, _ := claims["kefu_name"].(string)
+	exp, _ := claims["exp"].(float64)
+	models.RevokeToken(jti, kefuName, time.Unix(int64(exp), 0))
+}
+
+// rehashPassword stores a bcrypt hash for the verified password.
+// The old hash is kept when the password column is still too short to hold it.
+func rehashPassword(name, password string) {
+	hash, err := tools.HashPassword(password)
+	if err != nil {
+		log.Printf("rehash password of %s: %s", name, err)
+		return
+	}
+	if err := models.UpdateUserPass(name, hash); err != nil {
+		log.Printf("rehash password of %s: %s", name, err)
+	}
+}
@@ -0,0 +1,105 @@
+package controller
+
+import (
+	"github.com/dchest/captcha"
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-gonic/gin"
+	"goflylivechat/common"
+	"goflylivechat/models"
+	"goflylivechat/tools"
+	"math"
+	"strconv"
+	"time"
+)
+
+// 同一IP允许的失败次数是单个账号的倍数, 避免办公网络共用出口IP时被误锁
+const ipFailuresFactor = 4
+
+// loginRetryAfter 按账号和IP的失败次数计算还需等待多久才能再次尝试
+func loginRetryAfter(username, ip string) time.Duration {
+	sec := common.GetSecurity()
+	now := time.Now()
+	since := now.Add(-sec.LockoutWindow())
+	var wait time.Duration
+	for _, f := range []struct {
+		failures models.LoginFailures
+		max      int
+	}{
+		{models.CountUserLoginFailures(username, since), sec.MaxLoginFailures},
+		{models.CountIpLoginFailures(ip, since), sec.MaxLoginFailures * ipFailuresFactor},
+	} {
+		if f.failures.Num == 0 || f.failures.Last == nil {
+			continue
+		}
+		if w := tools.LoginRetryAfter(f.failures.Num, f.max, *f.failures.Last, sec.LockoutWindow(), now); w > wait {
+			wait = w
+		}
+	}
+	return wait
+}
+
+// needLoginCaptcha 是否需要校验登录验证码
+func needLoginCaptcha(username, ip string) bool {
+	switch common.GetSecurity().LoginCaptcha {
+	case common.CaptchaAlways:
+		return true
+	case common.CaptchaFailed:
+		since := time.Now().Add(-common.GetSecurity().LockoutWindow())
+		return models.CountUserLoginFailures(username, since).Num > 0 || models.CountIpLoginFailures(ip, since).Num > 0
+	}
+	return false
+}
+
+// verifyCaptcha 校验提交的captcha_id或GetCaptcha写入会话的验证码, 验证码只能使用一次
+func verifyCaptcha(c *gin.Context) bool {
+	if id := c.PostForm("captcha_id"); id != "" {
+		return captcha.VerifyString(id, c.PostForm("captcha"))
+	}
+	session := sessions.Default(c)
+	id, _ := session.Get("captcha").(string)
+	if id == "" {
+		return false
+	}
+	session.Delete("captcha")
+	_ = session.Save()
+	return captcha.VerifyString(id, c.PostForm("captcha"))
+}
+func retryAfterSeconds(wait time.Duration) int {
+	return int(math.Ceil(wait.Seconds()))
+}
+
+// GetLoginAttempts 登录失败审计记录
+func GetLoginAttempts(c *gin.Context) {
+	username := c.Query("username")
+	success := c.DefaultQuery("success", "0")
+	page, _ := strconv.Atoi(c.Query("page"))
+	if page == 0 {
+		page = 1
+	}
+	c.JSON(200, gin.H{
+		"code": 200,
+		"msg":  "ok",
+		"result": gin.H{
+			"list":     models.FindLoginAttempts(username, success, uint(page), common.PageSize),
+			"count":    models.CountLoginAttempts(username, success),
+			"pagesize": common.PageSize,
+		},
+	})
+}
+
+// PostLoginUnlock 管理员解除账号锁定
+func PostLoginUnlock(c *gin.Context) {
+	username := c.PostForm("username")
+	if models.FindUser(username).ID == 0 {
+		c.JSON(200, gin.H{
+			"code": 400,
+			"msg":  "客服不存在",
+		})
+		return
+	}
+	models.CreateLoginAttempt(username, c.ClientIP(), true, "unlock")
+	c.JSON(200, gin.H{
+		"code": 200,
+		"msg":  "ok",
+	})
+}
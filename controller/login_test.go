@@ -0,0 +1,152 @@
+package controller
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/dchest/captcha"
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-contrib/sessions/cookie"
+	"github.com/gin-gonic/gin"
+	"goflylivechat/models"
+	"goflylivechat/models/dbtest"
+	"goflylivechat/tools"
+)
+
+type loginResponse struct {
+	Code   int             `json:"code"`
+	Result json.RawMessage `json:"result"`
+}
+
+func postLogin(t *testing.T, engine *gin.Engine, form url.Values) loginResponse {
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/check", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	engine.ServeHTTP(w, req)
+	var resp loginResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("%s: %s", err, w.Body.String())
+	}
+	return resp
+}
+
+// expectLoginFailures 按账号和IP统计失败次数, checkIp为false时只查询账号
+func expectLoginFailures(mock sqlmock.Sqlmock, num int, checkIp bool) {
+	var last interface{}
+	if num > 0 {
+		last = time.Now().Add(-time.Minute)
+	}
+	mock.ExpectQuery("SELECT \\* FROM `login_attempt` WHERE \\(username = \\? and success = 1").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	mock.ExpectQuery("FROM `login_attempt` WHERE \\(username = \\? and success = 0").
+		WillReturnRows(sqlmock.NewRows([]string{"num", "last"}).AddRow(num, last))
+	if checkIp {
+		mock.ExpectQuery("FROM `login_attempt` WHERE \\(ip = \\? and success = 0").
+			WillReturnRows(sqlmock.NewRows([]string{"num", "last"}).AddRow(num, last))
+	}
+}
+
+// newCaptcha 获取验证码ID, 从验证码存储中读出答案
+func newCaptcha(t *testing.T, engine *gin.Engine, store captcha.Store) (string, string) {
+	w := httptest.NewRecorder()
+	engine.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/captcha_id", nil))
+	var resp struct {
+		Result struct {
+			CaptchaId string `json:"captcha_id"`
+		} `json:"result"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || resp.Result.CaptchaId == "" {
+		t.Fatalf("captcha_id: %v %s", err, w.Body.String())
+	}
+	digits := store.Get(resp.Result.CaptchaId, false)
+	answer := make([]byte, len(digits))
+	for i, d := range digits {
+		answer[i] = '0' + d
+	}
+	return resp.Result.CaptchaId, string(answer)
+}
+
+func expectLoginAttempt(mock sqlmock.Sqlmock) {
+	mock.ExpectBegin()
+	mock.ExpectExec("INSERT INTO `login_attempt`").WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+}
+
+// TestLoginCaptchaAfterFailure 密码错误后需要验证码, 通过captcha_id提交的验证码不依赖会话cookie
+func TestLoginCaptchaAfterFailure(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	store := captcha.NewMemoryStore(captcha.CollectNum, captcha.Expiration)
+	captcha.SetCustomStore(store)
+	key := tools.RandomJwtKey()
+	if err := tools.SetJwtKeys([]tools.JwtKey{key}, key.Kid); err != nil {
+		t.Fatal(err)
+	}
+	hash, err := tools.HashPassword("right-password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	mock := dbtest.Mock(t, &models.DB)
+	engine := gin.New()
+	engine.Use(sessions.Sessions("GOFLY", cookie.NewStore([]byte("test"))))
+	engine.POST("/check", LoginCheckPass)
+	engine.GET("/captcha_id", GetCaptchaId)
+	userRow := func() *sqlmock.Rows {
+		return sqlmock.NewRows([]string{"id", "name", "password"}).AddRow(1, "agent", hash)
+	}
+
+	// 第一次密码错误
+	expectLoginFailures(mock, 0, true)
+	expectLoginFailures(mock, 0, true)
+	mock.ExpectQuery("SELECT \\* FROM `user`").WillReturnRows(userRow())
+	expectLoginAttempt(mock)
+	resp := postLogin(t, engine, url.Values{"username": {"agent"}, "password": {"wrong"}})
+	if resp.Code != 401 {
+		t.Fatalf("wrong password: code %d, want 401", resp.Code)
+	}
+
+	// 之后没有验证码时要求输入验证码
+	expectLoginFailures(mock, 1, true)
+	expectLoginFailures(mock, 1, false)
+	resp = postLogin(t, engine, url.Values{"username": {"agent"}, "password": {"right-password"}})
+	if resp.Code != 428 {
+		t.Fatalf("without captcha: code %d, want 428", resp.Code)
+	}
+
+	id, _ := newCaptcha(t, engine, store)
+
+	// 验证码错误
+	expectLoginFailures(mock, 1, true)
+	expectLoginFailures(mock, 1, false)
+	resp = postLogin(t, engine, url.Values{"username": {"agent"}, "password": {"right-password"}, "captcha_id": {id}, "captcha": {"x"}})
+	if resp.Code != 428 {
+		t.Fatalf("wrong captcha: code %d, want 428", resp.Code)
+	}
+
+	// 验证码只能使用一次, 错误后需要重新获取
+	id, answer := newCaptcha(t, engine, store)
+
+	// 验证码和密码都正确时登录成功
+	expectLoginFailures(mock, 1, true)
+	expectLoginFailures(mock, 1, false)
+	mock.ExpectQuery("SELECT \\* FROM `user`").WillReturnRows(userRow())
+	mock.ExpectQuery("SELECT \\* FROM `user_totp`").WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	mock.ExpectQuery("SELECT \\* FROM `config`").WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	mock.ExpectQuery("SELECT \\* FROM `user_role`").WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	expectLoginAttempt(mock)
+	resp = postLogin(t, engine, url.Values{"username": {"agent"}, "password": {"right-password"}, "captcha_id": {id}, "captcha": {answer}})
+	if resp.Code != 200 {
+		t.Fatalf("with captcha: code %d, want 200: %s", resp.Code, resp.Result)
+	}
+	var tokens struct {
+		Token string `json:"token"`
+	}
+	if err := json.Unmarshal(resp.Result, &tokens); err != nil || tokens.Token == "" {
+		t.Fatalf("login result has no token: %s", resp.Result)
+	}
+}
@@ -24,6 +24,13 @@ func PostInstall(c *gin.Context) {
 		})
 		return
 	}
+	if !common.CheckSetupToken(c.PostForm("setup_token")) {
+		c.JSON(200, gin.H{
+			"code": 403,
+			"msg":  "安装令牌不正确,请运行 gochat install --web 或查看服务启动日志获取",
+		})
+		return
+	}
 	server := c.PostForm("server")
 	port := c.PostForm("port")
 	database := c.PostForm("database")
@@ -58,8 +65,6 @@ func PostInstall(c *gin.Context) {
 	data := fmt.Sprintf(format, server, port, database, username, password)
 	file.WriteString(data)
 	models.Connect()
-	installFile, _ := os.OpenFile("./install.lock", os.O_RDWR|os.O_CREATE, os.ModePerm)
-	installFile.WriteString("gofly live chat")
 	ok, err := install()
 	if !ok {
 		c.JSON(200, gin.H{
@@ -68,6 +73,11 @@ func PostInstall(c *gin.Context) {
 		})
 		return
 	}
+	//安装成功后才写入安装锁并删除令牌, 失败时可以用同一个令牌重试
+	installFile, _ := os.OpenFile("./install.lock", os.O_RDWR|os.O_CREATE, os.ModePerm)
+	installFile.WriteString("gofly live chat")
+	installFile.Close()
+	common.RemoveSetupToken()
 	c.JSON(200, gin.H{
 		"code": 200,
 		"msg":  "安装成功",
@@ -87,11 +97,11 @@ func install() (bool, error) {
 			continue
 		}
 		err := models.Execute(sql)
-		if err == nil {
-			log.Println(sql, "\t success!")
-		} else {
+		if err != nil {
 			log.Println(sql, err, "\t failed!")
+			return false, err
 		}
+		log.Println(sql, "\t success!")
 	}
 	return true, nil
 }
@@ -101,13 +111,18 @@ func GetStatistics(c *gin.Context) {
 	message := models.CountMessage(nil, nil)
 	session := len(ws.ClientList)
 	kefuNum := 0
+	start, end := parsePeriod(c.Query("start"), c.Query("end"))
+	kefuName, _ := c.Get("kefu_name")
 	c.JSON(200, gin.H{
 		"code": 200,
 		"msg":  "ok",
 		"result": gin.H{
-			"visitors": visitors,
-			"message":  message,
-			"session":  session + kefuNum,
+			"visitors":  visitors,
+			"message":   message,
+			"session":   session + kefuNum,
+			"csat":      models.SumRates("", start, end),
+			"kefu_csat": models.SumRates(kefuName.(string), start, end),
+			"invites":   models.SumInvites(kefuName.(string)),
 		},
 	})
 }
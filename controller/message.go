@@ -2,17 +2,13 @@ package controller
 
 import (
 	"encoding/json"
-	"fmt"
 	"github.com/gin-gonic/gin"
 	"github.com/gorilla/websocket"
 	"goflylivechat/common"
 	"goflylivechat/models"
 	"goflylivechat/tools"
 	"goflylivechat/ws"
-	"os"
-	"path"
 	"strconv"
-	"strings"
 	"time"
 )
 
@@ -28,6 +24,11 @@ func SendMessageV2(c *gin.Context) {
 		})
 		return
 	}
+	redacted, ok := redactMessage(c, content)
+	if !ok {
+		return
+	}
+	content = redacted.Content
 	//限流
 	if !tools.LimitFreqSingle("sendmessage:"+c.ClientIP(), 1, 2) {
 		c.JSON(200, gin.H{
@@ -36,13 +37,22 @@ func SendMessageV2(c *gin.Context) {
 		})
 		return
 	}
+	//客服消息只能由客服令牌发送, 访客消息的发送者取访客令牌中的访客
 	var kefuInfo models.User
 	var vistorInfo models.Visitor
 	if cType == "kefu" {
-		kefuInfo = models.FindUser(fromId)
-		vistorInfo = models.FindVisitorByVistorId(toId)
+		kefuName := c.GetString("kefu_name")
+		if kefuName == "" || kefuName != fromId {
+			c.JSON(200, gin.H{
+				"code": 403,
+				"msg":  "没有权限",
+			})
+			return
+		}
+		kefuInfo = models.FindUser(kefuName)
+		vistorInfo = models.FindVisitorByVistorId(c.GetString("visitor_id"))
 	} else if cType == "visitor" {
-		vistorInfo = models.FindVisitorByVistorId(fromId)
+		vistorInfo = models.FindVisitorByVistorId(c.GetString("visitor_id"))
 		kefuInfo = models.FindUser(toId)
 	}
 
@@ -54,7 +64,14 @@ func SendMessageV2(c *gin.Context) {
 		return
 	}
 
-	models.CreateMessage(kefuInfo.Name, vistorInfo.VisitorId, content, cType)
+	if err := models.CreateMessage(kefuInfo.Name, vistorInfo.VisitorId, redacted.Store, cType); err != nil {
+		tools.Logger().Println("create message error:", err)
+		c.JSON(200, gin.H{
+			"code": 500,
+			"msg":  "消息保存失败",
+		})
+		return
+	}
 
 	// 动态获取基础路径
 	basePath := common.GetDynamicBasePath(c)
@@ -119,7 +136,8 @@ func SendMessageV2(c *gin.Context) {
 			go SendNoticeEmail(content+"|"+vistorInfo.Name, content)
 		}
 		go ws.VisitorAutoReply(vistorInfo, kefuInfo, content)
-		go models.UpdateVisitorLastMessage(vistorInfo.VisitorId, content)
+		go models.AcceptInvite(vistorInfo.VisitorId, pageVisitExpire)
+		go updateVisitorLastMessage(vistorInfo.VisitorId, content)
 		c.JSON(200, gin.H{
 			"code": 200,
 			"msg":  "ok",
@@ -128,6 +146,23 @@ func SendMessageV2(c *gin.Context) {
 
 }
 
+// redactMessage 打码消息中的敏感信息, 命中拒绝发送的规则时返回错误响应
+func redactMessage(c *gin.Context, content string) (tools.RedactResult, bool) {
+	redacted := tools.Redact(content)
+	if redacted.Rejected != nil {
+		label := redacted.Rejected.Label
+		if label == "" {
+			label = "敏感信息"
+		}
+		c.JSON(200, gin.H{
+			"code": 400,
+			"msg":  "消息包含" + label + ", 请勿发送",
+		})
+		return redacted, false
+	}
+	return redacted, true
+}
+
 func SendKefuMessage(c *gin.Context) {
 	fromId, _ := c.Get("kefu_name")
 	toId := c.PostForm("to_id")
@@ -140,6 +175,11 @@ func SendKefuMessage(c *gin.Context) {
 		})
 		return
 	}
+	redacted, ok := redactMessage(c, content)
+	if !ok {
+		return
+	}
+	content = redacted.Content
 	//限流
 	if !tools.LimitFreqSingle("sendmessage:"+c.ClientIP(), 1, 2) {
 		c.JSON(200, gin.H{
@@ -161,7 +201,14 @@ func SendKefuMessage(c *gin.Context) {
 		return
 	}
 
-	models.CreateMessage(kefuInfo.Name, vistorInfo.VisitorId, content, cType)
+	if err := models.CreateMessage(kefuInfo.Name, vistorInfo.VisitorId, redacted.Store, cType); err != nil {
+		tools.Logger().Println("create message error:", err)
+		c.JSON(200, gin.H{
+			"code": 500,
+			"msg":  "消息保存失败",
+		})
+		return
+	}
 
 	// 动态获取基础路径
 	basePath := common.GetDynamicBasePath(c)
@@ -174,7 +221,7 @@ func SendKefuMessage(c *gin.Context) {
 		ws.VisitorMessage(vistorInfo.VisitorId, content, kefuInfo, basePath)
 	}
 	ws.KefuMessage(vistorInfo.VisitorId, content, kefuInfo, basePath)
-	go models.UpdateVisitorLastMessage(vistorInfo.VisitorId, content)
+	go updateVisitorLastMessage(vistorInfo.VisitorId, content)
 	c.JSON(200, gin.H{
 		"code": 200,
 		"msg":  "ok",
@@ -204,7 +251,7 @@ func SendVisitorNotice(c *gin.Context) {
 	})
 }
 func SendCloseMessageV2(c *gin.Context) {
-	visitorId := c.Query("visitor_id")
+	visitorId := c.GetString("visitor_id")
 	if visitorId == "" {
 		c.JSON(200, gin.H{
 			"code": 400,
@@ -214,102 +261,31 @@ func SendCloseMessageV2(c *gin.Context) {
 	}
 
 	oldUser, ok := ws.ClientList[visitorId]
-	if oldUser != nil || ok {
+	if oldUser != nil && ok {
+		ws.VisitorRatePrompt(visitorId, oldUser.To_id)
 		msg := ws.TypeMessage{
 			Type: "force_close",
 			Data: visitorId,
 		}
 		str, _ := json.Marshal(msg)
+		oldUser.Mux.Lock()
 		err := oldUser.Conn.WriteMessage(websocket.TextMessage, str)
+		oldUser.Mux.Unlock()
 		oldUser.Conn.Close()
 		delete(ws.ClientList, visitorId)
 		tools.Logger().Println("close_message", oldUser, err)
 	}
+	//客服强制结束对话
+	if c.GetString("kefu_name") != "" {
+		saveAudit(c, AuditVisitorClose, visitorId, nil, nil)
+	}
 	c.JSON(200, gin.H{
 		"code": 200,
 		"msg":  "ok",
 	})
 }
-func UploadImg(c *gin.Context) {
-	f, err := c.FormFile("imgfile")
-	if err != nil {
-		c.JSON(200, gin.H{
-			"code": 400,
-			"msg":  "上传失败!",
-		})
-		return
-	} else {
-
-		fileExt := strings.ToLower(path.Ext(f.Filename))
-		if fileExt != ".png" && fileExt != ".jpg" && fileExt != ".gif" && fileExt != ".jpeg" {
-			c.JSON(200, gin.H{
-				"code": 400,
-				"msg":  "上传失败!只允许png,jpg,gif,jpeg文件",
-			})
-			return
-		}
-		isMainUploadExist, _ := tools.IsFileExist(common.Upload)
-		if !isMainUploadExist {
-			os.Mkdir(common.Upload, os.ModePerm)
-		}
-		fileName := tools.Md5(fmt.Sprintf("%s%s", f.Filename, time.Now().String()))
-		fildDir := fmt.Sprintf("%s%d%s/", common.Upload, time.Now().Year(), time.Now().Month().String())
-		isExist, _ := tools.IsFileExist(fildDir)
-		if !isExist {
-			os.Mkdir(fildDir, os.ModePerm)
-		}
-		filepath := fmt.Sprintf("%s%s%s", fildDir, fileName, fileExt)
-		c.SaveUploadedFile(f, filepath)
-		c.JSON(200, gin.H{
-			"code": 200,
-			"msg":  "上传成功!",
-			"result": gin.H{
-				"path": filepath,
-			},
-		})
-	}
-}
-func UploadFile(c *gin.Context) {
-	f, err := c.FormFile("realfile")
-	if err != nil {
-		c.JSON(200, gin.H{
-			"code": 400,
-			"msg":  "上传失败!",
-		})
-		return
-	} else {
-
-		fileExt := strings.ToLower(path.Ext(f.Filename))
-		if f.Size >= 90*1024*1024 {
-			c.JSON(200, gin.H{
-				"code": 400,
-				"msg":  "上传失败!不允许超过90M",
-			})
-			return
-		}
-
-		fileName := tools.Md5(fmt.Sprintf("%s%s", f.Filename, time.Now().String()))
-		fildDir := fmt.Sprintf("%s%d%s/", common.Upload, time.Now().Year(), time.Now().Month().String())
-		isExist, _ := tools.IsFileExist(fildDir)
-		if !isExist {
-			os.Mkdir(fildDir, os.ModePerm)
-		}
-		filepath := fmt.Sprintf("%s%s%s", fildDir, fileName, fileExt)
-		c.SaveUploadedFile(f, filepath)
-		c.JSON(200, gin.H{
-			"code": 200,
-			"msg":  "上传成功!",
-			"result": gin.H{
-				"path": filepath,
-				"ext":  fileExt,
-				"size": f.Size,
-				"name": f.Filename,
-			},
-		})
-	}
-}
 func GetMessagesV2(c *gin.Context) {
-	visitorId := c.Query("visitor_id")
+	visitorId := c.GetString("visitor_id")
 	messages := models.FindMessageByVisitorId(visitorId)
 	//result := make([]map[string]interface{}, 0)
 	chatMessages := make([]ChatMessage, 0)
@@ -342,7 +318,7 @@ func GetMessagesV2(c *gin.Context) {
 	})
 }
 func GetMessagespages(c *gin.Context) {
-	visitorId := c.Query("visitor_id")
+	visitorId := c.GetString("visitor_id")
 	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
 	pageSize, _ := strconv.Atoi(c.DefaultQuery("pagesize", "10"))
 	if pageSize > 20 {
@@ -361,3 +337,10 @@ func GetMessagespages(c *gin.Context) {
 		},
 	})
 }
+
+// updateVisitorLastMessage 更新访客最后一条消息, 失败时只记录日志
+func updateVisitorLastMessage(visitorId, content string) {
+	if err := models.UpdateVisitorLastMessage(visitorId, content); err != nil {
+		tools.Logger().Println("update last message error:", visitorId, err)
+	}
+}
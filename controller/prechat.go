@@ -0,0 +1,167 @@
+package controller
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"goflylivechat/common"
+	"goflylivechat/models"
+	"goflylivechat/tools"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var fieldKeyRegexp = regexp.MustCompile(`^[a-zA-Z][a-zA-Z0-9_]{0,49}$`)
+
+// GetPrechatForm 访客端获取客服的售前表单
+func GetPrechatForm(c *gin.Context) {
+	kefuId := c.Query("kefu_id")
+	user := models.FindUser(kefuId)
+	if user.ID == 0 {
+		c.JSON(200, gin.H{
+			"code": 400,
+			"msg":  "user not found",
+		})
+		return
+	}
+	c.JSON(200, gin.H{
+		"code":   200,
+		"msg":    "ok",
+		"result": models.FindPrechatFieldsByUserId(user.Name),
+	})
+}
+func GetPrechatFields(c *gin.Context) {
+	kefuName, _ := c.Get("kefu_name")
+	c.JSON(200, gin.H{
+		"code":   200,
+		"msg":    "ok",
+		"result": models.FindPrechatFieldsByUserId(kefuName),
+	})
+}
+func PostPrechatField(c *gin.Context) {
+	kefuName, _ := c.Get("kefu_name")
+	id := c.PostForm("id")
+	fieldKey := c.PostForm("field_key")
+	label := c.PostForm("label")
+	fieldType := c.DefaultPostForm("field_type", tools.FieldText)
+	options := c.PostForm("options")
+	pattern := c.PostForm("pattern")
+	required, _ := strconv.Atoi(c.PostForm("required"))
+	sort, _ := strconv.Atoi(c.PostForm("sort"))
+	if !fieldKeyRegexp.MatchString(fieldKey) || label == "" {
+		c.JSON(200, gin.H{
+			"code": 400,
+			"msg":  "字段标识或名称不正确",
+		})
+		return
+	}
+	if !tools.IsFieldType(fieldType) {
+		c.JSON(200, gin.H{
+			"code": 400,
+			"msg":  "字段类型不支持",
+		})
+		return
+	}
+	if fieldType == tools.FieldSelect && options == "" {
+		c.JSON(200, gin.H{
+			"code": 400,
+			"msg":  "下拉字段必须设置选项",
+		})
+		return
+	}
+	if _, err := regexp.Compile(pattern); err != nil {
+		c.JSON(200, gin.H{
+			"code": 400,
+			"msg":  "校验正则不正确:" + err.Error(),
+		})
+		return
+	}
+	if required > 0 {
+		required = 1
+	}
+	if id == "" {
+		models.CreatePrechatField(kefuName.(string), fieldKey, label, fieldType, options, pattern, uint(required), uint(sort))
+	} else {
+		models.UpdatePrechatField(kefuName.(string), id, fieldKey, label, fieldType, options, pattern, uint(required), uint(sort))
+	}
+	c.JSON(200, gin.H{
+		"code":   200,
+		"msg":    "ok",
+		"result": "",
+	})
+}
+func DelPrechatField(c *gin.Context) {
+	kefuName, _ := c.Get("kefu_name")
+	id := c.Query("id")
+	models.DeletePrechatField(kefuName, id)
+	c.JSON(200, gin.H{
+		"code":   200,
+		"msg":    "ok",
+		"result": "",
+	})
+}
+
+// GetVisitorsByAttr 按售前表单填写的属性搜索访客
+func GetVisitorsByAttr(c *gin.Context) {
+	kefuName, _ := c.Get("kefu_name")
+	key := c.Query("key")
+	value := c.Query("value")
+	page, _ := strconv.Atoi(c.Query("page"))
+	if page == 0 {
+		page = 1
+	}
+	if value == "" {
+		c.JSON(200, gin.H{
+			"code": 400,
+			"msg":  "搜索内容不能为空",
+		})
+		return
+	}
+	visitors := models.FindVisitorsByAttr(kefuName.(string), key, value, uint(page), common.PageSize)
+	c.JSON(200, gin.H{
+		"code":   200,
+		"msg":    "ok",
+		"result": visitors,
+	})
+}
+
+// checkPrechatForm 校验访客提交的售前表单, 返回校验通过的字段值
+func checkPrechatForm(fields []models.PrechatField, prechat string) (map[string]string, error) {
+	values := make(map[string]string)
+	if prechat != "" {
+		if err := json.Unmarshal([]byte(prechat), &values); err != nil {
+			return nil, errors.New("pre-chat form is malformed")
+		}
+	}
+	result := make(map[string]string)
+	for _, field := range fields {
+		// 校验和保存的都是去掉首尾空白后的值
+		value := strings.TrimSpace(values[field.FieldKey])
+		if err := tools.ValidateField(field.FieldType, value, field.Options, field.Pattern, field.Required == 1); err != nil {
+			return nil, errors.New(field.Label + " " + err.Error())
+		}
+		if value != "" {
+			result[field.FieldKey] = value
+		}
+	}
+	return result, nil
+}
+
+// saveVisitorPrechat 把表单值保存为访客属性
+func saveVisitorPrechat(visitorId string, fields []models.PrechatField, values map[string]string) {
+	for _, field := range fields {
+		value, ok := values[field.FieldKey]
+		if !ok {
+			continue
+		}
+		saveVisitorAttr(visitorId, field.FieldKey, field.Label, field.FieldType, value)
+	}
+}
+
+// saveVisitorAttr 保存访客属性, 失败时只记录日志
+func saveVisitorAttr(visitorId, key, label, attrType, value string) {
+	if err := models.SaveVisitorAttr(visitorId, key, label, attrType, value); err != nil {
+		tools.Logger().Println("save visitor attr error:", visitorId, key, err)
+	}
+}
@@ -0,0 +1,103 @@
+package controller
+
+import (
+	"github.com/gin-gonic/gin"
+	"goflylivechat/common"
+	"goflylivechat/models"
+	"strconv"
+	"time"
+)
+
+// PostRate 访客提交满意度评价
+func PostRate(c *gin.Context) {
+	conversationId := c.PostForm("conversation_id")
+	visitorId := c.GetString("visitor_id")
+	score, _ := strconv.Atoi(c.PostForm("score"))
+	comment := c.PostForm("comment")
+	rate := models.FindRateByConversationId(conversationId)
+	if rate.ID == 0 || rate.VisitorId != visitorId {
+		c.JSON(200, gin.H{
+			"code": 400,
+			"msg":  "会话不存在",
+		})
+		return
+	}
+	//点赞只有好评和差评
+	if rate.RateType == "thumb" && score != 1 && score != 5 {
+		score = 0
+	}
+	if score < 1 || score > 5 {
+		c.JSON(200, gin.H{
+			"code": 400,
+			"msg":  "评分不正确",
+		})
+		return
+	}
+	if len([]rune(comment)) > 500 {
+		comment = string([]rune(comment)[:500])
+	}
+	if models.UpdateRateScore(conversationId, visitorId, uint(score), comment) == 0 {
+		c.JSON(200, gin.H{
+			"code": 400,
+			"msg":  "已经评价过了",
+		})
+		return
+	}
+	c.JSON(200, gin.H{
+		"code": 200,
+		"msg":  "ok",
+	})
+}
+
+// GetRates 客服查看收到的评价
+func GetRates(c *gin.Context) {
+	kefuName, _ := c.Get("kefu_name")
+	page, _ := strconv.Atoi(c.Query("page"))
+	if page == 0 {
+		page = 1
+	}
+	list := models.FindRates(kefuName.(string), uint(page), common.PageSize)
+	count := models.CountRates(kefuName.(string))
+	c.JSON(200, gin.H{
+		"code": 200,
+		"msg":  "ok",
+		"result": gin.H{
+			"list":     list,
+			"count":    count,
+			"pagesize": common.PageSize,
+		},
+	})
+}
+
+// GetCsatStatistics 按客服统计时间段内的满意度,默认最近30天
+func GetCsatStatistics(c *gin.Context) {
+	start, end := parsePeriod(c.Query("start"), c.Query("end"))
+	c.JSON(200, gin.H{
+		"code": 200,
+		"msg":  "ok",
+		"result": gin.H{
+			"start": start.Format("2006-01-02"),
+			"end":   end.AddDate(0, 0, -1).Format("2006-01-02"),
+			"total": models.SumRates("", start, end),
+			"kefus": models.SumRatesGroupByKefu(start, end),
+		},
+	})
+}
+
+// parsePeriod 解析统计时间段,结束日期包含当天
+func parsePeriod(startStr, endStr string) (time.Time, time.Time) {
+	now := time.Now()
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	end := today.AddDate(0, 0, 1)
+	start := today.AddDate(0, 0, -29)
+	if t, err := time.ParseInLocation("2006-01-02", endStr, now.Location()); err == nil {
+		end = t.AddDate(0, 0, 1)
+	}
+	if t, err := time.ParseInLocation("2006-01-02", startStr, now.Location()); err == nil {
+		start = t
+	}
+	if !start.Before(end) {
+		start = end.AddDate(0, 0, -1)
+	}
+	return start, end
+}
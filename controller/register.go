@@ -0,0 +1,178 @@
+package controller
+
+import (
+	"errors"
+	"github.com/gin-gonic/gin"
+	"goflylivechat/common"
+	"goflylivechat/models"
+	"goflylivechat/tools"
+	"log"
+	"net/mail"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	registerInviteHours   = 72
+	emailVerifyExpire     = 48 * time.Hour
+	maxRegisterInviteDays = 30
+)
+
+// sendSystemEmail 使用系统配置的SMTP账号发送邮件
+func sendSystemEmail(to []string, subject, body string) error {
+	smtp := models.FindConfig("NoticeEmailSmtp")
+	email := models.FindConfig("NoticeEmailAddress")
+	password := models.FindConfig("NoticeEmailPassword")
+	if smtp == "" || email == "" || password == "" {
+		return errors.New("smtp is not configured")
+	}
+	return tools.SendSmtp(smtp, email, password, to, subject, body)
+}
+
+// sendVerifyEmail 发送邮箱验证链接, 同一客服每10分钟最多发送一次
+func sendVerifyEmail(user models.User) error {
+	if !tools.LimitFreqSingle("verify_email:"+user.Name, 1, 600) {
+		return errors.New("verification email was sent recently")
+	}
+	token, err := tools.MakeToken(map[string]interface{}{
+		"kefu_name": user.Name,
+		"email":     user.Email,
+	}, tools.TokenVerify, emailVerifyExpire)
+	if err != nil {
+		return err
+	}
+	base, err := common.GetBaseUrl()
+	if err != nil {
+		return err
+	}
+	link := base + "/verify_email?token=" + token
+	body := "您好 " + user.Name + ",<br>请在48小时内点击以下链接验证邮箱:<br><a href=\"" + link + "\">" + link + "</a>"
+	return sendSystemEmail([]string{user.Email}, "[GOFLY]验证邮箱", body)
+}
+
+// checkRegisterInvite 校验邀请链接中的令牌, 返回对应的邀请记录
+func checkRegisterInvite(token string) (models.RegisterInvite, bool) {
+	claims := tools.ParseToken(token, tools.TokenInvite)
+	if claims == nil {
+		return models.RegisterInvite{}, false
+	}
+	jti, _ := claims["invite"].(string)
+	invite := models.FindRegisterInvite(jti)
+	if invite.ID == 0 || invite.UsedAt != nil || invite.ExpiresAt.Before(time.Now()) {
+		return models.RegisterInvite{}, false
+	}
+	return invite, true
+}
+
+// PostRegisterInvite 管理员生成邀请注册链接
+func PostRegisterInvite(c *gin.Context) {
+	kefuName, _ := c.Get("kefu_name")
+	email := strings.TrimSpace(c.PostForm("email"))
+	roleId, _ := strconv.Atoi(c.DefaultPostForm("role_id", strconv.Itoa(common.DefaultKefuRole)))
+	hours, _ := strconv.Atoi(c.DefaultPostForm("hours", strconv.Itoa(registerInviteHours)))
+	if _, err := mail.ParseAddress(email); err != nil {
+		c.JSON(200, gin.H{
+			"code": 400,
+			"msg":  "邮箱格式不正确",
+		})
+		return
+	}
+	if hours <= 0 || hours > maxRegisterInviteDays*24 {
+		c.JSON(200, gin.H{
+			"code": 400,
+			"msg":  "有效期不正确",
+		})
+		return
+	}
+	if roleId == common.SuperAdminRoleId || models.FindRole(roleId).Id == 0 {
+		c.JSON(200, gin.H{
+			"code": 400,
+			"msg":  "角色不存在",
+		})
+		return
+	}
+	ttl := time.Duration(hours) * time.Hour
+	jti := tools.NewTokenId()
+	token, err := tools.MakeToken(map[string]interface{}{
+		"invite": jti,
+		"email":  email,
+	}, tools.TokenInvite, ttl)
+	if err != nil {
+		c.JSON(200, gin.H{
+			"code": 500,
+			"msg":  err.Error(),
+		})
+		return
+	}
+	models.CreateRegisterInvite(jti, email, uint(roleId), kefuName.(string), time.Now().Add(ttl))
+	saveAudit(c, AuditInviteCreate, email, nil, gin.H{"role_id": roleId, "hours": hours})
+	// 没有配置站点地址时不发送邮件, 只返回相对链接给管理员复制
+	link := common.GetDynamicBasePath(c) + "/login?invite=" + token
+	base, err := common.GetBaseUrl()
+	if err == nil {
+		link = base + "/login?invite=" + token
+		body := "您好,<br>" + kefuName.(string) + " 邀请您注册客服账号,链接" + strconv.Itoa(hours) + "小时内有效:<br><a href=\"" + link + "\">" + link + "</a>"
+		err = sendSystemEmail([]string{email}, "[GOFLY]客服注册邀请", body)
+	}
+	if err != nil {
+		log.Println("send register invite:", err)
+	}
+	c.JSON(200, gin.H{
+		"code": 200,
+		"msg":  "ok",
+		"result": gin.H{
+			"url":  link,
+			"sent": err == nil,
+		},
+	})
+}
+func GetRegisterInvites(c *gin.Context) {
+	page, _ := strconv.Atoi(c.Query("page"))
+	if page == 0 {
+		page = 1
+	}
+	c.JSON(200, gin.H{
+		"code": 200,
+		"msg":  "ok",
+		"result": gin.H{
+			"list":     models.FindRegisterInvites(uint(page), common.PageSize),
+			"count":    models.CountRegisterInvites(),
+			"pagesize": common.PageSize,
+		},
+	})
+}
+func DeleteRegisterInvite(c *gin.Context) {
+	models.DeleteRegisterInvite(c.Query("id"))
+	saveAudit(c, AuditInviteDelete, c.Query("id"), nil, nil)
+	c.JSON(200, gin.H{
+		"code": 200,
+		"msg":  "ok",
+	})
+}
+
+// GetVerifyEmail 邮件中的验证链接, 验证后跳转到登录页
+func GetVerifyEmail(c *gin.Context) {
+	loginUrl := common.GetDynamicBasePath(c) + "/login?verified="
+	claims := tools.ParseToken(c.Query("token"), tools.TokenVerify)
+	if claims == nil {
+		c.Redirect(302, loginUrl+"0")
+		return
+	}
+	kefuName, _ := claims["kefu_name"].(string)
+	email, _ := claims["email"].(string)
+	if !models.VerifyUserEmail(kefuName, email) {
+		c.Redirect(302, loginUrl+"0")
+		return
+	}
+	c.Redirect(302, loginUrl+"1")
+}
+
+// verifyEmailPending 邮箱未验证时重新发送验证邮件, 返回给前端的提示
+func verifyEmailPending(c *gin.Context, user models.User) string {
+	if err := sendVerifyEmail(user); err != nil {
+		log.Println("send verify email:", err)
+		return "Please verify your email address before signing in"
+	}
+	return "Please verify your email address, a new verification email has been sent"
+}
@@ -0,0 +1,133 @@
+package controller
+
+import (
+	"encoding/json"
+	"goflylivechat/common"
+	"goflylivechat/models"
+	"goflylivechat/tools"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// RetentionReport 一次数据清理的结果, DryRun 时为将要清理的数量
+type RetentionReport struct {
+	DryRun        bool              `json:"dry_run"`
+	StartedAt     time.Time         `json:"started_at"`
+	FinishedAt    time.Time         `json:"finished_at"`
+	Messages      int64             `json:"messages"`
+	Visitors      int64             `json:"visitors"`
+	LoginAttempts int64             `json:"login_attempts"`
+	Uploads       tools.PurgeResult `json:"uploads"`
+	Logs          tools.PurgeResult `json:"logs"`
+	Archives      []string          `json:"archives"`
+	Errors        []string          `json:"errors"`
+}
+
+// RunRetention 按保留策略清理过期数据
+func RunRetention(policy common.Retention, dryRun bool) RetentionReport {
+	report := RetentionReport{
+		DryRun:    dryRun,
+		StartedAt: time.Now(),
+		Archives:  make([]string, 0),
+		Errors:    make([]string, 0),
+	}
+	addError := func(class string, err error) {
+		if err != nil {
+			report.Errors = append(report.Errors, class+": "+err.Error())
+		}
+	}
+	// 先清理访客, 访客的消息随访客一起删除和归档
+	if policy.VisitorDays > 0 {
+		archive := retentionArchive(policy, dryRun, "visitor", addError)
+		var err error
+		report.Visitors, err = models.PurgeInactiveVisitors(retentionBefore(policy.VisitorDays), policy.BatchSize, dryRun, archive)
+		addError("visitor", err)
+		closeRetentionArchive(archive, report.Visitors, &report, addError)
+	}
+	if policy.MessageDays > 0 {
+		archive := retentionArchive(policy, dryRun, "message", addError)
+		var err error
+		report.Messages, err = models.PurgeMessagesBefore(retentionBefore(policy.MessageDays), policy.BatchSize, dryRun, archive)
+		addError("message", err)
+		closeRetentionArchive(archive, report.Messages, &report, addError)
+	}
+	if policy.UploadDays > 0 {
+		var err error
+		before := retentionBefore(policy.UploadDays)
+		// 有上传记录的文件按记录删除, 去重保存的文件还有引用时保留
+		// 本地磁盘上没有记录的为旧版本上传的文件, 按修改时间删除; 头像和快捷回复中的文件都保留
+		report.Uploads, err = tools.PurgeOldFiles(common.Upload, before, func(path string) bool {
+			path = filepath.ToSlash(path)
+			return models.FindUploadFileByPath(path).ID == 0 && !models.UploadPathInUse(path)
+		}, dryRun)
+		addError("upload", err)
+		recorded, err := models.PurgeUploadFilesBefore(before, policy.BatchSize, dryRun)
+		addError("upload_file", err)
+		report.Uploads.Files += recorded.Files
+		report.Uploads.Bytes += recorded.Bytes
+	}
+	if policy.LogDays > 0 {
+		var err error
+		before := retentionBefore(policy.LogDays)
+		report.LoginAttempts, err = models.PurgeLoginAttemptsBefore(before, policy.BatchSize, dryRun)
+		addError("login_attempt", err)
+		report.Logs, err = tools.PurgeOldFiles("logs", before, func(path string) bool {
+			return strings.HasSuffix(path, ".log")
+		}, dryRun)
+		addError("logs", err)
+	}
+	report.FinishedAt = time.Now()
+	return report
+}
+func retentionBefore(days int) time.Time {
+	return time.Now().AddDate(0, 0, -days)
+}
+
+// retentionArchive 配置了归档目录时创建归档文件, dryRun 时不归档
+func retentionArchive(policy common.Retention, dryRun bool, name string, addError func(string, error)) *tools.JsonlArchive {
+	if dryRun || policy.ArchiveDir == "" {
+		return nil
+	}
+	archive, err := tools.NewJsonlArchive(filepath.Clean(policy.ArchiveDir), name)
+	addError(name+" archive", err)
+	return archive
+}
+func closeRetentionArchive(archive *tools.JsonlArchive, count int64, report *RetentionReport, addError func(string, error)) {
+	if archive == nil {
+		return
+	}
+	addError("archive", archive.Close())
+	if count == 0 {
+		os.Remove(archive.Path)
+		return
+	}
+	report.Archives = append(report.Archives, archive.Path)
+}
+
+// StartRetentionWorker 开启数据保留策略后定时清理, 结果写入日志和审计日志
+func StartRetentionWorker() {
+	if !common.GetRetention().Enable {
+		return
+	}
+	go func() {
+		log.Println("retentionWorker start...")
+		for {
+			policy := common.GetRetention()
+			if policy.Enable {
+				report := RunRetention(policy, policy.DryRun)
+				out, _ := json.Marshal(report)
+				tools.Logger().Println("retention:", string(out))
+				models.CreateAudit(models.Audit{
+					Actor:      "system",
+					Action:     AuditRetention,
+					AfterValue: string(out),
+				})
+			}
+			t := time.NewTimer(time.Duration(policy.IntervalHours) * time.Hour)
+			<-t.C
+		}
+	}()
+}
@@ -2,7 +2,11 @@ package controller
 
 import (
 	"github.com/gin-gonic/gin"
+	"goflylivechat/common"
 	"goflylivechat/models"
+	"strconv"
+	"strings"
+	"time"
 )
 
 func GetRoleList(c *gin.Context) {
@@ -13,21 +17,128 @@ func GetRoleList(c *gin.Context) {
 		"result": roles,
 	})
 }
+
+// GetPermissions 可分配的权限列表
+func GetPermissions(c *gin.Context) {
+	c.JSON(200, gin.H{
+		"code":   200,
+		"msg":    "ok",
+		"result": common.Permissions,
+	})
+}
+
+// PostRole 添加或修改角色, permissions为逗号分隔的权限标识
 func PostRole(c *gin.Context) {
-	roleId := c.PostForm("id")
-	method := c.PostForm("method")
+	roleId, _ := strconv.Atoi(c.PostForm("id"))
 	name := c.PostForm("name")
-	path := c.PostForm("path")
-	if roleId == "" || method == "" || name == "" || path == "" {
+	permissions := make([]string, 0)
+	for _, perm := range strings.Split(c.PostForm("permissions"), ",") {
+		perm = strings.TrimSpace(perm)
+		if perm == "" {
+			continue
+		}
+		if !common.IsPermission(perm) {
+			c.JSON(200, gin.H{
+				"code": 400,
+				"msg":  "权限不存在:" + perm,
+			})
+			return
+		}
+		permissions = append(permissions, perm)
+	}
+	if name == "" || len(permissions) == 0 {
 		c.JSON(200, gin.H{
 			"code": 400,
 			"msg":  "参数不能为空",
 		})
 		return
 	}
-	models.SaveRole(roleId, name, method, path)
+	if roleId == common.SuperAdminRoleId {
+		c.JSON(200, gin.H{
+			"code": 400,
+			"msg":  "超级管理员角色不能修改",
+		})
+		return
+	}
+	var before interface{}
+	if roleId == 0 {
+		roleId = int(models.CreateRole(name, permissions))
+	} else {
+		if models.FindRole(roleId).Id == 0 {
+			c.JSON(200, gin.H{
+				"code": 400,
+				"msg":  "角色不存在",
+			})
+			return
+		}
+		before = gin.H{"name": models.FindRole(roleId).Name, "permissions": models.FindRolePermissions(roleId)}
+		models.SaveRole(uint(roleId), name, permissions)
+	}
+	saveAudit(c, AuditRoleSave, strconv.Itoa(roleId), before, gin.H{"name": name, "permissions": permissions})
+	c.JSON(200, gin.H{
+		"code":   200,
+		"msg":    "修改成功",
+		"result": models.FindRole(roleId),
+	})
+}
+func DelRole(c *gin.Context) {
+	roleId, _ := strconv.Atoi(c.Query("id"))
+	if roleId == common.SuperAdminRoleId || roleId == common.DefaultKefuRole {
+		c.JSON(200, gin.H{
+			"code": 400,
+			"msg":  "内置角色不能删除",
+		})
+		return
+	}
+	if models.CountUserRoleByRoleId(roleId) > 0 {
+		c.JSON(200, gin.H{
+			"code": 400,
+			"msg":  "角色下还有客服,不能删除",
+		})
+		return
+	}
+	before := gin.H{"name": models.FindRole(roleId).Name, "permissions": models.FindRolePermissions(roleId)}
+	models.DeleteRole(uint(roleId))
+	saveAudit(c, AuditRoleDelete, strconv.Itoa(roleId), before, nil)
+	c.JSON(200, gin.H{
+		"code": 200,
+		"msg":  "删除成功",
+	})
+}
+
+// PostUserRole 给客服分配角色
+func PostUserRole(c *gin.Context) {
+	userId, _ := strconv.Atoi(c.PostForm("user_id"))
+	roleId, _ := strconv.Atoi(c.PostForm("role_id"))
+	kefuId, _ := c.Get("kefu_id")
+	if models.FindUserByUid(userId).ID == 0 {
+		c.JSON(200, gin.H{
+			"code": 400,
+			"msg":  "客服不存在",
+		})
+		return
+	}
+	if models.FindRole(roleId).Id == 0 {
+		c.JSON(200, gin.H{
+			"code": 400,
+			"msg":  "角色不存在",
+		})
+		return
+	}
+	if id, ok := kefuId.(float64); ok && uint(id) == uint(userId) {
+		c.JSON(200, gin.H{
+			"code": 400,
+			"msg":  "不能修改自己的角色",
+		})
+		return
+	}
+	before := models.FindRoleByUserId(userId).RoleId
+	models.SaveUserRole(uint(userId), uint(roleId))
+	saveAudit(c, AuditUserRole, models.FindUserByUid(userId).Name, strconv.Itoa(int(before)), strconv.Itoa(roleId))
+	//令牌中携带角色,修改后需要重新登录
+	models.RevokeUserTokens(models.FindUserByUid(userId).Name, time.Now().Add(common.RefreshTokenExpire()))
 	c.JSON(200, gin.H{
 		"code": 200,
-		"msg":  "修改成功",
+		"msg":  "ok",
 	})
 }
@@ -0,0 +1,151 @@
+package controller
+
+import (
+	"github.com/gin-gonic/gin"
+	"goflylivechat/common"
+	"goflylivechat/models"
+	"goflylivechat/tools"
+	"goflylivechat/ws"
+	"log"
+	"strconv"
+	"time"
+)
+
+// PostScheduleMessage 预约在指定时间给访客发送消息, send_at或delay(分钟)二选一
+func PostScheduleMessage(c *gin.Context) {
+	kefuName, _ := c.Get("kefu_name")
+	toId := c.PostForm("to_id")
+	content := c.PostForm("content")
+	sendAtStr := c.PostForm("send_at")
+	delay, _ := strconv.Atoi(c.PostForm("delay"))
+	if content == "" {
+		c.JSON(200, gin.H{
+			"code": 400,
+			"msg":  "内容不能为空",
+		})
+		return
+	}
+	// 预约消息表不加密, 保存打码后的内容, 发送时不再处理
+	redacted, ok := redactMessage(c, content)
+	if !ok {
+		return
+	}
+	content = redacted.Content
+	var sendAt time.Time
+	if sendAtStr != "" {
+		t, err := time.ParseInLocation("2006-01-02 15:04:05", sendAtStr, time.Local)
+		if err != nil {
+			c.JSON(200, gin.H{
+				"code": 400,
+				"msg":  "发送时间格式不正确",
+			})
+			return
+		}
+		sendAt = t
+	} else if delay > 0 {
+		sendAt = time.Now().Add(time.Duration(delay) * time.Minute)
+	}
+	if sendAt.Before(time.Now()) {
+		c.JSON(200, gin.H{
+			"code": 400,
+			"msg":  "发送时间必须晚于当前时间",
+		})
+		return
+	}
+	visitor := models.FindVisitorByVistorId(toId)
+	if visitor.ID == 0 {
+		c.JSON(200, gin.H{
+			"code": 400,
+			"msg":  "访客不存在",
+		})
+		return
+	}
+	//只能给自己的访客预约消息
+	if visitor.ToId != kefuName.(string) {
+		c.JSON(200, gin.H{
+			"code": 403,
+			"msg":  "没有权限",
+		})
+		return
+	}
+	schedule := models.CreateScheduleMessage(kefuName.(string), visitor.VisitorId, content, sendAt)
+	c.JSON(200, gin.H{
+		"code":   200,
+		"msg":    "ok",
+		"result": schedule,
+	})
+}
+func GetScheduleMessages(c *gin.Context) {
+	kefuName, _ := c.Get("kefu_name")
+	status := c.DefaultQuery("status", models.SchedulePending)
+	page, _ := strconv.Atoi(c.Query("page"))
+	if page == 0 {
+		page = 1
+	}
+	c.JSON(200, gin.H{
+		"code": 200,
+		"msg":  "ok",
+		"result": gin.H{
+			"list":     models.FindScheduleMessages(kefuName.(string), status, uint(page), common.PageSize),
+			"count":    models.CountScheduleMessages(kefuName.(string), status),
+			"pagesize": common.PageSize,
+		},
+	})
+}
+func DelScheduleMessage(c *gin.Context) {
+	kefuName, _ := c.Get("kefu_name")
+	if models.CancelScheduleMessage(kefuName.(string), c.Query("id")) == 0 {
+		c.JSON(200, gin.H{
+			"code": 400,
+			"msg":  "消息不存在或已发送",
+		})
+		return
+	}
+	c.JSON(200, gin.H{
+		"code": 200,
+		"msg":  "ok",
+	})
+}
+
+// StartScheduleWorker 定时发送到期消息,任务保存在数据库中,重启后继续发送
+func StartScheduleWorker() {
+	//上次退出时发送中断的任务重新发送
+	models.ResetSendingScheduleMessages()
+	go func() {
+		log.Println("scheduleWorker start...")
+		for {
+			for _, schedule := range models.FindDueScheduleMessages(time.Now(), 100) {
+				if !models.ClaimScheduleMessage(schedule.ID) {
+					continue
+				}
+				models.FinishScheduleMessage(schedule.ID, deliverScheduleMessage(schedule))
+			}
+			t := time.NewTimer(time.Second * 5)
+			<-t.C
+		}
+	}()
+}
+
+// deliverScheduleMessage 与客服发送消息走相同流程,访客不在线时保存为离线消息,有邮箱的同时发邮件
+func deliverScheduleMessage(schedule models.ScheduleMessage) string {
+	kefuInfo := models.FindUser(schedule.KefuId)
+	if err := models.CreateMessage(schedule.KefuId, schedule.VisitorId, schedule.Content, "kefu"); err != nil {
+		tools.Logger().Println("schedule message error:", schedule.ID, err)
+		return "failed"
+	}
+	ws.KefuMessage(schedule.VisitorId, schedule.Content, kefuInfo)
+	go updateVisitorLastMessage(schedule.VisitorId, schedule.Content)
+	if guest, ok := ws.ClientList[schedule.VisitorId]; ok && guest != nil {
+		ws.VisitorMessage(schedule.VisitorId, schedule.Content, kefuInfo)
+		return "ws"
+	}
+	email := models.FindVisitorAttr(schedule.VisitorId, "email").AttrValue
+	if email == "" || tools.ValidateField(tools.FieldEmail, email, "", "", true) != nil {
+		return "offline"
+	}
+	if err := SendKefuEmail(schedule.KefuId, []string{email}, kefuInfo.Nickname+"给您的留言", schedule.Content); err != nil {
+		tools.Logger().Println("schedule email error:", schedule.ID, err)
+		return "offline"
+	}
+	return "email"
+}
@@ -0,0 +1,102 @@
+package controller
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gin-gonic/gin"
+	"goflylivechat/models"
+	"goflylivechat/models/dbtest"
+	"goflylivechat/tools"
+)
+
+func TestPostScheduleMessageOtherKefuVisitor(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	mock := dbtest.Mock(t, &models.DB)
+	mock.ExpectQuery("SELECT \\* FROM `visitor`").WithArgs("v1").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "visitor_id", "to_id"}).AddRow(1, "v1", "kefu2"))
+
+	form := url.Values{
+		"to_id":   {"v1"},
+		"content": {"hello"},
+		"send_at": {time.Now().Add(time.Hour).Format("2006-01-02 15:04:05")},
+	}
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodPost, "/schedule_message", strings.NewReader(form.Encode()))
+	c.Request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	c.Set("kefu_name", "kefu1")
+	PostScheduleMessage(c)
+
+	var resp struct {
+		Code int `json:"code"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Code != 403 {
+		t.Fatalf("code = %d, want 403: %s", resp.Code, w.Body.String())
+	}
+}
+
+// TestPostScheduleMessageRedact 预约消息与直接发送的消息一样打码, 命中拒绝发送的规则时不保存
+func TestPostScheduleMessageRedact(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	defer tools.SetRedactRules(nil)
+	if err := tools.SetRedactRules([]tools.RedactRule{
+		{Name: tools.RedactCard, Label: "银行卡号", Policy: tools.RedactReject},
+		{Name: tools.RedactPhone, Label: "手机号", Policy: tools.RedactMask},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	type response struct {
+		Code   int    `json:"code"`
+		Msg    string `json:"msg"`
+		Result struct {
+			Content string `json:"content"`
+		} `json:"result"`
+	}
+	post := func(content string) response {
+		form := url.Values{
+			"to_id":   {"v1"},
+			"content": {content},
+			"delay":   {"10"},
+		}
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodPost, "/schedule_message", strings.NewReader(form.Encode()))
+		c.Request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		c.Set("kefu_name", "kefu1")
+		PostScheduleMessage(c)
+		var resp response
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+
+	// 没有预期任何数据库语句, 保存预约消息时用例失败
+	dbtest.Mock(t, &models.DB)
+	if resp := post("我的卡号4111 1111 1111 1111"); resp.Code != 400 || !strings.Contains(resp.Msg, "银行卡号") {
+		t.Fatalf("PostScheduleMessage = %+v, want rejected", resp)
+	}
+
+	mock := dbtest.Mock(t, &models.DB)
+	mock.ExpectQuery("SELECT \\* FROM `visitor`").WithArgs("v1").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "visitor_id", "to_id"}).AddRow(1, "v1", "kefu1"))
+	mock.ExpectExec("set names utf8mb4").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectBegin()
+	mock.ExpectExec("INSERT INTO `schedule_message`").WithArgs("kefu1", "v1", sqlmock.AnyArg(), sqlmock.AnyArg(), models.SchedulePending, "", sqlmock.AnyArg(), nil).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+	resp := post("电话13812345678")
+	if resp.Code != 200 || strings.Contains(resp.Result.Content, "13812345678") {
+		t.Fatalf("PostScheduleMessage = %+v, want masked content", resp)
+	}
+}
@@ -3,6 +3,8 @@ package controller
 import (
 	"github.com/gin-gonic/gin"
 	"goflylivechat/models"
+	"goflylivechat/tools"
+	"strings"
 )
 
 func GetConfigs(c *gin.Context) {
@@ -34,7 +36,11 @@ func PostConfig(c *gin.Context) {
 		})
 		return
 	}
+	before := models.FindConfigByUserId(kefuName, key).ConfValue
 	models.UpdateConfig(kefuName, key, value)
+	if before != value {
+		saveAudit(c, AuditConfigUpdate, key, auditConfigValue(key, before), auditConfigValue(key, value))
+	}
 
 	c.JSON(200, gin.H{
 		"code":   200,
@@ -42,3 +48,29 @@ func PostConfig(c *gin.Context) {
 		"result": "",
 	})
 }
+
+// GetSiteDomains 站点允许接入的域名, 客服没有单独配置时使用
+func GetSiteDomains(c *gin.Context) {
+	c.JSON(200, gin.H{
+		"code":   200,
+		"msg":    "ok",
+		"result": tools.SplitDomains(models.FindConfigByUserId("", "AllowedDomains").ConfValue),
+	})
+}
+
+// PostSiteDomains 设置站点允许接入的域名, 为空时不限制
+func PostSiteDomains(c *gin.Context) {
+	domains := tools.SplitDomains(c.PostForm("domains"))
+	before := models.FindConfigByUserId("", "AllowedDomains").ConfValue
+	if len(domains) == 0 {
+		models.DeleteConfig("", "AllowedDomains")
+	} else {
+		models.UpdateConfig("", "AllowedDomains", strings.Join(domains, ","))
+	}
+	saveAudit(c, AuditSiteDomains, "AllowedDomains", before, strings.Join(domains, ","))
+	c.JSON(200, gin.H{
+		"code":   200,
+		"msg":    "ok",
+		"result": domains,
+	})
+}
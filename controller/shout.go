@@ -2,6 +2,7 @@ package controller
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"goflylivechat/models"
 	"goflylivechat/tools"
@@ -53,6 +54,17 @@ func SendNoticeEmail(username, msg string) {
 		log.Println(err)
 	}
 }
+
+// SendKefuEmail 使用客服自己配置的SMTP账号发送邮件
+func SendKefuEmail(kefuName string, to []string, subject, body string) error {
+	smtp := models.FindConfigByUserId(kefuName, "NoticeEmailSmtp").ConfValue
+	email := models.FindConfigByUserId(kefuName, "NoticeEmailAddress").ConfValue
+	password := models.FindConfigByUserId(kefuName, "NoticeEmailPassword").ConfValue
+	if smtp == "" || email == "" || password == "" {
+		return errors.New("smtp is not configured")
+	}
+	return tools.SendSmtp(smtp, email, password, to, subject, body)
+}
 func SendAppGetuiPush(kefu string, title, content string) {
 	token := models.FindConfig("GetuiToken")
 	if token == "" {
@@ -0,0 +1,305 @@
+package controller
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"goflylivechat/common"
+	"goflylivechat/models"
+	"goflylivechat/tools"
+	"goflylivechat/ws"
+	"html"
+	"net/mail"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// PostTicket 客服离线时访客留言,创建工单
+func PostTicket(c *gin.Context) {
+	visitorId := c.GetString("visitor_id")
+	toId := c.PostForm("to_id")
+	name := strings.TrimSpace(c.PostForm("name"))
+	email := strings.TrimSpace(c.PostForm("email"))
+	phone := strings.TrimSpace(c.PostForm("phone"))
+	content := strings.TrimSpace(c.PostForm("content"))
+	if content == "" || (email == "" && phone == "") {
+		c.JSON(200, gin.H{
+			"code": 400,
+			"msg":  "请填写留言内容和联系方式",
+		})
+		return
+	}
+	if err := tools.ValidateField(tools.FieldEmail, email, "", "", false); err != nil {
+		c.JSON(200, gin.H{
+			"code": 400,
+			"msg":  "Email " + err.Error(),
+		})
+		return
+	}
+	if err := tools.ValidateField(tools.FieldPhone, phone, "", "", false); err != nil {
+		c.JSON(200, gin.H{
+			"code": 400,
+			"msg":  "Phone " + err.Error(),
+		})
+		return
+	}
+	//工单不加密保存, 只保存打码后的内容
+	redacted, ok := redactMessage(c, content)
+	if !ok {
+		return
+	}
+	content = redacted.Content
+	//限流
+	if !tools.LimitFreqSingle("ticket:"+c.ClientIP(), 3, 600) {
+		c.JSON(200, gin.H{
+			"code": 400,
+			"msg":  c.ClientIP() + "留言频率过快",
+		})
+		return
+	}
+	kefuInfo := models.FindUser(toId)
+	if kefuInfo.ID == 0 {
+		c.JSON(200, gin.H{
+			"code": 400,
+			"msg":  "The customer service account does not exist",
+		})
+		return
+	}
+	if visitorId != "" && models.FindVisitorByVistorId(visitorId).ID == 0 {
+		visitorId = ""
+	}
+	dueHours, err := strconv.Atoi(models.FindConfigByUserId(kefuInfo.Name, "TicketDueHours").ConfValue)
+	if err != nil || dueHours <= 0 {
+		dueHours = 24
+	}
+	dueAt := time.Now().Add(time.Duration(dueHours) * time.Hour)
+	subject := []rune(content)
+	if len(subject) > 50 {
+		subject = subject[:50]
+	}
+	id := models.CreateTicket(visitorId, kefuInfo.Name, name, email, phone, string(subject), content, &dueAt)
+
+	go SendNoticeEmail(tools.TicketSubject(id, name), content)
+	notice, _ := json.Marshal(ws.TypeMessage{
+		Type: "ticket",
+		Data: gin.H{
+			"id":      id,
+			"name":    name,
+			"content": content,
+		},
+	})
+	go ws.OneKefuMessage(kefuInfo.Name, notice)
+	c.JSON(200, gin.H{
+		"code": 200,
+		"msg":  "ok",
+		"result": gin.H{
+			"id": id,
+		},
+	})
+}
+
+// GetTickets 客服查看工单列表,默认只看指派给自己的
+func GetTickets(c *gin.Context) {
+	kefuName, _ := c.Get("kefu_name")
+	page, _ := strconv.Atoi(c.Query("page"))
+	if page == 0 {
+		page = 1
+	}
+	query := "(kefu_id = ? or assignee = ?)"
+	args := []interface{}{kefuName, kefuName}
+	if status := c.Query("status"); status != "" {
+		query += " and status = ?"
+		args = append(args, status)
+	}
+	if c.Query("overdue") == "1" {
+		query += " and status != ? and due_at < ?"
+		args = append(args, models.TicketClosed, time.Now())
+	}
+	list := models.FindTickets(uint(page), common.PageSize, query, args...)
+	count := models.CountTickets(query, args...)
+	c.JSON(200, gin.H{
+		"code": 200,
+		"msg":  "ok",
+		"result": gin.H{
+			"list":     list,
+			"count":    count,
+			"pagesize": common.PageSize,
+		},
+	})
+}
+func GetTicket(c *gin.Context) {
+	ticket, ok := findKefuTicket(c, c.Query("id"))
+	if !ok {
+		return
+	}
+	c.JSON(200, gin.H{
+		"code": 200,
+		"msg":  "ok",
+		"result": gin.H{
+			"ticket":  ticket,
+			"replies": models.FindTicketReplies(ticket.ID),
+		},
+	})
+}
+
+// PostTicketUpdate 修改工单状态,指派人和截止时间
+func PostTicketUpdate(c *gin.Context) {
+	ticket, ok := findKefuTicket(c, c.PostForm("id"))
+	if !ok {
+		return
+	}
+	fields := make(map[string]interface{})
+	if status := c.PostForm("status"); status != "" {
+		if status != models.TicketOpen && status != models.TicketPending && status != models.TicketClosed {
+			c.JSON(200, gin.H{
+				"code": 400,
+				"msg":  "工单状态不正确",
+			})
+			return
+		}
+		fields["status"] = status
+	}
+	if assignee := c.PostForm("assignee"); assignee != "" {
+		if models.FindUser(assignee).ID == 0 {
+			c.JSON(200, gin.H{
+				"code": 400,
+				"msg":  "客服不存在",
+			})
+			return
+		}
+		fields["assignee"] = assignee
+	}
+	if dueAt := c.PostForm("due_at"); dueAt != "" {
+		t, err := time.ParseInLocation("2006-01-02 15:04:05", dueAt, time.Local)
+		if err != nil {
+			c.JSON(200, gin.H{
+				"code": 400,
+				"msg":  "截止时间格式不正确",
+			})
+			return
+		}
+		fields["due_at"] = &t
+	}
+	if len(fields) == 0 {
+		c.JSON(200, gin.H{
+			"code": 400,
+			"msg":  "参数不能为空",
+		})
+		return
+	}
+	models.UpdateTicket(ticket.ID, fields)
+	c.JSON(200, gin.H{
+		"code": 200,
+		"msg":  "ok",
+	})
+}
+
+// PostTicketReply 客服回复工单,通过邮件发送给访客
+func PostTicketReply(c *gin.Context) {
+	kefuName, _ := c.Get("kefu_name")
+	ticket, ok := findKefuTicket(c, c.PostForm("id"))
+	if !ok {
+		return
+	}
+	content := strings.TrimSpace(c.PostForm("content"))
+	if content == "" {
+		c.JSON(200, gin.H{
+			"code": 400,
+			"msg":  "内容不能为空",
+		})
+		return
+	}
+	redacted, ok := redactMessage(c, content)
+	if !ok {
+		return
+	}
+	content = redacted.Content
+	if ticket.Email == "" {
+		c.JSON(200, gin.H{
+			"code": 400,
+			"msg":  "访客没有留下邮箱,请通过电话联系:" + ticket.Phone,
+		})
+		return
+	}
+	body := strings.Replace(html.EscapeString(content), "\n", "<br>", -1) +
+		"<br><br>---<br>" + strings.Replace(html.EscapeString(ticket.Content), "\n", "<br>", -1)
+	err := SendKefuEmail(kefuName.(string), []string{ticket.Email}, tools.TicketSubject(ticket.ID, ticket.Subject), body)
+	if err != nil {
+		c.JSON(200, gin.H{
+			"code": 400,
+			"msg":  "邮件发送失败:" + err.Error(),
+		})
+		return
+	}
+	models.CreateTicketReply(ticket.ID, "kefu", kefuName.(string), content)
+	models.UpdateTicket(ticket.ID, map[string]interface{}{"status": models.TicketPending})
+	c.JSON(200, gin.H{
+		"code": 200,
+		"msg":  "ok",
+	})
+}
+
+// PostTicketInbound 收信回调,按标题中的工单号把访客回复归档到工单
+func PostTicketInbound(c *gin.Context) {
+	token := c.Query("token")
+	subject := c.PostForm("subject")
+	from := c.PostForm("from")
+	content := strings.TrimSpace(c.PostForm("content"))
+	ticket := models.FindTicketById(tools.ParseTicketId(subject))
+	if ticket.ID == 0 || content == "" {
+		c.JSON(200, gin.H{
+			"code": 400,
+			"msg":  "工单不存在",
+		})
+		return
+	}
+	inboundToken := models.FindConfigByUserId(ticket.KefuId, "TicketInboundToken").ConfValue
+	if inboundToken == "" || subtle.ConstantTimeCompare([]byte(token), []byte(inboundToken)) != 1 {
+		c.JSON(200, gin.H{
+			"code": 403,
+			"msg":  "验证失败",
+		})
+		return
+	}
+	addr, err := mail.ParseAddress(from)
+	if err != nil || !strings.EqualFold(addr.Address, ticket.Email) {
+		c.JSON(200, gin.H{
+			"code": 400,
+			"msg":  "发件人与工单不一致",
+		})
+		return
+	}
+	//邮件已经发出, 命中拒绝发送的规则时也只能打码后保存
+	content = tools.RedactText(content)
+	models.CreateTicketReply(ticket.ID, "visitor", ticket.Email, content)
+	models.UpdateTicket(ticket.ID, map[string]interface{}{"status": models.TicketOpen})
+	notice, _ := json.Marshal(ws.TypeMessage{
+		Type: "ticket",
+		Data: gin.H{
+			"id":      ticket.ID,
+			"name":    ticket.Name,
+			"content": content,
+		},
+	})
+	go ws.OneKefuMessage(ticket.Assignee, notice)
+	c.JSON(200, gin.H{
+		"code": 200,
+		"msg":  "ok",
+	})
+}
+
+// findKefuTicket 查找当前客服有权限处理的工单
+func findKefuTicket(c *gin.Context, id string) (models.Ticket, bool) {
+	kefuName, _ := c.Get("kefu_name")
+	ticket := models.FindTicketById(id)
+	if ticket.ID == 0 || (ticket.KefuId != kefuName && ticket.Assignee != kefuName) {
+		c.JSON(200, gin.H{
+			"code": 400,
+			"msg":  fmt.Sprintf("工单%s不存在", id),
+		})
+		return ticket, false
+	}
+	return ticket, true
+}
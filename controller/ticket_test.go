@@ -0,0 +1,48 @@
+package controller
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"goflylivechat/models"
+	"goflylivechat/models/dbtest"
+	"goflylivechat/tools"
+)
+
+// TestPostTicketRedactReject 留言内容命中拒绝发送的规则时不创建工单
+func TestPostTicketRedactReject(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	defer tools.SetRedactRules(nil)
+	if err := tools.SetRedactRules([]tools.RedactRule{{Name: tools.RedactCard, Label: "银行卡号", Policy: tools.RedactReject}}); err != nil {
+		t.Fatal(err)
+	}
+	// 没有预期任何数据库语句, 创建工单时用例失败
+	dbtest.Mock(t, &models.DB)
+
+	form := url.Values{
+		"to_id":   {"kefu1"},
+		"email":   {"visitor@example.com"},
+		"content": {"我的卡号4111 1111 1111 1111"},
+	}
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodPost, "/ticket", strings.NewReader(form.Encode()))
+	c.Request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	PostTicket(c)
+
+	var resp struct {
+		Code int    `json:"code"`
+		Msg  string `json:"msg"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Code != 400 || !strings.Contains(resp.Msg, "银行卡号") {
+		t.Fatalf("PostTicket = %s, want rejected", w.Body.String())
+	}
+}
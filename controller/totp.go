@@ -0,0 +1,269 @@
+package controller
+
+import (
+	"github.com/gin-gonic/gin"
+	"goflylivechat/common"
+	"goflylivechat/models"
+	"goflylivechat/tools"
+	"strings"
+	"time"
+)
+
+const (
+	totpIssuer        = "GoflyChat"
+	totpRecoveryCount = 10
+	mfaTokenExpire    = 5 * time.Minute
+)
+
+// totpRequired 管理员是否要求全部客服开启两步验证, 系统配置保存在user_id为空的config中
+func totpRequired() bool {
+	value := models.FindConfigByUserId("", "TotpRequired").ConfValue
+	return value == "1" || value == "true"
+}
+func hashRecoveryCode(code string) string {
+	return tools.Sha256(strings.ToLower(strings.TrimSpace(code)))
+}
+
+// newRecoveryCodes 生成恢复码, 返回明文和保存用的哈希
+func newRecoveryCodes() ([]string, []string) {
+	codes := tools.NewRecoveryCodes(totpRecoveryCount)
+	hashes := make([]string, len(codes))
+	for i, code := range codes {
+		hashes[i] = hashRecoveryCode(code)
+	}
+	return codes, hashes
+}
+
+// checkTotpCode 校验验证码或恢复码, 验证码不能重复使用
+func checkTotpCode(t models.UserTotp, code string, recoveryCode string) bool {
+	if t.ID == 0 || !tools.LimitFreqSingle("totp:"+t.UserName, 5, 60) {
+		return false
+	}
+	if recoveryCode != "" {
+		return t.Enabled == 1 && models.UseUserTotpRecoveryCode(t.UserName, hashRecoveryCode(recoveryCode))
+	}
+	counter, ok := tools.VerifyTotp(t.Secret, code, time.Now(), 1)
+	return ok && models.UseUserTotpCode(t.UserName, counter)
+}
+
+// loginTotpStep 密码校验通过后判断是否需要两步验证, 需要时返回给前端的第二步参数
+func loginTotpStep(info models.User) (gin.H, error) {
+	t := models.FindUserTotp(info.Name)
+	step := ""
+	result := gin.H{}
+	if t.Enabled == 1 {
+		step = "verify"
+	} else if totpRequired() {
+		step = "enroll"
+		secret := tools.NewTotpSecret()
+		models.SaveUserTotpSecret(info.Name, secret)
+		result["secret"] = secret
+		result["uri"] = tools.TotpUri(totpIssuer, info.Name, secret)
+	} else {
+		return nil, nil
+	}
+	mfaToken, err := tools.MakeToken(map[string]interface{}{
+		"kefu_name": info.Name,
+		"mfa":       step,
+	}, tools.TokenMfa, mfaTokenExpire)
+	if err != nil {
+		return nil, err
+	}
+	result["mfa"] = step
+	result["mfa_token"] = mfaToken
+	return result, nil
+}
+
+// PostCheckTotp 登录第二步, 校验验证码后签发令牌
+func PostCheckTotp(c *gin.Context) {
+	claims := tools.ParseToken(c.PostForm("mfa_token"), tools.TokenMfa)
+	if claims == nil || isClaimsRevoked(claims) {
+		c.JSON(200, gin.H{
+			"code": 401,
+			"msg":  "登录已过期,请重新登录",
+		})
+		return
+	}
+	kefuName, _ := claims["kefu_name"].(string)
+	info := models.FindUser(kefuName)
+	t := models.FindUserTotp(kefuName)
+	if info.ID == 0 || (t.Enabled == 0 && claims["mfa"] != "enroll") {
+		c.JSON(200, gin.H{
+			"code": 401,
+			"msg":  "登录已过期,请重新登录",
+		})
+		return
+	}
+	if wait := loginRetryAfter(kefuName, c.ClientIP()); wait > 0 {
+		c.JSON(200, gin.H{
+			"code": 429,
+			"msg":  "失败次数过多,请稍后再试",
+			"result": gin.H{
+				"retry_after": retryAfterSeconds(wait),
+			},
+		})
+		return
+	}
+	if !checkTotpCode(t, c.PostForm("code"), c.PostForm("recovery_code")) {
+		models.CreateLoginAttempt(kefuName, c.ClientIP(), false, "totp")
+		c.JSON(200, gin.H{
+			"code": 400,
+			"msg":  "验证码不正确",
+		})
+		return
+	}
+	models.CreateLoginAttempt(kefuName, c.ClientIP(), true, "totp")
+	revokeClaims(claims)
+	tokens, err := makeLoginTokens(info)
+	if err != nil {
+		c.JSON(200, gin.H{
+			"code": 500,
+			"msg":  err.Error(),
+		})
+		return
+	}
+	if t.Enabled == 0 {
+		codes, hashes := newRecoveryCodes()
+		models.EnableUserTotp(kefuName, hashes)
+		tokens["recovery_codes"] = codes
+	}
+	c.JSON(200, gin.H{
+		"code":   200,
+		"msg":    "ok",
+		"result": tokens,
+	})
+}
+func GetTotp(c *gin.Context) {
+	kefuName, _ := c.Get("kefu_name")
+	t := models.FindUserTotp(kefuName.(string))
+	c.JSON(200, gin.H{
+		"code": 200,
+		"msg":  "ok",
+		"result": gin.H{
+			"enabled":  t.Enabled == 1,
+			"required": totpRequired(),
+		},
+	})
+}
+
+// PostTotpSetup 生成新密钥, 需要PostTotpEnable校验验证码后才生效
+func PostTotpSetup(c *gin.Context) {
+	kefuName, _ := c.Get("kefu_name")
+	if models.FindUserTotp(kefuName.(string)).Enabled == 1 {
+		c.JSON(200, gin.H{
+			"code": 400,
+			"msg":  "已开启两步验证",
+		})
+		return
+	}
+	secret := tools.NewTotpSecret()
+	models.SaveUserTotpSecret(kefuName.(string), secret)
+	c.JSON(200, gin.H{
+		"code": 200,
+		"msg":  "ok",
+		"result": gin.H{
+			"secret": secret,
+			"uri":    tools.TotpUri(totpIssuer, kefuName.(string), secret),
+		},
+	})
+}
+func PostTotpEnable(c *gin.Context) {
+	kefuName, _ := c.Get("kefu_name")
+	t := models.FindUserTotp(kefuName.(string))
+	if t.ID == 0 || t.Enabled == 1 {
+		c.JSON(200, gin.H{
+			"code": 400,
+			"msg":  "请先生成密钥",
+		})
+		return
+	}
+	if !checkTotpCode(t, c.PostForm("code"), "") {
+		c.JSON(200, gin.H{
+			"code": 400,
+			"msg":  "验证码不正确",
+		})
+		return
+	}
+	codes, hashes := newRecoveryCodes()
+	models.EnableUserTotp(t.UserName, hashes)
+	c.JSON(200, gin.H{
+		"code":   200,
+		"msg":    "ok",
+		"result": codes,
+	})
+}
+
+// PostTotpRecovery 重新生成恢复码, 旧恢复码全部失效
+func PostTotpRecovery(c *gin.Context) {
+	kefuName, _ := c.Get("kefu_name")
+	t := models.FindUserTotp(kefuName.(string))
+	if t.Enabled != 1 || !checkTotpCode(t, c.PostForm("code"), "") {
+		c.JSON(200, gin.H{
+			"code": 400,
+			"msg":  "验证码不正确",
+		})
+		return
+	}
+	codes, hashes := newRecoveryCodes()
+	models.UpdateUserTotpRecoveryCodes(t.UserName, hashes)
+	c.JSON(200, gin.H{
+		"code":   200,
+		"msg":    "ok",
+		"result": codes,
+	})
+}
+func PostTotpDisable(c *gin.Context) {
+	kefuName, _ := c.Get("kefu_name")
+	if totpRequired() {
+		c.JSON(200, gin.H{
+			"code": 400,
+			"msg":  "管理员要求开启两步验证",
+		})
+		return
+	}
+	user := models.FindUser(kefuName.(string))
+	t := models.FindUserTotp(user.Name)
+	if ok, _ := tools.VerifyPassword(user.Password, c.PostForm("password")); !ok || !checkTotpCode(t, c.PostForm("code"), "") {
+		c.JSON(200, gin.H{
+			"code": 400,
+			"msg":  "密码或验证码不正确",
+		})
+		return
+	}
+	models.DeleteUserTotp(user.Name)
+	c.JSON(200, gin.H{
+		"code": 200,
+		"msg":  "ok",
+	})
+}
+
+// PostTotpReset 管理员重置客服的两步验证, 该客服需要重新登录
+func PostTotpReset(c *gin.Context) {
+	user := models.FindUserByUid(c.PostForm("user_id"))
+	if user.ID == 0 {
+		c.JSON(200, gin.H{
+			"code": 400,
+			"msg":  "客服不存在",
+		})
+		return
+	}
+	models.DeleteUserTotp(user.Name)
+	models.RevokeUserTokens(user.Name, time.Now().Add(common.RefreshTokenExpire()))
+	c.JSON(200, gin.H{
+		"code": 200,
+		"msg":  "ok",
+	})
+}
+
+// PostTotpPolicy 管理员设置是否强制全部客服开启两步验证
+func PostTotpPolicy(c *gin.Context) {
+	required := "0"
+	if c.PostForm("required") == "1" || c.PostForm("required") == "true" {
+		required = "1"
+	}
+	models.UpdateConfig("", "TotpRequired", required)
+	c.JSON(200, gin.H{
+		"code": 200,
+		"msg":  "ok",
+	})
+}
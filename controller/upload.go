@@ -0,0 +1,474 @@
+package controller
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"goflylivechat/common"
+	"goflylivechat/models"
+	"goflylivechat/tools"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 可以在浏览器中直接显示的上传文件, 其他文件一律作为附件下载
+var inlineUploadTypes = map[string]string{
+	".png":  "image/png",
+	".jpg":  "image/jpeg",
+	".gif":  "image/gif",
+	".webp": "image/webp",
+	".bmp":  "image/bmp",
+}
+
+var staticFS = gin.Dir("static", false)
+
+// UploadImg 上传图片, 只允许图片类型
+func UploadImg(c *gin.Context) {
+	saveUpload(c, "imgfile", true)
+}
+
+// UploadFile 上传附件
+func UploadFile(c *gin.Context) {
+	saveUpload(c, "realfile", false)
+}
+
+// saveUpload 按文件内容判断类型和大小限制, 检查每天的上传限额, 图片删除元数据后按内容哈希去重保存
+func saveUpload(c *gin.Context, field string, imageOnly bool) {
+	policy := common.GetUploadPolicy()
+	f, err := c.FormFile(field)
+	if err != nil {
+		msg := "上传失败!"
+		if c.Request.ContentLength > policy.MaxRequestSize() {
+			msg = "上传失败!文件过大"
+		}
+		c.JSON(200, gin.H{
+			"code": 400,
+			"msg":  msg,
+		})
+		return
+	}
+	src, err := f.Open()
+	if err != nil {
+		c.JSON(200, gin.H{
+			"code": 400,
+			"msg":  "上传失败!",
+		})
+		return
+	}
+	defer src.Close()
+	head := make([]byte, 512)
+	n, _ := io.ReadFull(src, head)
+	ctype, ext := tools.SniffUpload(head[:n], f.Filename)
+	if !policy.Allowed(ctype) || (imageOnly && !strings.HasPrefix(ctype, "image/")) {
+		c.JSON(200, gin.H{
+			"code": 400,
+			"msg":  "上传失败!不允许的文件类型: " + ctype,
+		})
+		return
+	}
+	if max := policy.MaxSize(ctype); f.Size > max {
+		c.JSON(200, gin.H{
+			"code": 400,
+			"msg":  fmt.Sprintf("上传失败!不允许超过%dM", max/1024/1024),
+		})
+		return
+	}
+	record := &models.UploadFile{
+		Name: uploadName(f.Filename),
+		Mime: ctype,
+		Size: f.Size,
+	}
+	if kefuName := c.GetString("kefu_name"); kefuName != "" {
+		record.KefuId = kefuName
+	} else {
+		record.VisitorId = c.GetString("visitor_id")
+	}
+	// 检查限额到保存上传记录之间不能有同一上传者的其他上传
+	defer uploadQuotas.lock(record)()
+	if err := checkUploadQuota(policy, record); err != nil {
+		c.JSON(200, gin.H{
+			"code": 400,
+			"msg":  "上传失败!" + err.Error(),
+		})
+		return
+	}
+	if _, err := src.Seek(0, io.SeekStart); err != nil {
+		c.JSON(200, gin.H{
+			"code": 400,
+			"msg":  "上传失败!",
+		})
+		return
+	}
+	// 开启病毒扫描时先扫描再保存, 发现病毒的文件只保存扫描记录
+	if scanner := common.GetUploadScanner(); scanner != nil {
+		res, err := scanner.Scan(src)
+		if err != nil {
+			log.Println("scan upload error:", err)
+		}
+		decision := common.GetAppConf().App.Scan.DecideScan(res, err)
+		record.ScanStatus = decision.Status
+		record.ScanResult = decision.Detail
+		if len(record.ScanResult) > 255 {
+			record.ScanResult = record.ScanResult[:255]
+		}
+		if decision.Reject {
+			msg := "上传失败!文件扫描失败, 请稍后再试"
+			if decision.Status == common.ScanInfected {
+				models.CreateUploadFile(record)
+				msg = "上传失败!文件含有病毒: " + decision.Detail
+			}
+			c.JSON(200, gin.H{
+				"code": 400,
+				"msg":  msg,
+			})
+			return
+		}
+		if _, err := src.Seek(0, io.SeekStart); err != nil {
+			c.JSON(200, gin.H{
+				"code": 400,
+				"msg":  "上传失败!",
+			})
+			return
+		}
+	}
+	var body io.ReadSeeker = src
+	var raw []byte
+	size := f.Size
+	if strings.HasPrefix(ctype, "image/") {
+		raw, err = io.ReadAll(src)
+		if err == nil {
+			raw, err = tools.StripImageMetadata(raw, ctype)
+		}
+		if err != nil {
+			c.JSON(200, gin.H{
+				"code": 400,
+				"msg":  "上传失败!" + err.Error(),
+			})
+			return
+		}
+		body = bytes.NewReader(raw)
+		size = int64(len(raw))
+	}
+	// 按内容的SHA-256保存, 相同内容只保存一份
+	hash := sha256.New()
+	_, err = io.Copy(hash, body)
+	if err == nil {
+		_, err = body.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		c.JSON(200, gin.H{
+			"code": 400,
+			"msg":  "上传失败!",
+		})
+		return
+	}
+	storage := common.GetStorage()
+	blob, key, err := saveUploadBlob(storage, hex.EncodeToString(hash.Sum(nil)), ext, body, size, uploadMeta(ext, ctype))
+	if err != nil {
+		log.Println("upload file error:", err)
+		c.JSON(200, gin.H{
+			"code": 400,
+			"msg":  "上传失败!",
+		})
+		return
+	}
+	filePath := blob.Path
+	record.Path = filePath
+	record.Hash = blob.Hash
+	record.Size = size
+	models.CreateUploadFile(record)
+	// path 为固定地址, 用于消息内容和头像, url 为有时效的下载地址
+	result := gin.H{
+		"path": filePath,
+	}
+	msg := "上传成功!"
+	if record.ScanStatus == common.ScanQuarantined {
+		// 隔离的文件审核通过前不返回下载地址, 也不生成缩略图
+		msg = "上传成功!文件需要客服审核后才能下载"
+		result["quarantined"] = true
+	} else {
+		result["url"], _ = storage.SignedURL(key, common.StorageUrlExpire(), downloadDisposition(ext, record.Name))
+		if imageOnly {
+			// 聊天中显示最小的缩略图, 点击后查看原图
+			result["thumb"], result["thumbs"] = saveThumbnails(storage, raw, record, policy.ThumbSizes)
+		}
+	}
+	if !imageOnly {
+		result["ext"] = ext
+		result["size"] = size
+		result["name"] = record.Name
+	}
+	c.JSON(200, gin.H{
+		"code":   200,
+		"msg":    msg,
+		"result": result,
+	})
+}
+
+// uploadQuotaMap 按上传者串行执行限额检查和保存, 否则并发上传会同时通过检查而超出限额
+// 锁只在当前进程中有效, 多个实例部署时仍可能少量超出限额
+type uploadQuotaMap struct {
+	sync.Mutex
+	locks map[string]*uploadQuotaLock
+}
+type uploadQuotaLock struct {
+	sync.Mutex
+	refs int
+}
+
+var uploadQuotas = &uploadQuotaMap{
+	locks: make(map[string]*uploadQuotaLock),
+}
+
+// lock 锁定上传者, 返回解锁函数, 没有人等待的锁在解锁时删除
+func (m *uploadQuotaMap) lock(record *models.UploadFile) func() {
+	column, id := uploadQuotaOwner(record)
+	if id == "" {
+		return func() {}
+	}
+	key := column + ":" + id
+	m.Lock()
+	l, ok := m.locks[key]
+	if !ok {
+		l = &uploadQuotaLock{}
+		m.locks[key] = l
+	}
+	l.refs++
+	m.Unlock()
+	l.Lock()
+	return func() {
+		l.Unlock()
+		m.Lock()
+		l.refs--
+		if l.refs == 0 {
+			delete(m.locks, key)
+		}
+		m.Unlock()
+	}
+}
+
+// uploadQuotaOwner 客服上传按客服统计, 否则按访客统计
+func uploadQuotaOwner(record *models.UploadFile) (string, string) {
+	if record.KefuId != "" {
+		return "kefu_id", record.KefuId
+	}
+	return "visitor_id", record.VisitorId
+}
+
+// checkUploadQuota 检查访客或客服当天的上传限额, 从当天0点开始计算
+// 调用方需要持有 uploadQuotas 中该上传者的锁直到保存上传记录
+func checkUploadQuota(policy common.UploadPolicy, record *models.UploadFile) error {
+	column, id := uploadQuotaOwner(record)
+	if id == "" {
+		return nil
+	}
+	maxFiles, maxBytes := policy.DailyQuota(record.KefuId != "")
+	now := time.Now()
+	usedFiles, usedBytes := models.UploadQuotaUsed(column, id, time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location()))
+	if maxFiles > 0 && usedFiles >= maxFiles {
+		return fmt.Errorf("今天已上传%d个文件, 达到上限", usedFiles)
+	}
+	if maxBytes > 0 && usedBytes+record.Size > maxBytes {
+		return fmt.Errorf("今天的上传总大小不能超过%dM", maxBytes/1024/1024)
+	}
+	return nil
+}
+
+// saveThumbnails 生成并保存缩略图, 返回聊天中显示的预览地址和各尺寸的地址
+// 缩略图同样按内容去重, 不支持的类型或生成失败时预览使用原图
+func saveThumbnails(storage tools.Storage, data []byte, original *models.UploadFile, sizes []int) (string, gin.H) {
+	preview := original.Path
+	thumbs := gin.H{}
+	if !tools.CanThumbnail(original.Mime) {
+		return preview, thumbs
+	}
+	list, err := tools.MakeThumbnails(data, sizes)
+	if err != nil {
+		log.Println("make thumbnail error:", err)
+		return preview, thumbs
+	}
+	for _, thumb := range list {
+		sum := sha256.Sum256(thumb.Data)
+		meta := tools.StorageMeta{ContentType: thumb.Mime, ContentDisposition: "inline"}
+		blob, _, err := saveUploadBlob(storage, hex.EncodeToString(sum[:]), thumb.Ext, bytes.NewReader(thumb.Data), int64(len(thumb.Data)), meta)
+		if err != nil {
+			log.Println("upload thumbnail error:", err)
+			continue
+		}
+		models.CreateUploadFile(&models.UploadFile{
+			Path:       blob.Path,
+			Name:       original.Name,
+			Mime:       thumb.Mime,
+			Size:       int64(len(thumb.Data)),
+			Hash:       blob.Hash,
+			ParentId:   original.ID,
+			VisitorId:  original.VisitorId,
+			KefuId:     original.KefuId,
+			ScanStatus: original.ScanStatus,
+			ScanResult: original.ScanResult,
+		})
+		thumbs[strconv.Itoa(thumb.Size)] = blob.Path
+		// 缩略图按尺寸从小到大排列
+		if preview == original.Path {
+			preview = blob.Path
+		}
+	}
+	return preview, thumbs
+}
+
+// saveUploadBlob 引用内容相同的文件, 没有时保存到 哈希前两位/哈希.扩展名
+func saveUploadBlob(storage tools.Storage, hash string, ext string, body io.Reader, size int64, meta tools.StorageMeta) (models.UploadBlob, string, error) {
+	key := hash[:2] + "/" + hash + ext
+	blob, _, err := models.AcquireUploadBlob(hash, key, size, func() error {
+		err := storage.Put(key, body, size, meta)
+		// 本地磁盘上已有的同名文件内容相同
+		if os.IsExist(err) {
+			return nil
+		}
+		return err
+	})
+	return blob, key, err
+}
+
+// uploadMeta 对象存储返回给浏览器的响应头, 非图片文件作为附件下载
+// 相同内容的文件共用一个对象, 不保存原文件名, 下载时由 downloadDisposition 指定
+func uploadMeta(ext string, ctype string) tools.StorageMeta {
+	if _, ok := inlineUploadTypes[ext]; ok {
+		return tools.StorageMeta{ContentType: ctype, ContentDisposition: "inline"}
+	}
+	return tools.StorageMeta{ContentType: ctype, ContentDisposition: "attachment"}
+}
+func attachmentDisposition(name string) string {
+	return "attachment; filename*=UTF-8''" + url.PathEscape(name)
+}
+
+// downloadDisposition 对象存储下载地址的文件名, 图片在浏览器中显示不需要文件名
+func downloadDisposition(ext string, name string) string {
+	if _, ok := inlineUploadTypes[ext]; ok || name == "" {
+		return ""
+	}
+	return attachmentDisposition(name)
+}
+
+// uploadName 原文件名只用于显示和下载, 去掉路径并限制长度
+func uploadName(name string) string {
+	name = filepath.Base(strings.ReplaceAll(name, "\\", "/"))
+	if runes := []rune(name); len(runes) > 100 {
+		name = string(runes[len(runes)-100:])
+	}
+	return name
+}
+
+// StaticFile 静态资源, 上传目录下的文件由 serveUpload 输出
+func StaticFile(c *gin.Context) {
+	name := path.Clean("/" + c.Param("filepath"))
+	if strings.HasPrefix(name, "/upload/") {
+		serveUpload(c, "static"+name)
+		return
+	}
+	c.FileFromFS(name, staticFS)
+}
+
+// serveUpload 输出上传文件, 本地磁盘上的文件直接输出, 包括切换到对象存储之前上传的文件
+// 对象存储中的文件跳转到有时效的下载地址, 隔离中的文件只能由客服在审核页面下载
+func serveUpload(c *gin.Context, ref string) {
+	key, ok := tools.UploadFileKey(common.Upload, ref)
+	if !ok {
+		c.Status(http.StatusNotFound)
+		return
+	}
+	record := models.FindUploadFileByPath(common.Upload + key)
+	if record.ScanStatus == common.ScanQuarantined && models.UploadPathQuarantined(record.Path) {
+		c.String(http.StatusForbidden, "文件正在审核")
+		return
+	}
+	// 共用文件的上传者使用了不同的文件名时按路径中的文件名下载
+	name := models.UploadPathName(record.Path)
+	p, _ := tools.UploadFilePath(common.Upload, ref)
+	if info, err := os.Stat(p); err == nil && info.Mode().IsRegular() {
+		serveLocalUpload(c, p, name)
+		return
+	}
+	storage := common.GetStorage()
+	if _, local := storage.(*tools.LocalStorage); local {
+		c.Status(http.StatusNotFound)
+		return
+	}
+	if name == "" {
+		name = path.Base(key)
+	}
+	signed, err := storage.SignedURL(key, common.StorageUrlExpire(), downloadDisposition(strings.ToLower(path.Ext(key)), name))
+	if err != nil {
+		c.Status(http.StatusNotFound)
+		return
+	}
+	c.Header("Cache-Control", "no-store")
+	c.Redirect(http.StatusFound, signed)
+}
+
+// serveLocalUpload 禁止浏览器猜测类型, 非图片文件作为附件下载, 避免在本站域名下执行
+func serveLocalUpload(c *gin.Context, p string, name string) {
+	c.Header("X-Content-Type-Options", "nosniff")
+	c.Header("Content-Security-Policy", "default-src 'none'; sandbox")
+	if ctype, ok := inlineUploadTypes[strings.ToLower(filepath.Ext(p))]; ok {
+		c.Header("Content-Type", ctype)
+		c.Header("Content-Disposition", "inline")
+	} else {
+		if name == "" {
+			name = filepath.Base(p)
+		}
+		c.Header("Content-Type", "application/octet-stream")
+		c.Header("Content-Disposition", attachmentDisposition(name))
+	}
+	http.ServeFile(c.Writer, c.Request, p)
+}
+
+// checkAvatar 头像只能是本站的内置图片或该客服自己上传的图片
+func checkAvatar(kefuName string, avatar string) error {
+	if strings.Contains(avatar, "://") || strings.HasPrefix(avatar, "//") {
+		return errors.New("头像地址无效")
+	}
+	if key, ok := tools.UploadFileKey(common.Upload, avatar); ok {
+		record := models.FindKefuUploadFile(kefuName, common.Upload+key)
+		if record.ID == 0 || !strings.HasPrefix(record.Mime, "image/") {
+			return errors.New("头像必须是自己上传的图片")
+		}
+		if record.ScanStatus == common.ScanQuarantined {
+			return errors.New("头像图片正在审核")
+		}
+		return nil
+	}
+	if !strings.HasPrefix(path.Clean("/"+avatar), "/static/images/") {
+		return errors.New("头像地址无效")
+	}
+	return nil
+}
+
+// GetUploadUsage 按客服统计上传文件占用的存储, 以及去重前后的总大小
+func GetUploadUsage(c *gin.Context) {
+	files, bytes := models.UploadFileStats()
+	storedFiles, storedBytes := models.UploadBlobStats()
+	c.JSON(200, gin.H{
+		"code": 200,
+		"msg":  "ok",
+		"result": gin.H{
+			"list":         models.FindUploadUsage(),
+			"files":        files,
+			"bytes":        bytes,
+			"stored_files": storedFiles,
+			"stored_bytes": storedBytes,
+		},
+	})
+}
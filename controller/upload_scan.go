@@ -0,0 +1,94 @@
+package controller
+
+import (
+	"github.com/gin-gonic/gin"
+	"goflylivechat/common"
+	"goflylivechat/models"
+	"io"
+	"strconv"
+)
+
+// GetUploadScans 上传文件的扫描记录, 默认列出隔离中的文件
+func GetUploadScans(c *gin.Context) {
+	page, _ := strconv.Atoi(c.Query("page"))
+	if page <= 0 {
+		page = 1
+	}
+	status := c.DefaultQuery("status", common.ScanQuarantined)
+	c.JSON(200, gin.H{
+		"code": 200,
+		"msg":  "ok",
+		"result": gin.H{
+			"list":     models.FindUploadFiles(uint(page), common.PageSize, "scan_status = ?", status),
+			"count":    models.CountUploadFiles("scan_status = ?", status),
+			"pagesize": common.PageSize,
+		},
+	})
+}
+
+// PostUploadScanApprove 审核通过隔离中的文件, 访客可以下载
+func PostUploadScanApprove(c *gin.Context) {
+	file, ok := quarantinedUpload(c)
+	if !ok {
+		return
+	}
+	models.UpdateUploadFileScanStatus(file.ID, common.ScanApproved)
+	saveAudit(c, AuditUploadApprove, file.Path, file.ScanResult, common.ScanApproved)
+	c.JSON(200, gin.H{
+		"code": 200,
+		"msg":  "ok",
+	})
+}
+
+// DeleteUploadScan 删除隔离中的文件
+func DeleteUploadScan(c *gin.Context) {
+	file, ok := quarantinedUpload(c)
+	if !ok {
+		return
+	}
+	models.DeleteUploadFile(file)
+	saveAudit(c, AuditUploadDelete, file.Path, file.ScanResult, nil)
+	c.JSON(200, gin.H{
+		"code": 200,
+		"msg":  "ok",
+	})
+}
+
+// GetUploadScanFile 客服下载隔离中的文件进行检查, 一律作为附件下载
+func GetUploadScanFile(c *gin.Context) {
+	file, ok := quarantinedUpload(c)
+	if !ok {
+		return
+	}
+	src, err := models.OpenUploadFile(file.Path)
+	if err != nil {
+		c.JSON(200, gin.H{
+			"code": 400,
+			"msg":  "文件不存在",
+		})
+		return
+	}
+	defer src.Close()
+	c.Header("X-Content-Type-Options", "nosniff")
+	c.Header("Content-Security-Policy", "default-src 'none'; sandbox")
+	c.Header("Content-Type", "application/octet-stream")
+	c.Header("Content-Disposition", attachmentDisposition(file.Name))
+	io.Copy(c.Writer, src)
+}
+
+// quarantinedUpload 按id查找隔离中的文件, 找不到时返回错误
+func quarantinedUpload(c *gin.Context) (models.UploadFile, bool) {
+	id, _ := strconv.Atoi(c.Query("id"))
+	if id == 0 {
+		id, _ = strconv.Atoi(c.PostForm("id"))
+	}
+	file := models.FindUploadFileById(uint(id))
+	if file.ID == 0 || file.ScanStatus != common.ScanQuarantined {
+		c.JSON(200, gin.H{
+			"code": 400,
+			"msg":  "文件不存在或不在隔离中",
+		})
+		return file, false
+	}
+	return file, true
+}
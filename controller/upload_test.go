@@ -0,0 +1,93 @@
+package controller
+
+import (
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"goflylivechat/common"
+	"goflylivechat/models"
+	"goflylivechat/models/dbtest"
+)
+
+func expectQuotaUsed(mock sqlmock.Sqlmock, column string, id string, files int64, bytes int64) {
+	mock.ExpectQuery("SELECT count\\(\\*\\) as files, coalesce\\(sum\\(size\\),0\\) as bytes FROM `upload_file` WHERE .*\\("+column+" = \\? and parent_id = 0").
+		WithArgs(id, sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"files", "bytes"}).AddRow(files, bytes))
+}
+
+func TestCheckUploadQuota(t *testing.T) {
+	const mb = 1024 * 1024
+	// 配置为0时使用默认限额, 访客100个文件200M, 客服1000个文件2048M
+	var policy common.UploadPolicy
+	cases := []struct {
+		name   string
+		record models.UploadFile
+		files  int64
+		bytes  int64
+		ok     bool
+	}{
+		{"visitor under quota", models.UploadFile{VisitorId: "v1", Size: mb}, 99, 100 * mb, true},
+		{"visitor files", models.UploadFile{VisitorId: "v1", Size: mb}, 100, 0, false},
+		{"visitor bytes", models.UploadFile{VisitorId: "v1", Size: 2 * mb}, 1, 199 * mb, false},
+		{"kefu default quota", models.UploadFile{KefuId: "kefu1", Size: mb}, 500, 1000 * mb, true},
+		{"kefu bytes", models.UploadFile{KefuId: "kefu1", Size: mb}, 1, 2048 * mb, false},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			mock := dbtest.Mock(t, &models.DB)
+			if tc.record.KefuId != "" {
+				expectQuotaUsed(mock, "kefu_id", tc.record.KefuId, tc.files, tc.bytes)
+			} else {
+				expectQuotaUsed(mock, "visitor_id", tc.record.VisitorId, tc.files, tc.bytes)
+			}
+			if err := checkUploadQuota(policy, &tc.record); (err == nil) != tc.ok {
+				t.Errorf("checkUploadQuota() == %v, want ok %v", err, tc.ok)
+			}
+		})
+	}
+
+	// 小于0时不限制
+	mock := dbtest.Mock(t, &models.DB)
+	expectQuotaUsed(mock, "visitor_id", "v1", 1000, 1000*mb)
+	unlimited := common.UploadPolicy{VisitorDailyFiles: -1, VisitorDailyMB: -1}
+	if err := checkUploadQuota(unlimited, &models.UploadFile{VisitorId: "v1", Size: mb}); err != nil {
+		t.Errorf("checkUploadQuota(unlimited) == %v", err)
+	}
+	// 没有上传者时不统计
+	if err := checkUploadQuota(policy, &models.UploadFile{Size: mb}); err != nil {
+		t.Errorf("checkUploadQuota(no owner) == %v", err)
+	}
+}
+
+// TestUploadQuotaLock 同一上传者的第二次上传等待第一次保存记录后才能检查限额
+func TestUploadQuotaLock(t *testing.T) {
+	record := &models.UploadFile{VisitorId: "v1"}
+	unlock := uploadQuotas.lock(record)
+	locked, done := make(chan struct{}), make(chan struct{})
+	go func() {
+		unlock := uploadQuotas.lock(record)
+		close(locked)
+		unlock()
+		close(done)
+	}()
+	// 其他上传者不受影响
+	uploadQuotas.lock(&models.UploadFile{VisitorId: "v2"})()
+	select {
+	case <-locked:
+		t.Fatal("second upload of the same visitor did not wait")
+	case <-time.After(50 * time.Millisecond):
+	}
+	unlock()
+	select {
+	case <-locked:
+	case <-time.After(time.Second):
+		t.Fatal("second upload was not unlocked")
+	}
+	<-done
+	uploadQuotas.Lock()
+	defer uploadQuotas.Unlock()
+	if len(uploadQuotas.locks) != 0 {
+		t.Errorf("uploadQuotas kept %d unused locks", len(uploadQuotas.locks))
+	}
+}
@@ -125,7 +125,43 @@ func PostVisitorLogin(c *gin.Context) {
 		})
 		return
 	}
+	//只能使用签名身份或访客令牌对应的访客ID, 不能直接指定他人的ID
+	identity, err := checkVisitorIdentity(c, kefuInfo.Name)
+	if err != nil {
+		c.JSON(200, gin.H{
+			"code": 403,
+			"msg":  err.Error(),
+		})
+		return
+	}
+	if identity != nil {
+		id = identityVisitorId(kefuInfo.Name, identity.UserId)
+		if identity.Name != "" {
+			name = identity.Name
+		}
+	} else if c.PostForm("visitor_id") != "" && !visitorTokenOwns(c, id) {
+		id = tools.Uuid()
+	}
 	visitor := models.FindVisitorByVistorId(id)
+	//售前表单
+	fields := models.FindPrechatFieldsByUserId(kefuInfo.Name)
+	prechat := c.PostForm("prechat")
+	var prechatValues map[string]string
+	if len(fields) > 0 && (prechat != "" || visitor.ID == 0 || len(models.FindVisitorAttrs(id)) == 0) {
+		var err error
+		prechatValues, err = checkPrechatForm(fields, prechat)
+		if err != nil {
+			c.JSON(200, gin.H{
+				"code":   400,
+				"msg":    err.Error(),
+				"result": gin.H{"prechat": fields},
+			})
+			return
+		}
+		if prechatValues["name"] != "" {
+			name = prechatValues["name"]
+		}
+	}
 	if visitor.Name != "" {
 		// 检查数据库中的路径是否已经有前缀
 		if !strings.HasPrefix(visitor.Avator, basePath) {
@@ -136,16 +172,46 @@ func PostVisitorLogin(c *gin.Context) {
 			avator = visitor.Avator
 		}
 		//更新状态上线，使用修正后的头像路径
-		models.UpdateVisitor(name, avator, id, 1, c.ClientIP(), c.ClientIP(), refer, extra)
+		err = models.UpdateVisitor(name, avator, id, 1, c.ClientIP(), c.ClientIP(), refer, extra)
 	} else {
 		// 新访客，直接使用动态生成的路径
-		models.CreateVisitor(name, avator, c.ClientIP(), toId, id, refer, city, client_ip, extra)
+		err = models.CreateVisitor(name, avator, c.ClientIP(), toId, id, refer, city, client_ip, extra)
+	}
+	if err != nil {
+		tools.Logger().Println("save visitor error:", id, err)
+		c.JSON(200, gin.H{
+			"code": 500,
+			"msg":  "访客保存失败",
+		})
+		return
 	}
 	visitor.Name = name
 	visitor.Avator = avator
 	visitor.ToId = toId
 	visitor.ClientIp = c.ClientIP()
 	visitor.VisitorId = id
+	if len(prechatValues) > 0 {
+		saveVisitorPrechat(id, fields, prechatValues)
+	}
+	if identity != nil {
+		saveVisitorAttr(id, "user_id", "用户ID", tools.FieldText, identity.UserId)
+		if identity.Email != "" {
+			saveVisitorAttr(id, "email", "邮箱", tools.FieldEmail, identity.Email)
+		}
+	}
+	//设备指纹, 用于按设备封禁
+	if fingerprint := c.PostForm("fingerprint"); fingerprint != "" && len(fingerprint) <= 64 {
+		saveVisitorAttr(id, "fingerprint", "设备指纹", tools.FieldText, fingerprint)
+	}
+	visitor.Attrs = models.FindVisitorAttrs(id)
+	visitor.Token, err = makeVisitorToken(id, toId)
+	if err != nil {
+		c.JSON(200, gin.H{
+			"code": 500,
+			"msg":  err.Error(),
+		})
+		return
+	}
 
 	//各种通知
 	go SendNoticeEmail(visitor.Name, " incoming!")
@@ -163,6 +229,7 @@ func PostVisitorLogin(c *gin.Context) {
 func GetVisitor(c *gin.Context) {
 	visitorId := c.Query("visitorId")
 	vistor := models.FindVisitorByVistorId(visitorId)
+	vistor.Attrs = models.FindVisitorAttrs(visitorId)
 	c.JSON(200, gin.H{
 		"code":   200,
 		"msg":    "ok",
@@ -207,7 +274,7 @@ func GetVisitors(c *gin.Context) {
 // @Failure 200 {object} controller.Response
 // @Router /messages [get]
 func GetVisitorMessage(c *gin.Context) {
-	visitorId := c.Query("visitorId")
+	visitorId := c.GetString("visitor_id")
 
 	query := "message.visitor_id= ?"
 	messages := models.FindMessageByWhere(query, visitorId)
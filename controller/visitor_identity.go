@@ -0,0 +1,72 @@
+package controller
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"goflylivechat/models"
+	"goflylivechat/tools"
+	"time"
+)
+
+const (
+	visitorTokenExpire    = 24 * time.Hour
+	visitorIdentityMaxAge = 24 * time.Hour
+)
+
+// 接入网站签名后的用户身份, 以base64编码的json通过identity参数传入
+type VisitorIdentityForm struct {
+	tools.VisitorIdentity
+	Signature string `json:"signature"`
+}
+
+// identityVisitorId 已登录用户对应固定的访客ID, 换设备后仍能看到历史消息
+func identityVisitorId(kefuName string, userId string) string {
+	return "u" + tools.Sha256(kefuName+":"+userId)
+}
+
+// checkVisitorIdentity 校验identity参数, 未传入时返回nil
+func checkVisitorIdentity(c *gin.Context, kefuName string) (*VisitorIdentityForm, error) {
+	raw := c.PostForm("identity")
+	if raw == "" {
+		return nil, nil
+	}
+	var form VisitorIdentityForm
+	if err := json.Unmarshal([]byte(tools.Base64Decode(raw)), &form); err != nil {
+		return nil, errors.New("invalid identity")
+	}
+	secret := models.FindConfigByUserId(kefuName, "VisitorIdentitySecret").ConfValue
+	if !tools.VerifyVisitorIdentity(secret, form.VisitorIdentity, form.Signature, time.Now(), visitorIdentityMaxAge) {
+		return nil, errors.New("invalid identity signature")
+	}
+	return &form, nil
+}
+
+// visitorTokenOwns 请求中的访客令牌是否属于该访客
+func visitorTokenOwns(c *gin.Context, visitorId string) bool {
+	token := c.GetHeader("visitor-token")
+	if token == "" {
+		token = c.PostForm("visitor_token")
+	}
+	claims := tools.ParseToken(token, tools.TokenVisitor)
+	return claims != nil && claims["visitor_id"] == visitorId
+}
+func makeVisitorToken(visitorId string, toId string) (string, error) {
+	return tools.MakeToken(map[string]interface{}{
+		"visitor_id": visitorId,
+		"to_id":      toId,
+	}, tools.TokenVisitor, visitorTokenExpire)
+}
+
+// PostVisitorIdentitySecret 重新生成身份签名密钥, 旧密钥立即失效
+func PostVisitorIdentitySecret(c *gin.Context) {
+	kefuName, _ := c.Get("kefu_name")
+	secret := tools.NewTokenId() + tools.NewTokenId()
+	models.UpdateConfig(kefuName, "VisitorIdentitySecret", secret)
+	saveAudit(c, AuditIdentitySecret, "VisitorIdentitySecret", nil, nil)
+	c.JSON(200, gin.H{
+		"code":   200,
+		"msg":    "ok",
+		"result": secret,
+	})
+}
@@ -2,12 +2,14 @@ DROP TABLE IF EXISTS `user`;
 CREATE TABLE `user` (
  `id` int(11) NOT NULL AUTO_INCREMENT,
  `name` varchar(50) NOT NULL DEFAULT '',
- `password` varchar(50) NOT NULL DEFAULT '',
+ `password` varchar(255) NOT NULL DEFAULT '',
  `nickname` varchar(50) NOT NULL DEFAULT '',
  `created_at` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
  `updated_at` timestamp NULL DEFAULT NULL,
  `deleted_at` timestamp NULL DEFAULT NULL,
  `avator` varchar(100) NOT NULL DEFAULT '',
+ `email` varchar(100) NOT NULL DEFAULT '',
+ `email_verified_at` timestamp NULL DEFAULT NULL,
  PRIMARY KEY (`id`),
  UNIQUE KEY `idx_name` (`name`)
 ) ENGINE=InnoDB DEFAULT CHARSET=utf8;
@@ -20,7 +22,7 @@ CREATE TABLE `visitor` (
  `id` int(11) NOT NULL AUTO_INCREMENT,
  `name` varchar(50) NOT NULL DEFAULT '',
  `avator` varchar(500) NOT NULL DEFAULT '',
- `source_ip` varchar(50) NOT NULL DEFAULT '',
+ `source_ip` varchar(255) NOT NULL DEFAULT '',
  `to_id` varchar(50) NOT NULL DEFAULT '',
  `created_at` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
  `updated_at` timestamp NULL DEFAULT NULL,
@@ -28,10 +30,10 @@ CREATE TABLE `visitor` (
  `visitor_id` varchar(100) NOT NULL DEFAULT '',
  `status` tinyint(4) NOT NULL DEFAULT '0',
  `refer` varchar(500) NOT NULL DEFAULT '',
- `last_message` varchar(500) NOT NULL DEFAULT '',
+ `last_message` text NOT NULL,
  `city` varchar(100) NOT NULL DEFAULT '',
- `client_ip` varchar(100) NOT NULL DEFAULT '',
- `extra` varchar(2048) NOT NULL DEFAULT '',
+ `client_ip` varchar(255) NOT NULL DEFAULT '',
+ `extra` text NOT NULL,
  PRIMARY KEY (`id`),
  UNIQUE KEY `visitor_id` (`visitor_id`),
  KEY `to_id` (`to_id`),
@@ -43,7 +45,7 @@ CREATE TABLE `message` (
  `id` int(11) NOT NULL AUTO_INCREMENT,
  `kefu_id` varchar(100) NOT NULL DEFAULT '',
  `visitor_id` varchar(100) NOT NULL DEFAULT '',
- `content` varchar(2048) NOT NULL DEFAULT '',
+ `content` text NOT NULL,
  `created_at` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
  `updated_at` timestamp NULL DEFAULT NULL,
  `deleted_at` timestamp NULL DEFAULT NULL,
@@ -58,10 +60,17 @@ DROP TABLE IF EXISTS `ipblack`;
 CREATE TABLE `ipblack` (
  `id` int(11) NOT NULL AUTO_INCREMENT,
  `ip` varchar(100) NOT NULL DEFAULT '',
+ `visitor_id` varchar(100) NOT NULL DEFAULT '',
+ `fingerprint` varchar(100) NOT NULL DEFAULT '',
+ `to_id` varchar(100) NOT NULL DEFAULT '',
+ `reason` varchar(500) NOT NULL DEFAULT '',
+ `expire_at` timestamp NULL DEFAULT NULL,
  `create_at` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
  `kefu_id` varchar(100) NOT NULL DEFAULT '',
  PRIMARY KEY (`id`),
- UNIQUE KEY `ip` (`ip`)
+ KEY `ip` (`ip`),
+ KEY `visitor_id` (`visitor_id`),
+ KEY `kefu_id` (`kefu_id`)
 ) ENGINE=InnoDB DEFAULT CHARSET=utf8;
 
 DROP TABLE IF EXISTS `config`;
@@ -110,4 +119,278 @@ CREATE TABLE `reply_item` (
  PRIMARY KEY (`id`),
  KEY `user_id` (`user_id`),
  KEY `group_id` (`group_id`)
-) ENGINE=InnoDB DEFAULT CHARSET=utf8;
\ No newline at end of file
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;
+
+DROP TABLE IF EXISTS `prechat_field`;
+CREATE TABLE `prechat_field` (
+ `id` int(11) NOT NULL AUTO_INCREMENT,
+ `user_id` varchar(50) NOT NULL DEFAULT '',
+ `field_key` varchar(50) NOT NULL DEFAULT '',
+ `label` varchar(100) NOT NULL DEFAULT '',
+ `field_type` varchar(20) NOT NULL DEFAULT 'text',
+ `options` varchar(1024) NOT NULL DEFAULT '',
+ `pattern` varchar(255) NOT NULL DEFAULT '',
+ `required` tinyint(4) NOT NULL DEFAULT '0',
+ `sort` int(11) NOT NULL DEFAULT '0',
+ `created_at` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+ PRIMARY KEY (`id`),
+ KEY `user_id` (`user_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+DROP TABLE IF EXISTS `visitor_attr`;
+CREATE TABLE `visitor_attr` (
+ `id` int(11) NOT NULL AUTO_INCREMENT,
+ `visitor_id` varchar(100) NOT NULL DEFAULT '',
+ `attr_key` varchar(50) NOT NULL DEFAULT '',
+ `attr_label` varchar(100) NOT NULL DEFAULT '',
+ `attr_type` varchar(20) NOT NULL DEFAULT 'text',
+ `attr_value` varchar(1024) NOT NULL DEFAULT '',
+ `attr_index` varchar(64) NOT NULL DEFAULT '',
+ `updated_at` timestamp NULL DEFAULT NULL,
+ PRIMARY KEY (`id`),
+ UNIQUE KEY `idx_visitor_attr` (`visitor_id`,`attr_key`),
+ KEY `attr_value` (`attr_value`(100)),
+ KEY `attr_index` (`attr_index`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+DROP TABLE IF EXISTS `rate`;
+CREATE TABLE `rate` (
+ `id` int(11) NOT NULL AUTO_INCREMENT,
+ `conversation_id` varchar(100) NOT NULL DEFAULT '',
+ `visitor_id` varchar(100) NOT NULL DEFAULT '',
+ `kefu_id` varchar(100) NOT NULL DEFAULT '',
+ `rate_type` varchar(10) NOT NULL DEFAULT 'star',
+ `score` tinyint(4) NOT NULL DEFAULT '0',
+ `comment` varchar(1024) NOT NULL DEFAULT '',
+ `created_at` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+ `rated_at` timestamp NULL DEFAULT NULL,
+ PRIMARY KEY (`id`),
+ UNIQUE KEY `conversation_id` (`conversation_id`),
+ KEY `idx_kefu_rated` (`kefu_id`,`rated_at`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+DROP TABLE IF EXISTS `ticket`;
+CREATE TABLE `ticket` (
+ `id` int(11) NOT NULL AUTO_INCREMENT,
+ `visitor_id` varchar(100) NOT NULL DEFAULT '',
+ `kefu_id` varchar(100) NOT NULL DEFAULT '',
+ `assignee` varchar(100) NOT NULL DEFAULT '',
+ `name` varchar(100) NOT NULL DEFAULT '',
+ `email` varchar(255) NOT NULL DEFAULT '',
+ `phone` varchar(50) NOT NULL DEFAULT '',
+ `subject` varchar(255) NOT NULL DEFAULT '',
+ `content` text NOT NULL,
+ `status` enum('open','pending','closed') NOT NULL DEFAULT 'open',
+ `due_at` timestamp NULL DEFAULT NULL,
+ `created_at` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+ `updated_at` timestamp NULL DEFAULT NULL,
+ `deleted_at` timestamp NULL DEFAULT NULL,
+ PRIMARY KEY (`id`),
+ KEY `kefu_id` (`kefu_id`),
+ KEY `assignee` (`assignee`),
+ KEY `visitor_id` (`visitor_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+DROP TABLE IF EXISTS `ticket_reply`;
+CREATE TABLE `ticket_reply` (
+ `id` int(11) NOT NULL AUTO_INCREMENT,
+ `ticket_id` int(11) NOT NULL DEFAULT '0',
+ `from_type` enum('kefu','visitor') NOT NULL DEFAULT 'visitor',
+ `from_id` varchar(255) NOT NULL DEFAULT '',
+ `content` text NOT NULL,
+ `created_at` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+ PRIMARY KEY (`id`),
+ KEY `ticket_id` (`ticket_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+DROP TABLE IF EXISTS `invite_rule`;
+CREATE TABLE `invite_rule` (
+ `id` int(11) NOT NULL AUTO_INCREMENT,
+ `user_id` varchar(50) NOT NULL DEFAULT '',
+ `name` varchar(100) NOT NULL DEFAULT '',
+ `url_pattern` varchar(500) NOT NULL DEFAULT '',
+ `min_seconds` int(11) NOT NULL DEFAULT '0',
+ `min_pages` int(11) NOT NULL DEFAULT '0',
+ `returning` tinyint(4) NOT NULL DEFAULT '0',
+ `from_kefu` varchar(50) NOT NULL DEFAULT '',
+ `content` varchar(1024) NOT NULL DEFAULT '',
+ `enabled` tinyint(4) NOT NULL DEFAULT '1',
+ `created_at` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+ PRIMARY KEY (`id`),
+ KEY `user_id` (`user_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+DROP TABLE IF EXISTS `invite_log`;
+CREATE TABLE `invite_log` (
+ `id` int(11) NOT NULL AUTO_INCREMENT,
+ `rule_id` int(11) NOT NULL DEFAULT '0',
+ `visitor_id` varchar(100) NOT NULL DEFAULT '',
+ `kefu_id` varchar(100) NOT NULL DEFAULT '',
+ `status` enum('sent','accepted') NOT NULL DEFAULT 'sent',
+ `created_at` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+ `accepted_at` timestamp NULL DEFAULT NULL,
+ PRIMARY KEY (`id`),
+ KEY `visitor_id` (`visitor_id`),
+ KEY `idx_kefu_rule` (`kefu_id`,`rule_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+DROP TABLE IF EXISTS `schedule_message`;
+CREATE TABLE `schedule_message` (
+ `id` int(11) NOT NULL AUTO_INCREMENT,
+ `kefu_id` varchar(100) NOT NULL DEFAULT '',
+ `visitor_id` varchar(100) NOT NULL DEFAULT '',
+ `content` varchar(2048) NOT NULL DEFAULT '',
+ `send_at` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+ `status` enum('pending','sending','sent','canceled') NOT NULL DEFAULT 'pending',
+ `delivery` varchar(20) NOT NULL DEFAULT '',
+ `created_at` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+ `sent_at` timestamp NULL DEFAULT NULL,
+ PRIMARY KEY (`id`),
+ KEY `idx_status_send` (`status`,`send_at`),
+ KEY `kefu_id` (`kefu_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+DROP TABLE IF EXISTS `role`;
+CREATE TABLE `role` (
+ `id` int(11) NOT NULL AUTO_INCREMENT,
+ `name` varchar(100) NOT NULL DEFAULT '',
+ PRIMARY KEY (`id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+INSERT INTO `role` (`id`, `name`) VALUES
+(1, '超级管理员'),
+(2, '客服');
+
+DROP TABLE IF EXISTS `role_permission`;
+CREATE TABLE `role_permission` (
+ `id` int(11) NOT NULL AUTO_INCREMENT,
+ `role_id` int(11) NOT NULL DEFAULT '0',
+ `permission` varchar(50) NOT NULL DEFAULT '',
+ `created_at` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+ PRIMARY KEY (`id`),
+ UNIQUE KEY `idx_role_permission` (`role_id`,`permission`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+INSERT INTO `role_permission` (`role_id`, `permission`) VALUES
+(1, '*'),
+(2, 'profile'),
+(2, 'config'),
+(2, 'reply'),
+(2, 'prechat'),
+(2, 'invite'),
+(2, 'ipblack');
+
+DROP TABLE IF EXISTS `user_role`;
+CREATE TABLE `user_role` (
+ `id` int(11) NOT NULL AUTO_INCREMENT,
+ `user_id` varchar(50) NOT NULL DEFAULT '',
+ `role_id` int(11) NOT NULL DEFAULT '0',
+ PRIMARY KEY (`id`),
+ UNIQUE KEY `idx_user` (`user_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+INSERT INTO `user_role` (`user_id`, `role_id`) VALUES
+('1', 1);
+
+DROP TABLE IF EXISTS `token_revoke`;
+CREATE TABLE `token_revoke` (
+ `id` int(11) NOT NULL AUTO_INCREMENT,
+ `jti` varchar(64) NOT NULL DEFAULT '',
+ `kefu_name` varchar(50) NOT NULL DEFAULT '',
+ `expires_at` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+ `created_at` timestamp(3) NOT NULL DEFAULT CURRENT_TIMESTAMP(3),
+ PRIMARY KEY (`id`),
+ KEY `jti` (`jti`),
+ KEY `kefu_name` (`kefu_name`),
+ KEY `expires_at` (`expires_at`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+DROP TABLE IF EXISTS `user_totp`;
+CREATE TABLE `user_totp` (
+ `id` int(11) NOT NULL AUTO_INCREMENT,
+ `user_name` varchar(50) NOT NULL DEFAULT '',
+ `secret` varchar(64) NOT NULL DEFAULT '',
+ `enabled` tinyint(4) NOT NULL DEFAULT '0',
+ `recovery_codes` varchar(1024) NOT NULL DEFAULT '',
+ `last_counter` bigint(20) unsigned NOT NULL DEFAULT '0',
+ `created_at` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+ `updated_at` timestamp NULL DEFAULT NULL,
+ PRIMARY KEY (`id`),
+ UNIQUE KEY `idx_user_name` (`user_name`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+DROP TABLE IF EXISTS `login_attempt`;
+CREATE TABLE `login_attempt` (
+ `id` int(11) NOT NULL AUTO_INCREMENT,
+ `username` varchar(50) NOT NULL DEFAULT '',
+ `ip` varchar(64) NOT NULL DEFAULT '',
+ `success` tinyint(4) NOT NULL DEFAULT '0',
+ `reason` varchar(50) NOT NULL DEFAULT '',
+ `created_at` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+ PRIMARY KEY (`id`),
+ KEY `idx_username` (`username`,`created_at`),
+ KEY `idx_ip` (`ip`,`created_at`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+DROP TABLE IF EXISTS `register_invite`;
+CREATE TABLE `register_invite` (
+ `id` int(11) NOT NULL AUTO_INCREMENT,
+ `jti` varchar(64) NOT NULL DEFAULT '',
+ `email` varchar(100) NOT NULL DEFAULT '',
+ `role_id` int(11) NOT NULL DEFAULT '0',
+ `created_by` varchar(50) NOT NULL DEFAULT '',
+ `used_by` varchar(50) NOT NULL DEFAULT '',
+ `used_at` timestamp NULL DEFAULT NULL,
+ `expires_at` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+ `created_at` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+ PRIMARY KEY (`id`),
+ UNIQUE KEY `idx_jti` (`jti`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+DROP TABLE IF EXISTS `audit`;
+CREATE TABLE `audit` (
+ `id` int(11) NOT NULL AUTO_INCREMENT,
+ `actor` varchar(50) NOT NULL DEFAULT '',
+ `action` varchar(50) NOT NULL DEFAULT '',
+ `target` varchar(255) NOT NULL DEFAULT '',
+ `before_value` text,
+ `after_value` text,
+ `ip` varchar(100) NOT NULL DEFAULT '',
+ `user_agent` varchar(500) NOT NULL DEFAULT '',
+ `created_at` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+ PRIMARY KEY (`id`),
+ KEY `idx_actor` (`actor`,`created_at`),
+ KEY `idx_action` (`action`,`created_at`),
+ KEY `idx_created_at` (`created_at`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+DROP TABLE IF EXISTS `upload_file`;
+CREATE TABLE `upload_file` (
+ `id` int(11) NOT NULL AUTO_INCREMENT,
+ `path` varchar(255) NOT NULL DEFAULT '',
+ `name` varchar(255) NOT NULL DEFAULT '',
+ `mime` varchar(100) NOT NULL DEFAULT '',
+ `size` bigint(20) NOT NULL DEFAULT '0',
+ `hash` char(64) NOT NULL DEFAULT '',
+ `parent_id` int(11) NOT NULL DEFAULT '0',
+ `visitor_id` varchar(100) NOT NULL DEFAULT '',
+ `kefu_id` varchar(100) NOT NULL DEFAULT '',
+ `scan_status` varchar(20) NOT NULL DEFAULT '',
+ `scan_result` varchar(255) NOT NULL DEFAULT '',
+ `created_at` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+ PRIMARY KEY (`id`),
+ KEY `path` (`path`),
+ KEY `hash` (`hash`),
+ KEY `visitor_id` (`visitor_id`),
+ KEY `kefu_id` (`kefu_id`),
+ KEY `scan_status` (`scan_status`),
+ KEY `created_at` (`created_at`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+DROP TABLE IF EXISTS `upload_blob`;
+CREATE TABLE `upload_blob` (
+ `id` int(11) NOT NULL AUTO_INCREMENT,
+ `hash` char(64) NOT NULL DEFAULT '',
+ `path` varchar(255) NOT NULL DEFAULT '',
+ `size` bigint(20) NOT NULL DEFAULT '0',
+ `ref_count` int(11) NOT NULL DEFAULT '0',
+ `created_at` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+ PRIMARY KEY (`id`),
+ UNIQUE KEY `hash` (`hash`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
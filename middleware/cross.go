@@ -1,16 +1,52 @@
 package middleware
 
-import "github.com/gin-gonic/gin"
+import (
+	"github.com/gin-gonic/gin"
+	"goflylivechat/models"
+	"goflylivechat/tools"
+	"net/http"
+)
 
+// corsOriginAllowed 跨域来源是否在允许列表中, 预检请求不带参数, 按全部客服和站点的列表判断
+func corsOriginAllowed(c *gin.Context, origin string) bool {
+	if tools.SameOrigin(origin, c.Request) {
+		return true
+	}
+	host := tools.OriginHost(origin)
+	if c.Request.Method == http.MethodOptions {
+		for _, value := range models.FindAllAllowedDomains() {
+			if tools.MatchDomains(tools.SplitDomains(value), host) {
+				return true
+			}
+		}
+		return false
+	}
+	return tools.MatchDomains(tools.SplitDomains(models.FindAllowedDomains(requestKefuId(c, c.GetString("visitor_id")))), host)
+}
+
+// CrossSite 跨域设置, 未配置允许域名时允许任意来源但不允许携带cookie
+// 配置后只对允许的来源回显Origin并允许携带cookie
 func CrossSite(c *gin.Context) {
-	c.Writer.Header().Set("Access-Control-Allow-Origin", "*")
+	origin := c.GetHeader("Origin")
+	if origin != "" {
+		if len(models.FindAllAllowedDomains()) == 0 {
+			c.Header("Access-Control-Allow-Origin", "*")
+		} else if corsOriginAllowed(c, origin) {
+			c.Header("Access-Control-Allow-Origin", origin)
+			//允许客户端传递校验信息比如 cookie (重要)
+			c.Header("Access-Control-Allow-Credentials", "true")
+		}
+		c.Header("Vary", "Origin")
+	}
 	//服务器支持的所有跨域请求的方法
 	c.Header("Access-Control-Allow-Methods", "POST, GET, OPTIONS, PUT, DELETE,UPDATE")
 	//允许跨域设置可以返回其他子段，可以自定义字段
-	c.Header("Access-Control-Allow-Headers", "Authorization, Content-Length, X-CSRF-Token, Token,session")
+	c.Header("Access-Control-Allow-Headers", "Authorization, Content-Length, X-CSRF-Token, Token,session,Visitor-Token,Visitor-Fingerprint")
 	// 允许浏览器（客户端）可以解析的头部 （重要）
 	c.Header("Access-Control-Expose-Headers", "Content-Length, Access-Control-Allow-Origin, Access-Control-Allow-Headers")
-	//允许客户端传递校验信息比如 cookie (重要)
-	c.Header("Access-Control-Allow-Credentials", "true")
+	if c.Request.Method == http.MethodOptions {
+		c.AbortWithStatus(http.StatusNoContent)
+		return
+	}
 	c.Next()
 }
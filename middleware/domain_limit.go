@@ -2,11 +2,67 @@ package middleware
 
 import (
 	"github.com/gin-gonic/gin"
+	"goflylivechat/common"
+	"goflylivechat/models"
+	"goflylivechat/tools"
+	"strings"
 )
 
-/**
-域名中间件
-*/
-func DomainLimitMiddleware(c *gin.Context) {
+// 访客登录前还没有所属客服, 这些接口使用请求中要联系的客服
+// /livechat 是嵌入页面的入口, 之后的请求都来自本站的iframe, 只有这里能按客服的域名列表检查嵌入的网站
+var preLoginPaths = map[string]bool{
+	"/livechat":      true,
+	"/visitor_login": true,
+	"/prechat_form":  true,
+}
+
+// requestKefuId 访客接口对应的客服账号, 用于查找该客服允许的域名和黑名单
+// 请求参数可以由访客任意填写, 只有登录前的接口才使用; 其他接口按访客ID查找访客所属的客服
+func requestKefuId(c *gin.Context, visitorId string) string {
+	path := c.FullPath()
+	if prefix := common.GetPrefix(); prefix != "" && strings.HasPrefix(path, prefix+"/") {
+		path = strings.TrimPrefix(path, prefix)
+	}
+	if preLoginPaths[path] {
+		for _, id := range []string{c.PostForm("to_id"), c.Query("to_id"), c.Query("kefu_id"), c.Query("user_id")} {
+			if id != "" {
+				return id
+			}
+		}
+		return ""
+	}
+	if visitorId != "" {
+		return models.FindVisitorByVistorId(visitorId).ToId
+	}
+	return ""
+}
 
+// requestOrigin 请求来源, 没有Origin时使用Referer
+func requestOrigin(c *gin.Context) string {
+	if origin := c.GetHeader("Origin"); origin != "" {
+		return origin
+	}
+	return c.GetHeader("Referer")
+}
+
+// DomainLimitMiddleware 域名中间件
+// 客服或站点配置了允许的域名后, 只有这些域名下的页面可以嵌入客服窗口和调用访客接口, 未配置时不限制
+func DomainLimitMiddleware(c *gin.Context) {
+	domains := tools.SplitDomains(models.FindAllowedDomains(requestKefuId(c, c.GetString("visitor_id"))))
+	if len(domains) == 0 {
+		c.Request = tools.WithOriginAllowed(c.Request)
+		return
+	}
+	c.Header("Content-Security-Policy", "frame-ancestors 'self' "+strings.Join(domains, " "))
+	origin := requestOrigin(c)
+	// 浏览器发起的请求都会带Origin或Referer, 缺失时由frame-ancestors限制嵌入
+	if origin == "" || tools.SameOrigin(origin, c.Request) || tools.MatchDomains(domains, tools.OriginHost(origin)) {
+		c.Request = tools.WithOriginAllowed(c.Request)
+		return
+	}
+	c.JSON(403, gin.H{
+		"code": 403,
+		"msg":  "域名不在允许列表中",
+	})
+	c.Abort()
 }
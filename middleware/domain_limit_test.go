@@ -0,0 +1,43 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gin-gonic/gin"
+	"goflylivechat/models"
+	"goflylivechat/models/dbtest"
+)
+
+// TestDomainLimitLivechat 嵌入页面按user_id对应客服的域名列表检查来源网站
+func TestDomainLimitLivechat(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	engine := gin.New()
+	engine.GET("/livechat", DomainLimitMiddleware, func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+	cases := []struct {
+		referer string
+		want    int
+	}{
+		{"https://evil.example/page", http.StatusForbidden},
+		{"https://shop.example/page", http.StatusOK},
+	}
+	for _, tc := range cases {
+		mock := dbtest.Mock(t, &models.DB)
+		mock.ExpectQuery("SELECT \\* FROM `config` WHERE \\(user_id = \\? and conf_key = \\?\\)").WithArgs("kefu1", "AllowedDomains").
+			WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "conf_key", "conf_value"}).AddRow(1, "kefu1", "AllowedDomains", "shop.example"))
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/livechat?user_id=kefu1", nil)
+		req.Header.Set("Referer", tc.referer)
+		engine.ServeHTTP(w, req)
+		if w.Code != tc.want {
+			t.Errorf("/livechat from %s: status %d, want %d", tc.referer, w.Code, tc.want)
+		}
+		if csp := w.Header().Get("Content-Security-Policy"); csp != "frame-ancestors 'self' shop.example" {
+			t.Errorf("Content-Security-Policy = %q", csp)
+		}
+	}
+}
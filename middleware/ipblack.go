@@ -3,14 +3,41 @@ package middleware
 import (
 	"github.com/gin-gonic/gin"
 	"goflylivechat/models"
+	"goflylivechat/tools"
+	"net/http"
 )
 
+// requestFingerprint 访客设备指纹, 依次从请求头、查询参数、表单中获取
+func requestFingerprint(c *gin.Context) string {
+	if fingerprint := c.GetHeader("visitor-fingerprint"); fingerprint != "" {
+		return fingerprint
+	}
+	if fingerprint := c.Query("fingerprint"); fingerprint != "" {
+		return fingerprint
+	}
+	return c.PostForm("fingerprint")
+}
+
+// Ipblack 黑名单中间件, 按IP网段、访客ID和设备指纹匹配内存中的黑名单
+// 只对某个客服生效的封禁, 仅在请求的是该客服的访客接口时拦截
+// 中间件在VisitorAuth之前执行, 访客ID从访客令牌中解析
 func Ipblack(c *gin.Context) {
-	ip := c.ClientIP()
-	ipblack := models.FindIp(ip)
-	if ipblack.IP != "" {
-		c.JSON(200, gin.H{
-			"code": 400,
+	visitorId := requestVisitorId(c)
+	if claims := tools.ParseToken(requestVisitorToken(c), tools.TokenVisitor); claims != nil {
+		visitorId, _ = claims["visitor_id"].(string)
+	}
+	kefuId, kefuLoaded := "", false
+	for _, black := range models.MatchIpblacks(c.ClientIP(), visitorId, requestFingerprint(c)) {
+		if black.ToId != "" {
+			if !kefuLoaded {
+				kefuId, kefuLoaded = requestKefuId(c, visitorId), true
+			}
+			if black.ToId != kefuId {
+				continue
+			}
+		}
+		c.JSON(http.StatusForbidden, gin.H{
+			"code": 403,
 			"msg":  "IP已被加入黑名单",
 		})
 		c.Abort()
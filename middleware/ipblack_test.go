@@ -0,0 +1,77 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gin-gonic/gin"
+	"goflylivechat/models"
+	"goflylivechat/models/dbtest"
+	"goflylivechat/tools"
+)
+
+// loadIpblacks 用sqlmock返回的封禁记录刷新黑名单缓存
+func loadIpblacks(mock sqlmock.Sqlmock, visitorId, toId string) {
+	mock.ExpectQuery("SELECT \\* FROM `ipblack`").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "visitor_id", "to_id"}).AddRow(1, visitorId, toId))
+	models.RefreshIpblacks()
+}
+
+func TestIpblackScopedBan(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	key := tools.RandomJwtKey()
+	if err := tools.SetJwtKeys([]tools.JwtKey{key}, key.Kid); err != nil {
+		t.Fatal(err)
+	}
+	token, err := tools.MakeToken(map[string]interface{}{"visitor_id": "v1"}, tools.TokenVisitor, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	engine := gin.New()
+	ok := func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	}
+	engine.POST("/message", Ipblack, ok)
+	engine.POST("/visitor_login", Ipblack, ok)
+
+	cases := []struct {
+		name    string
+		path    string
+		visitor string
+		banBy   string
+		toId    string
+		want    int
+	}{
+		// 被kefuA封禁的访客填写其他客服的to_id, 仍按访客所属的kefuA拦截
+		{"foreign to_id", "/message", "kefuA", "kefuA", "kefuB", http.StatusForbidden},
+		{"own agent", "/message", "kefuA", "kefuA", "kefuA", http.StatusForbidden},
+		{"other agent's ban", "/message", "kefuA", "kefuB", "kefuB", http.StatusOK},
+		// 登录时还没有所属客服, 按要联系的客服判断
+		{"login to banning agent", "/visitor_login", "", "kefuA", "kefuA", http.StatusForbidden},
+		{"login to other agent", "/visitor_login", "", "kefuA", "kefuB", http.StatusOK},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			mock := dbtest.Mock(t, &models.DB)
+			loadIpblacks(mock, "v1", tc.banBy)
+			if tc.visitor != "" {
+				mock.ExpectQuery("SELECT \\* FROM `visitor`").WithArgs("v1").
+					WillReturnRows(sqlmock.NewRows([]string{"id", "visitor_id", "to_id"}).AddRow(1, "v1", tc.visitor))
+			}
+			form := url.Values{"to_id": {tc.toId}, "type": {"visitor"}, "from_id": {"v1"}}
+			req := httptest.NewRequest(http.MethodPost, tc.path, strings.NewReader(form.Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			req.Header.Set("visitor-token", token)
+			w := httptest.NewRecorder()
+			engine.ServeHTTP(w, req)
+			if w.Code != tc.want {
+				t.Errorf("status %d, want %d: %s", w.Code, tc.want, w.Body.String())
+			}
+		})
+	}
+}
@@ -2,6 +2,7 @@ package middleware
 
 import (
 	"github.com/gin-gonic/gin"
+	"goflylivechat/models"
 	"goflylivechat/tools"
 	"time"
 )
@@ -20,8 +21,8 @@ func JwtApiMiddleware(c *gin.Context) {
 	if token == "" {
 		token = c.Query("token")
 	}
-	userinfo := tools.ParseToken(token)
-	if userinfo == nil || userinfo["kefu_name"] == nil || userinfo["create_time"] == nil {
+	userinfo := tools.ParseToken(token, tools.TokenAccess)
+	if userinfo == nil || userinfo["kefu_name"] == nil {
 		c.JSON(200, gin.H{
 			"code": 400,
 			"msg":  "验证失败",
@@ -29,17 +30,20 @@ func JwtApiMiddleware(c *gin.Context) {
 		c.Abort()
 		return
 	}
-	createTime := int64(userinfo["create_time"].(float64))
-	var expire int64 = 24 * 60 * 60
-	nowTime := time.Now().Unix()
-	if (nowTime - createTime) >= expire {
+	jti, _ := userinfo["jti"].(string)
+	kefuName, _ := userinfo["kefu_name"].(string)
+	exp, _ := userinfo["exp"].(float64)
+	if models.IsTokenRevoked(jti, kefuName, tools.TokenIssuedAt(userinfo)) {
 		c.JSON(200, gin.H{
 			"code": 401,
 			"msg":  "token失效",
 		})
 		c.Abort()
+		return
 	}
 	c.Set("kefu_id", userinfo["kefu_id"])
 	c.Set("kefu_name", userinfo["kefu_name"])
-
+	c.Set("role_id", userinfo["role_id"])
+	c.Set("jti", jti)
+	c.Set("token_exp", time.Unix(int64(exp), 0))
 }
@@ -2,63 +2,26 @@ package middleware
 
 import (
 	"github.com/gin-gonic/gin"
+	"goflylivechat/common"
+	"goflylivechat/models"
+	"net/http"
+	"strings"
 )
 
+// RbacAuth 按路由需要的权限校验当前客服的角色,未配置权限的路由一律拒绝
 func RbacAuth(c *gin.Context) {
-	return
-	//roleId, _ := c.Get("role_id")
-	//role := models.FindRole(roleId)
-	//var flag bool
-	//rPaths := strings.Split(c.Request.RequestURI, "?")
-	//uriParam := fmt.Sprintf("%s:%s", c.Request.Method, rPaths[0])
-	//if role.Method != "*" || role.Path != "*" {
-	//	paths := strings.Split(role.Path, ",")
-	//	for _, p := range paths {
-	//		if uriParam == p {
-	//			flag = true
-	//			break
-	//		}
-	//	}
-	//	if !flag {
-	//		c.JSON(200, gin.H{
-	//			"code": 403,
-	//			"msg":  "没有权限:" + uriParam,
-	//		})
-	//		c.Abort()
-	//		return
-	//	}
-	//methods := strings.Split(role.Method, ",")
-	//for _, m := range methods {
-	//	if c.Request.Method == m {
-	//		methodFlag = true
-	//		break
-	//	}
-	//}
-	//if !methodFlag {
-	//	c.JSON(200, gin.H{
-	//		"code": 403,
-	//		"msg":  "没有权限:" + c.Request.Method + "," + rPaths[0],
-	//	})
-	//	c.Abort()
-	//	return
-	//}
-	//}
-	//var flag bool
-	//if role.Path != "*" {
-	//	paths := strings.Split(role.Path, ",")
-	//	for _, p := range paths {
-	//		if rPaths[0] == p {
-	//			flag = true
-	//			break
-	//		}
-	//	}
-	//	if !flag {
-	//		c.JSON(200, gin.H{
-	//			"code": 403,
-	//			"msg":  "没有权限:" + rPaths[0],
-	//		})
-	//		c.Abort()
-	//		return
-	//	}
-	//}
+	path := c.FullPath()
+	if prefix := common.GetPrefix(); prefix != "" && strings.HasPrefix(path, prefix+"/") {
+		path = strings.TrimPrefix(path, prefix)
+	}
+	perm := common.RoutePermission(c.Request.Method, path)
+	roleId, _ := c.Get("role_id")
+	if roleId == nil || perm == "" || !common.HasPermission(models.FindRolePermissions(roleId), perm) {
+		c.JSON(http.StatusForbidden, gin.H{
+			"code": 403,
+			"msg":  "没有权限:" + c.Request.Method + " " + path,
+		})
+		c.Abort()
+		return
+	}
 }
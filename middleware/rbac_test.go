@@ -0,0 +1,60 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gin-gonic/gin"
+	"goflylivechat/common"
+	"goflylivechat/models"
+	"goflylivechat/models/dbtest"
+)
+
+func TestRbacAuth(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cases := []struct {
+		perms []string
+		want  int
+	}{
+		{[]string{common.PermProfile, common.PermReply}, http.StatusForbidden},
+		{[]string{common.PermKefuManage}, http.StatusOK},
+		{[]string{common.PermAll}, http.StatusOK},
+	}
+	for _, tc := range cases {
+		mock := dbtest.Mock(t, &models.DB)
+		rows := sqlmock.NewRows([]string{"permission"})
+		for _, perm := range tc.perms {
+			rows.AddRow(perm)
+		}
+		mock.ExpectQuery("SELECT permission FROM `role_permission`").WithArgs(2).WillReturnRows(rows)
+
+		engine := gin.New()
+		engine.GET("/kefulist", func(c *gin.Context) {
+			c.Set("role_id", 2)
+		}, RbacAuth, func(c *gin.Context) {
+			c.Status(http.StatusOK)
+		})
+		w := httptest.NewRecorder()
+		engine.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/kefulist", nil))
+		if w.Code != tc.want {
+			t.Errorf("permissions %v: status %d, want %d", tc.perms, w.Code, tc.want)
+		}
+	}
+}
+
+func TestRbacAuthUnmappedRoute(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	engine := gin.New()
+	engine.GET("/not_mapped", func(c *gin.Context) {
+		c.Set("role_id", 1)
+	}, RbacAuth, func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+	w := httptest.NewRecorder()
+	engine.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/not_mapped", nil))
+	if w.Code != http.StatusForbidden {
+		t.Errorf("status %d, want %d", w.Code, http.StatusForbidden)
+	}
+}
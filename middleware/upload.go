@@ -0,0 +1,12 @@
+package middleware
+
+import (
+	"github.com/gin-gonic/gin"
+	"goflylivechat/common"
+	"net/http"
+)
+
+// UploadLimit 限制上传请求体大小, 必须在读取表单的中间件之前
+func UploadLimit(c *gin.Context) {
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, common.GetUploadPolicy().MaxRequestSize())
+}
@@ -0,0 +1,79 @@
+package middleware
+
+import (
+	"github.com/gin-gonic/gin"
+	"goflylivechat/models"
+	"goflylivechat/tools"
+)
+
+// requestVisitorId 访客接口中的访客ID, 发送消息接口按消息方向取from_id或to_id
+func requestVisitorId(c *gin.Context) string {
+	for _, id := range []string{c.Query("visitor_id"), c.Query("visitorId"), c.PostForm("visitor_id")} {
+		if id != "" {
+			return id
+		}
+	}
+	switch c.PostForm("type") {
+	case "visitor":
+		return c.PostForm("from_id")
+	case "kefu":
+		return c.PostForm("to_id")
+	}
+	return ""
+}
+
+// requestVisitorToken 访客令牌, 依次从请求头、查询参数、表单中获取
+func requestVisitorToken(c *gin.Context) string {
+	if token := c.GetHeader("visitor-token"); token != "" {
+		return token
+	}
+	if token := c.Query("visitor_token"); token != "" {
+		return token
+	}
+	return c.PostForm("visitor_token")
+}
+
+// requestKefuName 请求中有效客服令牌对应的客服账号, 客服后台也会调用部分访客接口
+func requestKefuName(c *gin.Context) string {
+	claims := tools.ParseToken(c.GetHeader("token"), tools.TokenAccess)
+	if claims == nil {
+		return ""
+	}
+	jti, _ := claims["jti"].(string)
+	kefuName, _ := claims["kefu_name"].(string)
+	if models.IsTokenRevoked(jti, kefuName, tools.TokenIssuedAt(claims)) {
+		return ""
+	}
+	return kefuName
+}
+
+// VisitorAuth 访客接口鉴权, 访问者必须携带访客令牌或客服令牌
+// 访客令牌解析出的访客ID写入visitor_id, 请求参数中的访客ID必须与之一致
+// 客服令牌写入kefu_name, visitor_id 取请求参数
+func VisitorAuth(c *gin.Context) {
+	visitorId := requestVisitorId(c)
+	if token := requestVisitorToken(c); token != "" {
+		claims := tools.ParseToken(token, tools.TokenVisitor)
+		tokenVisitorId, _ := claims["visitor_id"].(string)
+		if tokenVisitorId == "" || (visitorId != "" && visitorId != tokenVisitorId) {
+			c.JSON(200, gin.H{
+				"code": 401,
+				"msg":  "访客令牌无效",
+			})
+			c.Abort()
+			return
+		}
+		c.Set("visitor_id", tokenVisitorId)
+		return
+	}
+	if kefuName := requestKefuName(c); kefuName != "" {
+		c.Set("kefu_name", kefuName)
+		c.Set("visitor_id", visitorId)
+		return
+	}
+	c.JSON(200, gin.H{
+		"code": 401,
+		"msg":  "缺少访客令牌",
+	})
+	c.Abort()
+}
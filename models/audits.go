@@ -0,0 +1,47 @@
+package models
+
+import "time"
+
+// Audit 客服和管理员操作日志, 只追加不修改
+type Audit struct {
+	ID          uint      `gorm:"primary_key" json:"id"`
+	Actor       string    `json:"actor"`
+	Action      string    `json:"action"`
+	Target      string    `json:"target"`
+	BeforeValue string    `json:"before_value"`
+	AfterValue  string    `json:"after_value"`
+	Ip          string    `json:"ip"`
+	UserAgent   string    `json:"user_agent"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+func CreateAudit(audit Audit) uint {
+	audit.CreatedAt = time.Now()
+	DB.Create(&audit)
+	return audit.ID
+}
+func FindAudits(page uint, pagesize uint, query interface{}, args ...interface{}) []Audit {
+	offset := (page - 1) * pagesize
+	if offset < 0 {
+		offset = 0
+	}
+	var audits []Audit
+	DB.Where(query, args...).Offset(offset).Limit(pagesize).Order("id desc").Find(&audits)
+	return audits
+}
+
+// FindAuditsBefore 按ID倒序分批读取, 用于导出
+func FindAuditsBefore(beforeId uint, limit uint, query interface{}, args ...interface{}) []Audit {
+	var audits []Audit
+	db := DB.Where(query, args...)
+	if beforeId > 0 {
+		db = db.Where("id < ?", beforeId)
+	}
+	db.Limit(limit).Order("id desc").Find(&audits)
+	return audits
+}
+func CountAudits(query interface{}, args ...interface{}) uint {
+	var count uint
+	DB.Model(&Audit{}).Where(query, args...).Count(&count)
+	return count
+}
@@ -27,6 +27,9 @@ func UpdateConfig(userid interface{}, key string, value string) {
 	}
 
 }
+func DeleteConfig(userid interface{}, key string) {
+	DB.Where("user_id = ? and conf_key = ?", userid, key).Delete(Config{})
+}
 func FindConfigs() []Config {
 	var config []Config
 	DB.Find(&config)
@@ -51,3 +54,20 @@ func FindConfigByUserId(userId interface{}, key string) Config {
 	DB.Where("user_id = ? and conf_key = ?", userId, key).Find(&config)
 	return config
 }
+
+// FindAllowedDomains 客服允许接入的域名, 未配置时使用站点配置
+func FindAllowedDomains(kefuName string) string {
+	if kefuName != "" {
+		if value := FindConfigByUserId(kefuName, "AllowedDomains").ConfValue; value != "" {
+			return value
+		}
+	}
+	return FindConfigByUserId("", "AllowedDomains").ConfValue
+}
+
+// FindAllAllowedDomains 站点和全部客服配置的允许域名
+func FindAllAllowedDomains() []string {
+	var values []string
+	DB.Model(&Config{}).Where("conf_key = ? and conf_value != ''", "AllowedDomains").Pluck("conf_value", &values)
+	return values
+}
@@ -0,0 +1,35 @@
+// Package dbtest 单元测试使用的数据库, 没有MySQL时用sqlmock代替
+package dbtest
+
+import (
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jinzhu/gorm"
+	_ "github.com/jinzhu/gorm/dialects/mysql"
+)
+
+// Mock 把db指向的连接替换为sqlmock, 用例结束后恢复, 并检查预期的语句都已执行
+// 用法: mock := dbtest.Mock(t, &models.DB)
+func Mock(t *testing.T, db **gorm.DB) sqlmock.Sqlmock {
+	t.Helper()
+	sqlDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	gdb, err := gorm.Open("mysql", sqlDB)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gdb.SingularTable(true)
+	old := *db
+	*db = gdb
+	t.Cleanup(func() {
+		*db = old
+		gdb.Close()
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+	})
+	return mock
+}
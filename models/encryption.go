@@ -0,0 +1,172 @@
+package models
+
+import (
+	"goflylivechat/tools"
+	"log"
+	"strings"
+	"time"
+)
+
+// encryptField 加密写入数据库的字段, 失败时返回错误, 调用方不能再写入明文
+func encryptField(value string) (string, error) {
+	return tools.EncryptField(value)
+}
+
+// encryptFields 依次原地加密多个字段, 任一字段失败时返回错误
+func encryptFields(values ...*string) error {
+	for _, value := range values {
+		out, err := encryptField(*value)
+		if err != nil {
+			return err
+		}
+		*value = out
+	}
+	return nil
+}
+
+// decryptField 解密从数据库读出的字段, 失败时记录日志并保留密文
+func decryptField(value string) string {
+	out, err := tools.DecryptField(value)
+	if err != nil {
+		log.Println("decrypt field error:", err)
+		return value
+	}
+	return out
+}
+
+// 读取后解密, 写入时在 CreateMessage CreateVisitor 等函数中显式加密
+func (m *Message) AfterFind() {
+	m.Content = decryptField(m.Content)
+}
+func (m *MessageKefu) AfterFind() {
+	m.Content = decryptField(m.Content)
+}
+func (v *Visitor) AfterFind() {
+	v.SourceIp = decryptField(v.SourceIp)
+	v.ClientIp = decryptField(v.ClientIp)
+	v.LastMessage = decryptField(v.LastMessage)
+	v.Extra = decryptField(v.Extra)
+}
+func (a *VisitorAttr) AfterFind() {
+	a.AttrValue = decryptField(a.AttrValue)
+}
+
+// encryptedTable 加密字段所在的表, Index 为 字段 => 盲索引字段
+type encryptedTable struct {
+	Name    string
+	Columns []string
+	Index   map[string]string
+}
+
+var encryptedTables = []encryptedTable{
+	{Name: "message", Columns: []string{"content"}},
+	{Name: "visitor", Columns: []string{"source_ip", "client_ip", "last_message", "extra"}},
+	{Name: "visitor_attr", Columns: []string{"attr_value"}, Index: map[string]string{"attr_value": "attr_index"}},
+}
+
+// EncryptionRotateResult 重新加密的统计, Updated 为每张表更新的行数, Failed 为无法解密的行数
+type EncryptionRotateResult struct {
+	Updated map[string]int64 `json:"updated"`
+	Failed  map[string]int64 `json:"failed"`
+}
+
+// RotateEncryptedFields 按主键分批用当前密钥重新加密全部加密字段, 并补全盲索引
+// 明文的旧数据会被加密, 关闭加密后执行则解密为明文
+func RotateEncryptedFields(batch int) (EncryptionRotateResult, error) {
+	result := EncryptionRotateResult{
+		Updated: make(map[string]int64),
+		Failed:  make(map[string]int64),
+	}
+	for _, table := range encryptedTables {
+		updated, failed, err := rotateEncryptedTable(table, batch)
+		result.Updated[table.Name] = updated
+		result.Failed[table.Name] = failed
+		if err != nil {
+			return result, err
+		}
+	}
+	return result, nil
+}
+func rotateEncryptedTable(table encryptedTable, batch int) (int64, int64, error) {
+	columns := append([]string{}, table.Columns...)
+	for _, column := range table.Columns {
+		if index, ok := table.Index[column]; ok {
+			columns = append(columns, index)
+		}
+	}
+	type record struct {
+		id     uint
+		values []string
+	}
+	var updated, failed int64
+	var lastId uint
+	for {
+		// 直接读取原始值, 不经过 AfterFind 解密
+		rows, err := DB.Table(table.Name).Select("id,"+strings.Join(columns, ",")).
+			Where("id > ?", lastId).Order("id asc").Limit(batch).Rows()
+		if err != nil {
+			return updated, failed, err
+		}
+		records := make([]record, 0, batch)
+		for rows.Next() {
+			r := record{values: make([]string, len(columns))}
+			dest := []interface{}{&r.id}
+			for i := range r.values {
+				dest = append(dest, &r.values[i])
+			}
+			if err := rows.Scan(dest...); err != nil {
+				rows.Close()
+				return updated, failed, err
+			}
+			lastId = r.id
+			records = append(records, r)
+		}
+		rows.Close()
+		for _, r := range records {
+			changes, err := rotateEncryptedRow(table, columns, r.values)
+			if err != nil {
+				log.Printf("rotate %s id %d error: %s", table.Name, r.id, err)
+				failed++
+				continue
+			}
+			if len(changes) == 0 {
+				continue
+			}
+			if err := DB.Table(table.Name).Where("id = ?", r.id).UpdateColumns(changes).Error; err != nil {
+				return updated, failed, err
+			}
+			updated++
+		}
+		if len(records) < batch {
+			return updated, failed, nil
+		}
+		time.Sleep(retentionBatchPause)
+	}
+}
+
+// rotateEncryptedRow 返回需要更新的字段, values 与 columns 一一对应
+func rotateEncryptedRow(table encryptedTable, columns []string, values []string) (map[string]interface{}, error) {
+	current := make(map[string]string, len(columns))
+	for i, column := range columns {
+		current[column] = values[i]
+	}
+	changes := make(map[string]interface{})
+	for _, column := range table.Columns {
+		value := current[column]
+		plain, err := tools.DecryptField(value)
+		if err != nil {
+			return nil, err
+		}
+		if tools.FieldNeedsRotation(value) {
+			out, err := tools.EncryptField(plain)
+			if err != nil {
+				return nil, err
+			}
+			changes[column] = out
+		}
+		if index, ok := table.Index[column]; ok && current[index] != tools.BlindIndex(plain) {
+			changes[index] = tools.BlindIndex(plain)
+		}
+	}
+	return changes, nil
+}
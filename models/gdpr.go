@@ -0,0 +1,261 @@
+package models
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"errors"
+	"goflylivechat/common"
+	"goflylivechat/tools"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/jinzhu/gorm"
+)
+
+// VisitorData 访客的全部个人数据, 用于数据导出和删除请求
+type VisitorData struct {
+	Visitor       Visitor           `json:"visitor"`
+	Attrs         []VisitorAttr     `json:"attrs"`
+	Messages      []Message         `json:"messages"`
+	Rates         []Rate            `json:"rates"`
+	Tickets       []Ticket          `json:"tickets"`
+	TicketReplies []TicketReply     `json:"ticket_replies"`
+	Schedules     []ScheduleMessage `json:"schedules"`
+	InviteLogs    []InviteLog       `json:"invite_logs"`
+	Ipblacks      []Ipblack         `json:"ipblacks"`
+	Uploads       []UploadFile      `json:"uploads"`
+	Files         []string          `json:"files"`
+}
+
+// VisitorEraseResult 删除访客数据的统计
+type VisitorEraseResult struct {
+	Visitors      int64 `json:"visitors"`
+	Attrs         int64 `json:"attrs"`
+	Messages      int64 `json:"messages"`
+	Rates         int64 `json:"rates"`
+	Tickets       int64 `json:"tickets"`
+	TicketReplies int64 `json:"ticket_replies"`
+	Schedules     int64 `json:"schedules"`
+	InviteLogs    int64 `json:"invite_logs"`
+	Ipblacks      int64 `json:"ipblacks"`
+	Uploads       int64 `json:"uploads"`
+	Files         int64 `json:"files"`
+}
+
+// FindVisitorData 查询访客的全部数据, 包括软删除的记录
+func FindVisitorData(visitorId string) (VisitorData, error) {
+	var data VisitorData
+	if visitorId == "" {
+		return data, errors.New("visitor_id is empty")
+	}
+	db := DB.Unscoped()
+	db.Where("visitor_id = ?", visitorId).First(&data.Visitor)
+	db.Where("visitor_id = ?", visitorId).Order("id asc").Find(&data.Attrs)
+	db.Where("visitor_id = ?", visitorId).Order("id asc").Find(&data.Messages)
+	db.Where("visitor_id = ?", visitorId).Order("id asc").Find(&data.Rates)
+	db.Where("visitor_id = ?", visitorId).Order("id asc").Find(&data.Tickets)
+	db.Where("visitor_id = ?", visitorId).Order("id asc").Find(&data.Schedules)
+	db.Where("visitor_id = ?", visitorId).Order("id asc").Find(&data.InviteLogs)
+	db.Where("visitor_id = ?", visitorId).Order("id asc").Find(&data.Uploads)
+	if data.Visitor.ID == 0 && len(data.Messages) == 0 && len(data.Tickets) == 0 {
+		return data, errors.New("visitor not found")
+	}
+	ticketIds := make([]uint, 0, len(data.Tickets))
+	for _, ticket := range data.Tickets {
+		ticketIds = append(ticketIds, ticket.ID)
+	}
+	if len(ticketIds) > 0 {
+		db.Where("ticket_id in (?)", ticketIds).Order("id asc").Find(&data.TicketReplies)
+	}
+	data.Ipblacks = findVisitorIpblacks(visitorId, data.Attrs)
+	data.Files = make([]string, 0)
+	seen := make(map[string]bool)
+	for _, message := range data.Messages {
+		for _, file := range tools.MessageFiles(message.Content) {
+			if !seen[file] {
+				seen[file] = true
+				data.Files = append(data.Files, file)
+			}
+		}
+	}
+	return data, nil
+}
+
+// findVisitorIpblacks 按访客ID和设备指纹封禁的黑名单, IP网段可能覆盖多人, 不算作访客数据
+func findVisitorIpblacks(visitorId string, attrs []VisitorAttr) []Ipblack {
+	fingerprint := ""
+	for _, attr := range attrs {
+		if attr.AttrKey == "fingerprint" {
+			fingerprint = attr.AttrValue
+		}
+	}
+	var list []Ipblack
+	if fingerprint != "" {
+		DB.Where("visitor_id = ? or fingerprint = ?", visitorId, fingerprint).Find(&list)
+	} else {
+		DB.Where("visitor_id = ?", visitorId).Find(&list)
+	}
+	return list
+}
+
+// ExportVisitorData 把访客数据打包为zip, data.json为数据库记录, files目录为消息中引用的上传文件
+func ExportVisitorData(w io.Writer, data VisitorData) error {
+	zw := zip.NewWriter(w)
+	f, err := zw.Create("data.json")
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(f)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(data); err != nil {
+		return err
+	}
+	for _, ref := range data.Files {
+		path, ok := tools.UploadFilePath(common.Upload, ref)
+		if !ok {
+			continue
+		}
+		if err := addZipFile(zw, "files/"+filepath.ToSlash(path), ref); err != nil && !os.IsNotExist(err) && err != tools.ErrStorageNotFound {
+			return err
+		}
+	}
+	return zw.Close()
+}
+func addZipFile(zw *zip.Writer, name string, ref string) error {
+	src, err := OpenUploadFile(ref)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	dst, err := zw.Create(name)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(dst, src)
+	return err
+}
+
+// EraseVisitorData 删除访客的全部数据和访客自己上传的文件
+// 客服发送的文件可能被快捷回复等重复引用, 只删除访客消息中的文件
+func EraseVisitorData(visitorId string) (VisitorEraseResult, error) {
+	var result VisitorEraseResult
+	data, err := FindVisitorData(visitorId)
+	if err != nil {
+		return result, err
+	}
+	files := make([]string, 0)
+	for _, message := range data.Messages {
+		if message.MesType == "visitor" {
+			files = append(files, tools.MessageFiles(message.Content)...)
+		}
+	}
+	released := make([]UploadFile, 0, len(data.Uploads))
+	for _, upload := range data.Uploads {
+		if upload.Hash != "" {
+			released = append(released, upload)
+		} else {
+			files = append(files, upload.Path)
+		}
+	}
+	ipblackIds := make([]uint, 0, len(data.Ipblacks))
+	for _, black := range data.Ipblacks {
+		ipblackIds = append(ipblackIds, black.ID)
+	}
+	ticketIds := make([]uint, 0, len(data.Tickets))
+	for _, ticket := range data.Tickets {
+		ticketIds = append(ticketIds, ticket.ID)
+	}
+
+	tx := DB.Begin()
+	db := tx.Unscoped()
+	type eraseStep struct {
+		count *int64
+		run   func() *gorm.DB
+	}
+	steps := []eraseStep{
+		{&result.Messages, func() *gorm.DB { return db.Where("visitor_id = ?", visitorId).Delete(Message{}) }},
+		{&result.Attrs, func() *gorm.DB { return db.Where("visitor_id = ?", visitorId).Delete(VisitorAttr{}) }},
+		{&result.Rates, func() *gorm.DB { return db.Where("visitor_id = ?", visitorId).Delete(Rate{}) }},
+		{&result.Schedules, func() *gorm.DB { return db.Where("visitor_id = ?", visitorId).Delete(ScheduleMessage{}) }},
+		{&result.InviteLogs, func() *gorm.DB { return db.Where("visitor_id = ?", visitorId).Delete(InviteLog{}) }},
+		{&result.Tickets, func() *gorm.DB { return db.Where("visitor_id = ?", visitorId).Delete(Ticket{}) }},
+		{&result.Uploads, func() *gorm.DB { return db.Where("visitor_id = ?", visitorId).Delete(UploadFile{}) }},
+		{&result.Visitors, func() *gorm.DB { return db.Where("visitor_id = ?", visitorId).Delete(Visitor{}) }},
+	}
+	if len(ticketIds) > 0 {
+		steps = append(steps, eraseStep{&result.TicketReplies, func() *gorm.DB { return db.Where("ticket_id in (?)", ticketIds).Delete(TicketReply{}) }})
+	}
+	if len(ipblackIds) > 0 {
+		steps = append(steps, eraseStep{&result.Ipblacks, func() *gorm.DB { return db.Where("id in (?)", ipblackIds).Delete(Ipblack{}) }})
+	}
+	for _, step := range steps {
+		res := step.run()
+		if res.Error != nil {
+			tx.Rollback()
+			return result, res.Error
+		}
+		*step.count = res.RowsAffected
+	}
+	if err := tx.Commit().Error; err != nil {
+		return result, err
+	}
+	if len(ipblackIds) > 0 {
+		RefreshIpblacks()
+	}
+	// 数据库记录删除成功后再删除文件, 文件删除失败不影响结果
+	// 去重保存的文件按引用计数释放, 其他访客或客服还在引用的文件保留
+	handled := make(map[string]bool)
+	for _, upload := range released {
+		if releaseUploadFile(upload) && !handled[upload.Path] {
+			result.Files++
+		}
+		handled[upload.Path] = true
+	}
+	for _, ref := range files {
+		key, ok := tools.UploadFileKey(common.Upload, ref)
+		if !ok || handled[common.Upload+key] || FindUploadFileByPath(common.Upload+key).ID != 0 {
+			continue
+		}
+		handled[common.Upload+key] = true
+		if removeUploadFile(ref) {
+			result.Files++
+		}
+	}
+	return result, nil
+}
+
+// OpenUploadFile 读取上传文件, 本地磁盘上没有时从文件存储读取
+func OpenUploadFile(ref string) (io.ReadCloser, error) {
+	key, ok := tools.UploadFileKey(common.Upload, ref)
+	if !ok {
+		return nil, os.ErrNotExist
+	}
+	path, _ := tools.UploadFilePath(common.Upload, ref)
+	if f, err := os.Open(path); err == nil {
+		return f, nil
+	}
+	return common.GetStorage().Get(key)
+}
+
+// removeUploadFile 删除本地磁盘和文件存储中的上传文件
+func removeUploadFile(ref string) bool {
+	key, ok := tools.UploadFileKey(common.Upload, ref)
+	if !ok {
+		return false
+	}
+	path, _ := tools.UploadFilePath(common.Upload, ref)
+	if os.Remove(path) == nil {
+		return true
+	}
+	storage := common.GetStorage()
+	if _, local := storage.(*tools.LocalStorage); local {
+		return false
+	}
+	if err := storage.Delete(key); err != nil {
+		log.Println("delete upload file error:", err)
+		return false
+	}
+	return true
+}
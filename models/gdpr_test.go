@@ -0,0 +1,39 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"goflylivechat/models/dbtest"
+)
+
+// TestEraseVisitorDataInviteLogs 主动邀请记录也是访客数据, 导出和删除时都要包含
+func TestEraseVisitorDataInviteLogs(t *testing.T) {
+	mock := dbtest.Mock(t, &DB)
+	empty := func() *sqlmock.Rows { return sqlmock.NewRows([]string{"id"}) }
+	mock.ExpectQuery("SELECT \\* FROM `visitor` WHERE \\(visitor_id = \\?\\)").WithArgs("v1").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "visitor_id"}).AddRow(1, "v1"))
+	for _, table := range []string{"visitor_attr", "message", "rate", "ticket", "schedule_message"} {
+		mock.ExpectQuery("SELECT \\* FROM `" + table + "` WHERE \\(visitor_id = \\?\\)").WithArgs("v1").WillReturnRows(empty())
+	}
+	mock.ExpectQuery("SELECT \\* FROM `invite_log` WHERE \\(visitor_id = \\?\\)").WithArgs("v1").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "rule_id", "visitor_id", "status"}).AddRow(3, 1, "v1", "accepted"))
+	mock.ExpectQuery("SELECT \\* FROM `upload_file` WHERE \\(visitor_id = \\?\\)").WithArgs("v1").WillReturnRows(empty())
+	mock.ExpectQuery("SELECT \\* FROM `ipblack` WHERE \\(visitor_id = \\?\\)").WithArgs("v1").WillReturnRows(empty())
+
+	mock.ExpectBegin()
+	for _, table := range []string{"message", "visitor_attr", "rate", "schedule_message", "invite_log", "ticket", "upload_file", "visitor"} {
+		affected := int64(0)
+		if table == "invite_log" || table == "visitor" {
+			affected = 1
+		}
+		mock.ExpectExec("DELETE FROM `" + table + "` WHERE \\(visitor_id = \\?\\)").WithArgs("v1").
+			WillReturnResult(sqlmock.NewResult(0, affected))
+	}
+	mock.ExpectCommit()
+
+	result, err := EraseVisitorData("v1")
+	if err != nil || result.InviteLogs != 1 || result.Visitors != 1 {
+		t.Fatalf("EraseVisitorData() == %+v, %v", result, err)
+	}
+}
@@ -0,0 +1,106 @@
+package models
+
+import "time"
+
+// 主动邀请规则, Returning: 0不限 1仅老访客 2仅新访客
+type InviteRule struct {
+	ID         uint      `gorm:"primary_key" json:"id"`
+	UserId     string    `json:"user_id"`
+	Name       string    `json:"name"`
+	UrlPattern string    `json:"url_pattern"`
+	MinSeconds uint      `json:"min_seconds"`
+	MinPages   uint      `json:"min_pages"`
+	Returning  uint      `json:"returning"`
+	FromKefu   string    `json:"from_kefu"`
+	Content    string    `json:"content"`
+	Enabled    uint      `json:"enabled"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+type InviteLog struct {
+	ID         uint       `gorm:"primary_key" json:"id"`
+	RuleId     uint       `json:"rule_id"`
+	VisitorId  string     `json:"visitor_id"`
+	KefuId     string     `json:"kefu_id"`
+	Status     string     `json:"status"`
+	CreatedAt  time.Time  `json:"created_at"`
+	AcceptedAt *time.Time `json:"accepted_at"`
+}
+
+// 邀请转化统计
+type InviteSummary struct {
+	RuleId   uint  `json:"rule_id"`
+	Sent     int64 `json:"sent"`
+	Accepted int64 `json:"accepted"`
+}
+
+func FindInviteRulesByUserId(userId interface{}) []InviteRule {
+	var rules []InviteRule
+	DB.Where("user_id = ?", userId).Order("id asc").Find(&rules)
+	return rules
+}
+func FindEnabledInviteRules(userId interface{}) []InviteRule {
+	var rules []InviteRule
+	DB.Where("user_id = ? and enabled = 1", userId).Order("id asc").Find(&rules)
+	return rules
+}
+func SaveInviteRule(rule *InviteRule) {
+	if rule.ID == 0 {
+		rule.CreatedAt = time.Now()
+		DB.Create(rule)
+		return
+	}
+	DB.Model(&InviteRule{}).Where("user_id = ? and id = ?", rule.UserId, rule.ID).Updates(map[string]interface{}{
+		"name":        rule.Name,
+		"url_pattern": rule.UrlPattern,
+		"min_seconds": rule.MinSeconds,
+		"min_pages":   rule.MinPages,
+		"returning":   rule.Returning,
+		"from_kefu":   rule.FromKefu,
+		"content":     rule.Content,
+		"enabled":     rule.Enabled,
+	})
+}
+func DeleteInviteRule(userId interface{}, id string) {
+	DB.Where("user_id = ? and id = ?", userId, id).Delete(InviteRule{})
+}
+func CreateInviteLog(ruleId uint, visitorId, kefuId string) uint {
+	l := &InviteLog{
+		RuleId:    ruleId,
+		VisitorId: visitorId,
+		KefuId:    kefuId,
+		Status:    "sent",
+		CreatedAt: time.Now(),
+	}
+	DB.Create(l)
+	return l.ID
+}
+
+// AcceptInvite 访客在邀请后一段时间内开始对话,记为转化
+func AcceptInvite(visitorId string, within time.Duration) {
+	now := time.Now()
+	DB.Model(&InviteLog{}).Where("visitor_id = ? and status = ? and created_at >= ?", visitorId, "sent", now.Add(-within)).Updates(map[string]interface{}{
+		"status":      "accepted",
+		"accepted_at": &now,
+	})
+}
+
+// SumInvites 统计客服的邀请发送和转化数
+func SumInvites(kefuId string) InviteSummary {
+	var result InviteSummary
+	query := DB.Table("invite_log").Select("count(*) as sent," +
+		"ifnull(sum(case when status = 'accepted' then 1 else 0 end),0) as accepted")
+	if kefuId != "" {
+		query = query.Where("kefu_id = ?", kefuId)
+	}
+	query.Scan(&result)
+	return result
+}
+
+// SumInvitesGroupByRule 按规则统计邀请发送和转化数
+func SumInvitesGroupByRule(kefuId string) []InviteSummary {
+	var results []InviteSummary
+	DB.Raw("select rule_id,count(*) as sent,"+
+		"sum(case when status = 'accepted' then 1 else 0 end) as accepted "+
+		"from invite_log where kefu_id = ? group by rule_id", kefuId).Scan(&results)
+	return results
+}
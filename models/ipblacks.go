@@ -1,25 +1,67 @@
 package models
 
-import "time"
+import (
+	"goflylivechat/tools"
+	"log"
+	"sync"
+	"time"
 
+	"github.com/jinzhu/gorm"
+)
+
+// Ipblack 黑名单, 可按IP或网段、访客ID、设备指纹封禁
+// ToId 为空时全局生效, 否则只对该客服的访客生效; ExpireAt 为空表示永久封禁
 type Ipblack struct {
-	ID       uint      `gorm:"primary_key" json:"id"`
-	IP       string    `json:"ip"`
-	KefuId   string    `json:"kefu_id"`
-	CreateAt time.Time `json:"create_at"`
+	ID          uint       `gorm:"primary_key" json:"id"`
+	IP          string     `json:"ip"`
+	VisitorId   string     `json:"visitor_id"`
+	Fingerprint string     `json:"fingerprint"`
+	ToId        string     `json:"to_id"`
+	Reason      string     `json:"reason"`
+	KefuId      string     `json:"kefu_id"`
+	ExpireAt    *time.Time `json:"expire_at"`
+	CreateAt    time.Time  `json:"create_at"`
 }
 
-func CreateIpblack(ip string, kefuId string) uint {
-	black := &Ipblack{
-		IP:       ip,
-		KefuId:   kefuId,
-		CreateAt: time.Now(),
-	}
-	DB.Create(black)
+// Active 封禁是否仍然有效
+func (black Ipblack) Active(now time.Time) bool {
+	return black.ExpireAt == nil || black.ExpireAt.After(now)
+}
+
+func CreateIpblack(black Ipblack) uint {
+	black.CreateAt = time.Now()
+	DB.Create(&black)
+	RefreshIpblacks()
 	return black.ID
 }
-func DeleteIpblackByIp(ip string) {
-	DB.Where("ip = ?", ip).Delete(Ipblack{})
+
+// DeleteIpblackByIp 删除该IP的封禁, kefuId不为空时只删除该客服添加的
+func DeleteIpblackByIp(ip string, kefuId string) {
+	ipblackByIp(ip, kefuId).Delete(Ipblack{})
+	RefreshIpblacks()
+}
+
+// FindIpblacksByIp 该IP的封禁, kefuId不为空时只查找该客服添加的
+func FindIpblacksByIp(ip string, kefuId string) []Ipblack {
+	var ipblacks []Ipblack
+	ipblackByIp(ip, kefuId).Find(&ipblacks)
+	return ipblacks
+}
+func ipblackByIp(ip string, kefuId string) *gorm.DB {
+	query := DB.Where("ip = ?", ip)
+	if kefuId != "" {
+		query = query.Where("kefu_id = ?", kefuId)
+	}
+	return query
+}
+func DeleteIpblackById(id interface{}) {
+	DB.Where("id = ?", id).Delete(Ipblack{})
+	RefreshIpblacks()
+}
+func FindIpblackById(id interface{}) Ipblack {
+	var ipblack Ipblack
+	DB.Where("id = ?", id).First(&ipblack)
+	return ipblack
 }
 func FindIp(ip string) Ipblack {
 	var ipblack Ipblack
@@ -28,7 +70,7 @@ func FindIp(ip string) Ipblack {
 }
 func FindIpsByKefuId(id string) []Ipblack {
 	var ipblack []Ipblack
-	DB.Where("kefu_id = ?", id).Find(&ipblack)
+	DB.Where("kefu_id = ?", id).Order("id desc").Find(&ipblack)
 	return ipblack
 }
 func FindIps(query interface{}, args []interface{}, page uint, pagesize uint) []Ipblack {
@@ -38,20 +80,112 @@ func FindIps(query interface{}, args []interface{}, page uint, pagesize uint) []
 	}
 	var ipblacks []Ipblack
 	if query != nil {
-		DB.Where(query, args...).Offset(offset).Limit(pagesize).Find(&ipblacks)
+		DB.Where(query, args...).Order("id desc").Offset(offset).Limit(pagesize).Find(&ipblacks)
 	} else {
-		DB.Offset(offset).Limit(pagesize).Find(&ipblacks)
+		DB.Order("id desc").Offset(offset).Limit(pagesize).Find(&ipblacks)
 	}
 	return ipblacks
 }
 
-//查询条数
+// 查询条数
 func CountIps(query interface{}, args []interface{}) uint {
 	var count uint
 	if query != nil {
-		DB.Model(&Visitor{}).Where(query, args...).Count(&count)
+		DB.Model(&Ipblack{}).Where(query, args...).Count(&count)
 	} else {
-		DB.Model(&Visitor{}).Count(&count)
+		DB.Model(&Ipblack{}).Count(&count)
 	}
 	return count
 }
+
+// 黑名单内存缓存, 增删时立即刷新, 多实例部署时其他实例的修改最迟ipblackCacheTTL后生效
+const ipblackCacheTTL = time.Minute
+
+type ipblackCache struct {
+	sync.RWMutex
+	ips          *tools.IpTrie
+	visitors     map[string][]Ipblack
+	fingerprints map[string][]Ipblack
+	loadAt       time.Time
+}
+
+var ipblacks = &ipblackCache{}
+
+// RefreshIpblacks 重新加载未过期的黑名单
+func RefreshIpblacks() {
+	var list []Ipblack
+	if err := DB.Where("expire_at IS NULL OR expire_at > ?", time.Now()).Find(&list).Error; err != nil {
+		log.Println("load ipblacks:", err)
+		return
+	}
+	ips := tools.NewIpTrie()
+	visitors := make(map[string][]Ipblack)
+	fingerprints := make(map[string][]Ipblack)
+	for _, black := range list {
+		if black.IP != "" {
+			if err := ips.Insert(black.IP, black); err != nil {
+				log.Println("ipblack", black.ID, err)
+			}
+		}
+		if black.VisitorId != "" {
+			visitors[black.VisitorId] = append(visitors[black.VisitorId], black)
+		}
+		if black.Fingerprint != "" {
+			fingerprints[black.Fingerprint] = append(fingerprints[black.Fingerprint], black)
+		}
+	}
+	ipblacks.Lock()
+	ipblacks.ips = ips
+	ipblacks.visitors = visitors
+	ipblacks.fingerprints = fingerprints
+	ipblacks.loadAt = time.Now()
+	ipblacks.Unlock()
+}
+
+// MatchIpblacks 返回IP、访客ID或设备指纹命中的有效封禁, 不区分作用范围
+func MatchIpblacks(ip, visitorId, fingerprint string) []Ipblack {
+	// 缓存过期时只由一个请求重新加载, 其他请求继续使用旧缓存
+	ipblacks.RLock()
+	stale := ipblacks.ips == nil || time.Since(ipblacks.loadAt) > ipblackCacheTTL
+	ipblacks.RUnlock()
+	if stale {
+		ipblacks.Lock()
+		stale = ipblacks.ips == nil || time.Since(ipblacks.loadAt) > ipblackCacheTTL
+		if stale {
+			ipblacks.loadAt = time.Now()
+		}
+		ipblacks.Unlock()
+	}
+	if stale {
+		RefreshIpblacks()
+	}
+	now := time.Now()
+	var result []Ipblack
+	ipblacks.RLock()
+	defer ipblacks.RUnlock()
+	if ipblacks.ips == nil {
+		return nil
+	}
+	if ip != "" {
+		for _, v := range ipblacks.ips.Lookup(ip) {
+			if black := v.(Ipblack); black.Active(now) {
+				result = append(result, black)
+			}
+		}
+	}
+	if visitorId != "" {
+		for _, black := range ipblacks.visitors[visitorId] {
+			if black.Active(now) {
+				result = append(result, black)
+			}
+		}
+	}
+	if fingerprint != "" {
+		for _, black := range ipblacks.fingerprints[fingerprint] {
+			if black.Active(now) {
+				result = append(result, black)
+			}
+		}
+	}
+	return result
+}
@@ -0,0 +1,81 @@
+package models
+
+import "time"
+
+// 登录尝试记录, 失败记录同时作为审计日志
+type LoginAttempt struct {
+	ID        uint      `gorm:"primary_key" json:"id"`
+	Username  string    `json:"username"`
+	Ip        string    `json:"ip"`
+	Success   uint      `json:"success"`
+	Reason    string    `json:"reason"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// 时间段内的失败次数和最后一次失败时间
+type LoginFailures struct {
+	Num  int        `json:"num"`
+	Last *time.Time `json:"last"`
+}
+
+func CreateLoginAttempt(username, ip string, success bool, reason string) {
+	attempt := &LoginAttempt{
+		Username:  username,
+		Ip:        ip,
+		Reason:    reason,
+		CreatedAt: time.Now(),
+	}
+	if success {
+		attempt.Success = 1
+	}
+	DB.Create(attempt)
+}
+
+// CountUserLoginFailures 用户名在since之后、最后一次成功登录之后的失败次数
+func CountUserLoginFailures(username string, since time.Time) LoginFailures {
+	var last LoginAttempt
+	DB.Where("username = ? and success = 1 and created_at >= ?", username, since).Order("id desc").First(&last)
+	if last.ID != 0 {
+		since = last.CreatedAt
+	}
+	var result LoginFailures
+	DB.Table("login_attempt").Select("count(*) as num,max(created_at) as last").
+		Where("username = ? and success = 0 and created_at >= ?", username, since).Scan(&result)
+	return result
+}
+
+// CountIpLoginFailures IP在since之后的失败次数
+func CountIpLoginFailures(ip string, since time.Time) LoginFailures {
+	var result LoginFailures
+	DB.Table("login_attempt").Select("count(*) as num,max(created_at) as last").
+		Where("ip = ? and success = 0 and created_at >= ?", ip, since).Scan(&result)
+	return result
+}
+func FindLoginAttempts(username string, success string, page uint, pagesize uint) []LoginAttempt {
+	offset := (page - 1) * pagesize
+	if offset < 0 {
+		offset = 0
+	}
+	var list []LoginAttempt
+	query := DB.Model(&LoginAttempt{})
+	if username != "" {
+		query = query.Where("username = ?", username)
+	}
+	if success != "" {
+		query = query.Where("success = ?", success)
+	}
+	query.Offset(offset).Limit(pagesize).Order("id desc").Find(&list)
+	return list
+}
+func CountLoginAttempts(username string, success string) uint {
+	var count uint
+	query := DB.Model(&LoginAttempt{})
+	if username != "" {
+		query = query.Where("username = ?", username)
+	}
+	if success != "" {
+		query = query.Where("success = ?", success)
+	}
+	query.Count(&count)
+	return count
+}
@@ -27,7 +27,11 @@ type MessageKefu struct {
 	CreateTime    string `json:"create_time"`
 }
 
-func CreateMessage(kefu_id string, visitor_id string, content string, mes_type string) {
+func CreateMessage(kefu_id string, visitor_id string, content string, mes_type string) error {
+	content, err := encryptField(content)
+	if err != nil {
+		return err
+	}
 	DB.Exec("set names utf8mb4")
 	v := &Message{
 		KefuId:    kefu_id,
@@ -37,7 +41,7 @@ func CreateMessage(kefu_id string, visitor_id string, content string, mes_type s
 		Status:    "unread",
 	}
 	v.UpdatedAt = time.Now()
-	DB.Create(v)
+	return DB.Create(v).Error
 }
 func FindMessageByVisitorId(visitor_id string) []Message {
 	var messages []Message
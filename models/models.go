@@ -19,9 +19,7 @@ type Model struct {
 	DeletedAt *time.Time `sql:"index" json:"deleted_at"`
 }
 
-func init() {
-	Connect()
-}
+// Connect 连接数据库, 由命令行在执行命令前调用, 单元测试不连接
 func Connect() error {
 	mysql := common.GetMysqlConf()
 	dsn := fmt.Sprintf("%s:%s@tcp(%s:%s)/%s?charset=utf8mb4&parseTime=True&loc=Local", mysql.Username, mysql.Password, mysql.Server, mysql.Port, mysql.Database)
@@ -0,0 +1,56 @@
+package models
+
+import "time"
+
+type PrechatField struct {
+	ID        uint      `gorm:"primary_key" json:"id"`
+	UserId    string    `json:"user_id"`
+	FieldKey  string    `json:"field_key"`
+	Label     string    `json:"label"`
+	FieldType string    `json:"field_type"`
+	Options   string    `json:"options"`
+	Pattern   string    `json:"pattern"`
+	Required  uint      `json:"required"`
+	Sort      uint      `json:"sort"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func FindPrechatFieldsByUserId(userId interface{}) []PrechatField {
+	var fields []PrechatField
+	DB.Where("user_id = ?", userId).Order("sort asc, id asc").Find(&fields)
+	return fields
+}
+func FindPrechatField(userId interface{}, id interface{}) PrechatField {
+	var field PrechatField
+	DB.Where("user_id = ? and id = ?", userId, id).First(&field)
+	return field
+}
+func CreatePrechatField(userId, fieldKey, label, fieldType, options, pattern string, required, sort uint) uint {
+	f := &PrechatField{
+		UserId:    userId,
+		FieldKey:  fieldKey,
+		Label:     label,
+		FieldType: fieldType,
+		Options:   options,
+		Pattern:   pattern,
+		Required:  required,
+		Sort:      sort,
+		CreatedAt: time.Now(),
+	}
+	DB.Create(f)
+	return f.ID
+}
+func UpdatePrechatField(userId, id, fieldKey, label, fieldType, options, pattern string, required, sort uint) {
+	DB.Model(&PrechatField{}).Where("user_id = ? and id = ?", userId, id).Updates(map[string]interface{}{
+		"field_key":  fieldKey,
+		"label":      label,
+		"field_type": fieldType,
+		"options":    options,
+		"pattern":    pattern,
+		"required":   required,
+		"sort":       sort,
+	})
+}
+func DeletePrechatField(userId interface{}, id string) {
+	DB.Where("user_id = ? and id = ?", userId, id).Delete(PrechatField{})
+}
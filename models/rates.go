@@ -0,0 +1,109 @@
+package models
+
+import "time"
+
+// 满意度评价, Score 为0表示已邀请评价但访客尚未提交
+type Rate struct {
+	ID             uint       `gorm:"primary_key" json:"id"`
+	ConversationId string     `json:"conversation_id"`
+	VisitorId      string     `json:"visitor_id"`
+	KefuId         string     `json:"kefu_id"`
+	RateType       string     `json:"rate_type"`
+	Score          uint       `json:"score"`
+	Comment        string     `json:"comment"`
+	CreatedAt      time.Time  `json:"created_at"`
+	RatedAt        *time.Time `json:"rated_at"`
+}
+
+// 满意度统计
+type RateSummary struct {
+	KefuId    string  `json:"kefu_id"`
+	Day       string  `json:"day"`
+	Num       int64   `json:"num"`
+	Satisfied int64   `json:"satisfied"`
+	Avg       float64 `json:"avg"`
+}
+
+func CreateRate(conversationId, visitorId, kefuId, rateType string) uint {
+	r := &Rate{
+		ConversationId: conversationId,
+		VisitorId:      visitorId,
+		KefuId:         kefuId,
+		RateType:       rateType,
+		CreatedAt:      time.Now(),
+	}
+	DB.Create(r)
+	return r.ID
+}
+func FindRateByConversationId(conversationId string) Rate {
+	var r Rate
+	DB.Where("conversation_id = ?", conversationId).First(&r)
+	return r
+}
+
+// UpdateRateScore 提交评价,只允许对未评价的会话提交一次
+func UpdateRateScore(conversationId, visitorId string, score uint, comment string) int64 {
+	now := time.Now()
+	return DB.Model(&Rate{}).Where("conversation_id = ? and visitor_id = ? and score = 0", conversationId, visitorId).Updates(map[string]interface{}{
+		"score":    score,
+		"comment":  comment,
+		"rated_at": &now,
+	}).RowsAffected
+}
+func FindRates(kefuId string, page uint, pagesize uint) []Rate {
+	offset := (page - 1) * pagesize
+	if offset < 0 {
+		offset = 0
+	}
+	var rates []Rate
+	query := DB.Where("score > 0")
+	if kefuId != "" {
+		query = query.Where("kefu_id = ?", kefuId)
+	}
+	query.Offset(offset).Limit(pagesize).Order("id desc").Find(&rates)
+	return rates
+}
+func CountRates(kefuId string) uint {
+	var count uint
+	query := DB.Model(&Rate{}).Where("score > 0")
+	if kefuId != "" {
+		query = query.Where("kefu_id = ?", kefuId)
+	}
+	query.Count(&count)
+	return count
+}
+
+// SumRates 统计时间段内的满意度,kefuId为空时统计全部客服
+func SumRates(kefuId string, start, end time.Time) RateSummary {
+	var result RateSummary
+	query := DB.Table("rate").Select("count(*) as num,"+
+		"ifnull(sum(case when score >= 4 then 1 else 0 end),0) as satisfied,"+
+		"ifnull(avg(score),0) as avg").
+		Where("score > 0 and rated_at >= ? and rated_at < ?", start, end)
+	if kefuId != "" {
+		query = query.Where("kefu_id = ?", kefuId)
+	}
+	query.Scan(&result)
+	result.KefuId = kefuId
+	return result
+}
+
+// SumRatesGroupByKefu 按客服分组统计时间段内的满意度
+func SumRatesGroupByKefu(start, end time.Time) []RateSummary {
+	var results []RateSummary
+	DB.Raw("select kefu_id,count(*) as num,"+
+		"sum(case when score >= 4 then 1 else 0 end) as satisfied,"+
+		"avg(score) as avg from rate where score > 0 and rated_at >= ? and rated_at < ? group by kefu_id order by num desc",
+		start, end).Scan(&results)
+	return results
+}
+
+// SumRatesEveryDay 按天统计客服的满意度
+func SumRatesEveryDay(kefuId string) []RateSummary {
+	var results []RateSummary
+	DB.Raw("select DATE_FORMAT(rated_at,'%y-%m-%d') as day,count(*) as num,"+
+		"sum(case when score >= 4 then 1 else 0 end) as satisfied,"+
+		"avg(score) as avg from rate where kefu_id=? and score > 0 group by day order by day desc limit 30",
+		kefuId).Scan(&results)
+	return results
+}
@@ -0,0 +1,60 @@
+package models
+
+import "time"
+
+// 注册邀请, Jti 对应邀请链接令牌中的invite, 每个邀请只能使用一次
+type RegisterInvite struct {
+	ID        uint       `gorm:"primary_key" json:"id"`
+	Jti       string     `json:"-"`
+	Email     string     `json:"email"`
+	RoleId    uint       `json:"role_id"`
+	CreatedBy string     `json:"created_by"`
+	UsedBy    string     `json:"used_by"`
+	UsedAt    *time.Time `json:"used_at"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+func CreateRegisterInvite(jti, email string, roleId uint, createdBy string, expiresAt time.Time) uint {
+	invite := &RegisterInvite{
+		Jti:       jti,
+		Email:     email,
+		RoleId:    roleId,
+		CreatedBy: createdBy,
+		ExpiresAt: expiresAt,
+		CreatedAt: time.Now(),
+	}
+	DB.Create(invite)
+	return invite.ID
+}
+func FindRegisterInvite(jti string) RegisterInvite {
+	var invite RegisterInvite
+	DB.Where("jti = ?", jti).First(&invite)
+	return invite
+}
+func FindRegisterInvites(page uint, pagesize uint) []RegisterInvite {
+	offset := (page - 1) * pagesize
+	var invites []RegisterInvite
+	DB.Order("id desc").Offset(offset).Limit(pagesize).Find(&invites)
+	return invites
+}
+func CountRegisterInvites() uint {
+	var count uint
+	DB.Model(&RegisterInvite{}).Count(&count)
+	return count
+}
+
+// UseRegisterInvite 标记邀请已使用, 已使用或已过期返回false
+func UseRegisterInvite(jti string, usedBy string) bool {
+	now := time.Now()
+	return DB.Model(&RegisterInvite{}).Where("jti = ? and used_at is null and expires_at > ?", jti, now).
+		Updates(map[string]interface{}{"used_by": usedBy, "used_at": now}).RowsAffected == 1
+}
+
+// ReleaseRegisterInvite 注册失败时恢复邀请
+func ReleaseRegisterInvite(jti string) {
+	DB.Model(&RegisterInvite{}).Where("jti = ?", jti).Updates(map[string]interface{}{"used_by": "", "used_at": nil})
+}
+func DeleteRegisterInvite(id string) {
+	DB.Where("id = ?", id).Delete(RegisterInvite{})
+}
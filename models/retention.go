@@ -0,0 +1,113 @@
+package models
+
+import (
+	"goflylivechat/tools"
+	"time"
+)
+
+// 每批删除后暂停, 避免长时间占用数据库
+const retentionBatchPause = 200 * time.Millisecond
+
+// PurgeMessagesBefore 按主键分批删除早于before的消息, archive不为空时先归档; dryRun只统计
+func PurgeMessagesBefore(before time.Time, batch int, dryRun bool, archive *tools.JsonlArchive) (int64, error) {
+	db := DB.Unscoped()
+	if dryRun {
+		var count int64
+		err := db.Model(&Message{}).Where("created_at < ?", before).Count(&count).Error
+		return count, err
+	}
+	var total int64
+	for {
+		var rows []Message
+		if err := db.Where("created_at < ?", before).Order("id asc").Limit(batch).Find(&rows).Error; err != nil {
+			return total, err
+		}
+		if len(rows) == 0 {
+			return total, nil
+		}
+		ids := make([]uint, 0, len(rows))
+		for _, row := range rows {
+			if archive != nil {
+				if err := archive.Write(row); err != nil {
+					return total, err
+				}
+			}
+			ids = append(ids, row.ID)
+		}
+		res := db.Where("id in (?)", ids).Delete(Message{})
+		if res.Error != nil {
+			return total, res.Error
+		}
+		total += res.RowsAffected
+		if len(rows) < batch {
+			return total, nil
+		}
+		time.Sleep(retentionBatchPause)
+	}
+}
+
+// PurgeInactiveVisitors 删除早于before没有活动且不在线的访客及其全部数据
+func PurgeInactiveVisitors(before time.Time, batch int, dryRun bool, archive *tools.JsonlArchive) (int64, error) {
+	db := DB.Unscoped()
+	if dryRun {
+		var count int64
+		err := db.Model(&Visitor{}).Where("updated_at < ? and status = 0", before).Count(&count).Error
+		return count, err
+	}
+	var total int64
+	var lastId uint
+	for {
+		var rows []Visitor
+		if err := db.Where("updated_at < ? and status = 0 and id > ?", before, lastId).Order("id asc").Limit(batch).Find(&rows).Error; err != nil {
+			return total, err
+		}
+		for _, row := range rows {
+			lastId = row.ID
+			if archive != nil {
+				data, err := FindVisitorData(row.VisitorId)
+				if err != nil {
+					continue
+				}
+				if err := archive.Write(data); err != nil {
+					return total, err
+				}
+			}
+			if _, err := EraseVisitorData(row.VisitorId); err != nil {
+				return total, err
+			}
+			total++
+		}
+		if len(rows) < batch {
+			return total, nil
+		}
+		time.Sleep(retentionBatchPause)
+	}
+}
+
+// PurgeLoginAttemptsBefore 分批删除早于before的登录记录
+func PurgeLoginAttemptsBefore(before time.Time, batch int, dryRun bool) (int64, error) {
+	if dryRun {
+		var count int64
+		err := DB.Model(&LoginAttempt{}).Where("created_at < ?", before).Count(&count).Error
+		return count, err
+	}
+	var total int64
+	for {
+		var ids []uint
+		if err := DB.Model(&LoginAttempt{}).Where("created_at < ?", before).Order("id asc").Limit(batch).Pluck("id", &ids).Error; err != nil {
+			return total, err
+		}
+		if len(ids) == 0 {
+			return total, nil
+		}
+		res := DB.Where("id in (?)", ids).Delete(LoginAttempt{})
+		if res.Error != nil {
+			return total, res.Error
+		}
+		total += res.RowsAffected
+		if len(ids) < batch {
+			return total, nil
+		}
+		time.Sleep(retentionBatchPause)
+	}
+}
@@ -1,27 +1,67 @@
 package models
 
+import "time"
+
 type Role struct {
-	Id     string `json:"role_id"`
-	Name   string `json:"role_name"`
-	Method string `json:"method"`
-	Path   string `json:"path"`
+	Id          uint     `gorm:"primary_key" json:"role_id"`
+	Name        string   `json:"role_name"`
+	Permissions []string `json:"permissions" sql:"-"`
+}
+
+// 角色拥有的权限
+type RolePermission struct {
+	ID         uint      `gorm:"primary_key" json:"id"`
+	RoleId     uint      `json:"role_id"`
+	Permission string    `json:"permission"`
+	CreatedAt  time.Time `json:"created_at"`
 }
 
 func FindRoles() []Role {
 	var roles []Role
 	DB.Order("id desc").Find(&roles)
+	for i := range roles {
+		roles[i].Permissions = FindRolePermissions(roles[i].Id)
+	}
 	return roles
 }
 func FindRole(id interface{}) Role {
 	var role Role
 	DB.Where("id = ?", id).First(&role)
+	if role.Id != 0 {
+		role.Permissions = FindRolePermissions(role.Id)
+	}
 	return role
 }
-func SaveRole(id string, name string, method string, path string) {
+func CreateRole(name string, permissions []string) uint {
 	role := &Role{
-		Method: method,
-		Name:   name,
-		Path:   path,
+		Name: name,
+	}
+	DB.Create(role)
+	SaveRolePermissions(role.Id, permissions)
+	return role.Id
+}
+func SaveRole(id uint, name string, permissions []string) {
+	DB.Model(&Role{}).Where("id=?", id).Update("name", name)
+	SaveRolePermissions(id, permissions)
+}
+func DeleteRole(id uint) {
+	DB.Where("id = ?", id).Delete(Role{})
+	DB.Where("role_id = ?", id).Delete(RolePermission{})
+}
+func FindRolePermissions(roleId interface{}) []string {
+	var perms []string
+	DB.Model(&RolePermission{}).Where("role_id = ?", roleId).Order("id asc").Pluck("permission", &perms)
+	return perms
+}
+
+// SaveRolePermissions 覆盖保存角色的权限
+func SaveRolePermissions(roleId uint, permissions []string) {
+	DB.Where("role_id = ?", roleId).Delete(RolePermission{})
+	for _, perm := range permissions {
+		DB.Create(&RolePermission{
+			RoleId:     roleId,
+			Permission: perm,
+			CreatedAt:  time.Now(),
+		})
 	}
-	DB.Model(role).Where("id=?", id).Update(role)
 }
@@ -0,0 +1,93 @@
+package models
+
+import "time"
+
+const (
+	SchedulePending  = "pending"
+	ScheduleSending  = "sending"
+	ScheduleSent     = "sent"
+	ScheduleCanceled = "canceled"
+)
+
+// 定时消息, Delivery 记录实际送达方式: ws在线推送 offline离线留言 email邮件
+type ScheduleMessage struct {
+	ID        uint       `gorm:"primary_key" json:"id"`
+	KefuId    string     `json:"kefu_id"`
+	VisitorId string     `json:"visitor_id"`
+	Content   string     `json:"content"`
+	SendAt    time.Time  `json:"send_at"`
+	Status    string     `json:"status"`
+	Delivery  string     `json:"delivery"`
+	CreatedAt time.Time  `json:"created_at"`
+	SentAt    *time.Time `json:"sent_at"`
+}
+
+func CreateScheduleMessage(kefuId, visitorId, content string, sendAt time.Time) *ScheduleMessage {
+	s := &ScheduleMessage{
+		KefuId:    kefuId,
+		VisitorId: visitorId,
+		Content:   content,
+		SendAt:    sendAt,
+		Status:    SchedulePending,
+		CreatedAt: time.Now(),
+	}
+	DB.Exec("set names utf8mb4")
+	DB.Create(s)
+	return s
+}
+
+// FindScheduleMessages 客服的定时消息, status为空时查询全部
+func FindScheduleMessages(kefuId string, status string, page uint, pagesize uint) []ScheduleMessage {
+	offset := (page - 1) * pagesize
+	if offset < 0 {
+		offset = 0
+	}
+	var list []ScheduleMessage
+	query := DB.Where("kefu_id = ?", kefuId)
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+	query.Offset(offset).Limit(pagesize).Order("send_at asc").Find(&list)
+	return list
+}
+func CountScheduleMessages(kefuId string, status string) uint {
+	var count uint
+	query := DB.Model(&ScheduleMessage{}).Where("kefu_id = ?", kefuId)
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+	query.Count(&count)
+	return count
+}
+
+// FindDueScheduleMessages 到期待发送的定时消息
+func FindDueScheduleMessages(now time.Time, limit uint) []ScheduleMessage {
+	var list []ScheduleMessage
+	DB.Where("status = ? and send_at <= ?", SchedulePending, now).Order("send_at asc").Limit(limit).Find(&list)
+	return list
+}
+
+// CancelScheduleMessage 取消未发送的定时消息
+func CancelScheduleMessage(kefuId string, id interface{}) int64 {
+	return DB.Model(&ScheduleMessage{}).Where("kefu_id = ? and id = ? and status = ?", kefuId, id, SchedulePending).
+		Update("status", ScheduleCanceled).RowsAffected
+}
+
+// ClaimScheduleMessage 把待发送消息标记为发送中,返回false说明已被取消或已处理
+func ClaimScheduleMessage(id uint) bool {
+	return DB.Model(&ScheduleMessage{}).Where("id = ? and status = ?", id, SchedulePending).
+		Update("status", ScheduleSending).RowsAffected > 0
+}
+func FinishScheduleMessage(id uint, delivery string) {
+	now := time.Now()
+	DB.Model(&ScheduleMessage{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"status":   ScheduleSent,
+		"delivery": delivery,
+		"sent_at":  &now,
+	})
+}
+
+// ResetSendingScheduleMessages 服务重启时把中断的发送中消息恢复为待发送
+func ResetSendingScheduleMessages() {
+	DB.Model(&ScheduleMessage{}).Where("status = ?", ScheduleSending).Update("status", SchedulePending)
+}
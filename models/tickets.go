@@ -0,0 +1,88 @@
+package models
+
+import "time"
+
+const (
+	TicketOpen    = "open"
+	TicketPending = "pending"
+	TicketClosed  = "closed"
+)
+
+type Ticket struct {
+	Model
+	VisitorId string     `json:"visitor_id"`
+	KefuId    string     `json:"kefu_id"`
+	Assignee  string     `json:"assignee"`
+	Name      string     `json:"name"`
+	Email     string     `json:"email"`
+	Phone     string     `json:"phone"`
+	Subject   string     `json:"subject"`
+	Content   string     `json:"content"`
+	Status    string     `json:"status"`
+	DueAt     *time.Time `json:"due_at"`
+}
+type TicketReply struct {
+	ID        uint      `gorm:"primary_key" json:"id"`
+	TicketId  uint      `json:"ticket_id"`
+	FromType  string    `json:"from_type"`
+	FromId    string    `json:"from_id"`
+	Content   string    `json:"content"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func CreateTicket(visitorId, kefuId, name, email, phone, subject, content string, dueAt *time.Time) uint {
+	t := &Ticket{
+		VisitorId: visitorId,
+		KefuId:    kefuId,
+		Assignee:  kefuId,
+		Name:      name,
+		Email:     email,
+		Phone:     phone,
+		Subject:   subject,
+		Content:   content,
+		Status:    TicketOpen,
+		DueAt:     dueAt,
+	}
+	t.UpdatedAt = time.Now()
+	DB.Create(t)
+	return t.ID
+}
+func FindTicketById(id interface{}) Ticket {
+	var t Ticket
+	DB.Where("id = ?", id).First(&t)
+	return t
+}
+func FindTickets(page uint, pagesize uint, query interface{}, args ...interface{}) []Ticket {
+	offset := (page - 1) * pagesize
+	if offset < 0 {
+		offset = 0
+	}
+	var tickets []Ticket
+	DB.Where(query, args...).Offset(offset).Limit(pagesize).Order("updated_at desc").Find(&tickets)
+	return tickets
+}
+func CountTickets(query interface{}, args ...interface{}) uint {
+	var count uint
+	DB.Model(&Ticket{}).Where(query, args...).Count(&count)
+	return count
+}
+func UpdateTicket(id uint, fields map[string]interface{}) {
+	fields["updated_at"] = time.Now()
+	DB.Model(&Ticket{}).Where("id = ?", id).Updates(fields)
+}
+func CreateTicketReply(ticketId uint, fromType, fromId, content string) uint {
+	r := &TicketReply{
+		TicketId:  ticketId,
+		FromType:  fromType,
+		FromId:    fromId,
+		Content:   content,
+		CreatedAt: time.Now(),
+	}
+	DB.Create(r)
+	return r.ID
+}
+func FindTicketReplies(ticketId uint) []TicketReply {
+	var replies []TicketReply
+	DB.Where("ticket_id = ?", ticketId).Order("id asc").Find(&replies)
+	return replies
+}
@@ -0,0 +1,35 @@
+package models
+
+import "time"
+
+// 已吊销的令牌, Jti 为空表示吊销该客服在 CreatedAt 之前签发的全部令牌
+// CreatedAt 与令牌的签发时间都精确到毫秒, 同一毫秒内签发的令牌不吊销
+type TokenRevoke struct {
+	ID        uint      `gorm:"primary_key" json:"id"`
+	Jti       string    `json:"jti"`
+	KefuName  string    `json:"kefu_name"`
+	ExpiresAt time.Time `json:"expires_at"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func RevokeToken(jti string, kefuName string, expiresAt time.Time) {
+	DB.Create(&TokenRevoke{
+		Jti:       jti,
+		KefuName:  kefuName,
+		ExpiresAt: expiresAt,
+		CreatedAt: time.Now().Truncate(time.Millisecond),
+	})
+}
+
+// RevokeUserTokens 吊销客服当前所有令牌, expiresAt 应不早于最长的令牌有效期
+func RevokeUserTokens(kefuName string, expiresAt time.Time) {
+	RevokeToken("", kefuName, expiresAt)
+}
+func IsTokenRevoked(jti string, kefuName string, issuedAt time.Time) bool {
+	var count uint
+	DB.Model(&TokenRevoke{}).Where("jti = ? or (jti = '' and kefu_name = ? and created_at > ?)", jti, kefuName, issuedAt).Count(&count)
+	return count > 0
+}
+func DeleteExpiredTokenRevokes() {
+	DB.Where("expires_at < ?", time.Now()).Delete(TokenRevoke{})
+}
@@ -0,0 +1,21 @@
+package models
+
+import (
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"goflylivechat/models/dbtest"
+)
+
+// TestIsTokenRevokedStrict 吊销全部令牌后同一秒内重新登录签发的令牌仍然有效
+func TestIsTokenRevokedStrict(t *testing.T) {
+	mock := dbtest.Mock(t, &DB)
+	issuedAt := time.UnixMilli(1700000000250)
+	mock.ExpectQuery("SELECT count\\(\\*\\) FROM `token_revoke` WHERE \\(jti = \\? or \\(jti = '' and kefu_name = \\? and created_at > \\?\\)\\)").
+		WithArgs("jti1", "kefu1", issuedAt).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+	if IsTokenRevoked("jti1", "kefu1", issuedAt) {
+		t.Error("IsTokenRevoked() == true for a token issued after the revocation")
+	}
+}
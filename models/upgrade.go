@@ -0,0 +1,191 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrSchemaOutdated 数据库结构是旧版本, 需要执行 gochat upgrade
+var ErrSchemaOutdated = errors.New("database schema is outdated, run gochat upgrade")
+
+// schemaColumn 旧版本数据库需要新增或加宽的字段
+// Length 为字段需要的最小字符长度, 时间字段为小数秒的位数, 为0时只在字段不存在时新增; Key 为true时新增字段同时建立同名索引
+// Encrypted 为true时是字段加密写入的字段, 加宽之前不能开启加密
+type schemaColumn struct {
+	Table      string
+	Column     string
+	Length     int64
+	Definition string
+	Key        bool
+	Encrypted  bool
+}
+
+// schemaColumns 按版本顺序追加, 与 import.sql 中的定义保持一致
+// 修改 import.sql 中旧版本就有的表时, 新增和加宽的字段都要在这里追加
+var schemaColumns = []schemaColumn{
+	{Table: "user", Column: "password", Length: 255, Definition: "varchar(255) NOT NULL DEFAULT ''"},
+	{Table: "user", Column: "email", Definition: "varchar(100) NOT NULL DEFAULT ''"},
+	{Table: "user", Column: "email_verified_at", Definition: "timestamp NULL DEFAULT NULL"},
+	{Table: "ipblack", Column: "visitor_id", Definition: "varchar(100) NOT NULL DEFAULT ''", Key: true},
+	{Table: "ipblack", Column: "fingerprint", Definition: "varchar(100) NOT NULL DEFAULT ''"},
+	{Table: "ipblack", Column: "to_id", Definition: "varchar(100) NOT NULL DEFAULT ''"},
+	{Table: "ipblack", Column: "reason", Definition: "varchar(500) NOT NULL DEFAULT ''"},
+	{Table: "ipblack", Column: "expire_at", Definition: "timestamp NULL DEFAULT NULL"},
+	{Table: "visitor", Column: "source_ip", Length: 255, Definition: "varchar(255) NOT NULL DEFAULT ''", Encrypted: true},
+	{Table: "visitor", Column: "client_ip", Length: 255, Definition: "varchar(255) NOT NULL DEFAULT ''", Encrypted: true},
+	{Table: "visitor", Column: "last_message", Length: 65535, Definition: "text NOT NULL", Encrypted: true},
+	{Table: "visitor", Column: "extra", Length: 65535, Definition: "text NOT NULL", Encrypted: true},
+	{Table: "message", Column: "content", Length: 65535, Definition: "text NOT NULL", Encrypted: true},
+	{Table: "visitor_attr", Column: "attr_value", Length: 1024, Definition: "varchar(1024) NOT NULL DEFAULT ''", Encrypted: true},
+	{Table: "visitor_attr", Column: "attr_index", Definition: "varchar(64) NOT NULL DEFAULT ''", Key: true, Encrypted: true},
+	// 两步验证按时间窗口序号防止验证码重放, 已建的表缺少该字段
+	{Table: "user_totp", Column: "last_counter", Definition: "bigint(20) unsigned NOT NULL DEFAULT '0'"},
+	// 吊销时间精确到毫秒, 已建的表只精确到秒
+	{Table: "token_revoke", Column: "created_at", Length: 3, Definition: "timestamp(3) NOT NULL DEFAULT CURRENT_TIMESTAMP(3)"},
+}
+
+// schemaIndex 旧版本数据库需要新增的索引, 已有同名索引的唯一性不同时删除后重建
+type schemaIndex struct {
+	Table   string
+	Name    string
+	Columns string
+	Unique  bool
+}
+
+// schemaIndexes 在字段之后处理, 可以引用 schemaColumns 中新增的字段
+var schemaIndexes = []schemaIndex{
+	// 旧版本每个IP只能封禁一次, 现在可以按客服和访客分别封禁同一个IP
+	{Table: "ipblack", Name: "ip", Columns: "`ip`"},
+	{Table: "ipblack", Name: "kefu_id", Columns: "`kefu_id`"},
+}
+
+// TableExists 当前数据库中是否有该表
+func TableExists(table string) (bool, error) {
+	var count int
+	err := DB.Raw("SELECT count(*) FROM information_schema.TABLES WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = ?", table).Row().Scan(&count)
+	return count > 0, err
+}
+
+// ColumnLength 字段的最大字符长度, 时间字段为小数秒的位数, 字段不存在时exists为false
+func ColumnLength(table, column string) (length int64, exists bool, err error) {
+	rows, err := DB.Raw("SELECT coalesce(CHARACTER_MAXIMUM_LENGTH,DATETIME_PRECISION,0) FROM information_schema.COLUMNS WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = ? AND COLUMN_NAME = ?", table, column).Rows()
+	if err != nil {
+		return 0, false, err
+	}
+	defer rows.Close()
+	if !rows.Next() {
+		return 0, false, rows.Err()
+	}
+	err = rows.Scan(&length)
+	return length, err == nil, err
+}
+
+// IndexUnique 索引是否为唯一索引, 索引不存在时exists为false
+func IndexUnique(table, name string) (unique bool, exists bool, err error) {
+	rows, err := DB.Raw("SELECT NON_UNIQUE FROM information_schema.STATISTICS WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = ? AND INDEX_NAME = ? LIMIT 1", table, name).Rows()
+	if err != nil {
+		return false, false, err
+	}
+	defer rows.Close()
+	if !rows.Next() {
+		return false, false, rows.Err()
+	}
+	var nonUnique int
+	err = rows.Scan(&nonUnique)
+	return nonUnique == 0, err == nil, err
+}
+
+// columnFits 字段能否保存length个字符, 查询失败时按不能保存处理
+func columnFits(table, column string, length int) error {
+	size, exists, err := ColumnLength(table, column)
+	if err != nil {
+		return err
+	}
+	if !exists || size < int64(length) {
+		return fmt.Errorf("%s.%s: %w", table, column, ErrSchemaOutdated)
+	}
+	return nil
+}
+
+// CheckPasswordColumn 旧版本的密码字段为varchar(50), 保存不下bcrypt哈希, 截断后将无法登录
+func CheckPasswordColumn(hash string) error {
+	return columnFits("user", "password", len(hash))
+}
+
+// CheckEncryptionSchema 加密后的字段比明文长, 旧版本的字段长度不够时会截断密文, 开启加密前必须先升级
+func CheckEncryptionSchema() error {
+	for _, col := range schemaColumns {
+		if !col.Encrypted {
+			continue
+		}
+		if err := columnFits(col.Table, col.Column, int(col.Length)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// UpgradeColumns 新增缺少的字段, 加宽长度不够的字段, 再新增或重建索引, 返回执行的语句
+func UpgradeColumns() ([]string, error) {
+	var executed []string
+	for _, col := range schemaColumns {
+		ok, err := TableExists(col.Table)
+		if err != nil {
+			return executed, err
+		}
+		// 新版本才有的表由 import.sql 中的建表语句创建
+		if !ok {
+			continue
+		}
+		length, exists, err := ColumnLength(col.Table, col.Column)
+		if err != nil {
+			return executed, err
+		}
+		var sql string
+		switch {
+		case !exists && col.Key:
+			sql = fmt.Sprintf("ALTER TABLE `%s` ADD COLUMN `%s` %s, ADD KEY `%s` (`%s`)", col.Table, col.Column, col.Definition, col.Column, col.Column)
+		case !exists:
+			sql = fmt.Sprintf("ALTER TABLE `%s` ADD COLUMN `%s` %s", col.Table, col.Column, col.Definition)
+		case length < col.Length:
+			sql = fmt.Sprintf("ALTER TABLE `%s` MODIFY `%s` %s", col.Table, col.Column, col.Definition)
+		default:
+			continue
+		}
+		if err := DB.Exec(sql).Error; err != nil {
+			return executed, fmt.Errorf("%s: %w", sql, err)
+		}
+		executed = append(executed, sql)
+	}
+	for _, index := range schemaIndexes {
+		ok, err := TableExists(index.Table)
+		if err != nil {
+			return executed, err
+		}
+		if !ok {
+			continue
+		}
+		unique, exists, err := IndexUnique(index.Table, index.Name)
+		if err != nil {
+			return executed, err
+		}
+		key := "KEY"
+		if index.Unique {
+			key = "UNIQUE KEY"
+		}
+		var sql string
+		switch {
+		case !exists:
+			sql = fmt.Sprintf("ALTER TABLE `%s` ADD %s `%s` (%s)", index.Table, key, index.Name, index.Columns)
+		case unique != index.Unique:
+			sql = fmt.Sprintf("ALTER TABLE `%s` DROP INDEX `%s`, ADD %s `%s` (%s)", index.Table, index.Name, key, index.Name, index.Columns)
+		default:
+			continue
+		}
+		if err := DB.Exec(sql).Error; err != nil {
+			return executed, fmt.Errorf("%s: %w", sql, err)
+		}
+		executed = append(executed, sql)
+	}
+	return executed, nil
+}
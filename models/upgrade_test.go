@@ -0,0 +1,173 @@
+package models
+
+import (
+	"errors"
+	"os"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"goflylivechat/models/dbtest"
+)
+
+func expectColumnLength(mock sqlmock.Sqlmock, table, column string, length int64) {
+	rows := sqlmock.NewRows([]string{"length"})
+	if length > 0 {
+		rows.AddRow(length)
+	}
+	mock.ExpectQuery("FROM information_schema.COLUMNS").WithArgs(table, column).WillReturnRows(rows)
+}
+
+// expectIndex nonUnique为-1时索引不存在
+func expectIndex(mock sqlmock.Sqlmock, table, name string, nonUnique int) {
+	rows := sqlmock.NewRows([]string{"NON_UNIQUE"})
+	if nonUnique >= 0 {
+		rows.AddRow(nonUnique)
+	}
+	mock.ExpectQuery("FROM information_schema.STATISTICS").WithArgs(table, name).WillReturnRows(rows)
+}
+
+func TestUpdateUserPassNarrowColumn(t *testing.T) {
+	mock := dbtest.Mock(t, &DB)
+	expectColumnLength(mock, "user", "password", 50)
+	hash := "$2a$10$abcdefghijklmnopqrstuvwxyzabcdefghijklmnopqrstuvwxyz12"
+	if err := UpdateUserPass("agent", hash); !errors.Is(err, ErrSchemaOutdated) {
+		t.Fatalf("UpdateUserPass on varchar(50) = %v, want ErrSchemaOutdated", err)
+	}
+}
+
+func TestUpdateUserPass(t *testing.T) {
+	mock := dbtest.Mock(t, &DB)
+	expectColumnLength(mock, "user", "password", 255)
+	mock.ExpectBegin()
+	mock.ExpectExec("UPDATE `user` SET `password` = \\?").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	if err := UpdateUserPass("agent", "$2a$10$hash"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestUpgradeColumns(t *testing.T) {
+	mock := dbtest.Mock(t, &DB)
+	saved, savedIndexes := schemaColumns, schemaIndexes
+	defer func() { schemaColumns, schemaIndexes = saved, savedIndexes }()
+	schemaColumns = []schemaColumn{
+		{Table: "user", Column: "password", Length: 255, Definition: "varchar(255) NOT NULL DEFAULT ''"},
+		{Table: "visitor_attr", Column: "attr_index", Definition: "varchar(64) NOT NULL DEFAULT ''", Key: true},
+		{Table: "missing", Column: "name", Length: 100, Definition: "varchar(100) NOT NULL DEFAULT ''"},
+		{Table: "message", Column: "content", Length: 65535, Definition: "text NOT NULL"},
+		{Table: "token_revoke", Column: "created_at", Length: 3, Definition: "timestamp(3) NOT NULL DEFAULT CURRENT_TIMESTAMP(3)"},
+	}
+	schemaIndexes = []schemaIndex{
+		{Table: "ipblack", Name: "ip", Columns: "`ip`"},
+		{Table: "ipblack", Name: "kefu_id", Columns: "`kefu_id`"},
+		{Table: "ipblack", Name: "visitor_id", Columns: "`visitor_id`"},
+		{Table: "missing", Name: "name", Columns: "`name`"},
+	}
+	tableExists := func(table string, n int) {
+		mock.ExpectQuery("FROM information_schema.TABLES").WithArgs(table).
+			WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(n))
+	}
+	tableExists("user", 1)
+	expectColumnLength(mock, "user", "password", 50)
+	mock.ExpectExec("ALTER TABLE `user` MODIFY `password` varchar\\(255\\)").WillReturnResult(sqlmock.NewResult(0, 0))
+	tableExists("visitor_attr", 1)
+	expectColumnLength(mock, "visitor_attr", "attr_index", 0)
+	mock.ExpectExec("ALTER TABLE `visitor_attr` ADD COLUMN `attr_index` .*, ADD KEY `attr_index`").WillReturnResult(sqlmock.NewResult(0, 0))
+	tableExists("missing", 0)
+	tableExists("message", 1)
+	expectColumnLength(mock, "message", "content", 65535)
+	// 只精确到秒的时间字段加上小数秒
+	tableExists("token_revoke", 1)
+	mock.ExpectQuery("SELECT coalesce\\(CHARACTER_MAXIMUM_LENGTH,DATETIME_PRECISION,0\\) FROM information_schema.COLUMNS").WithArgs("token_revoke", "created_at").
+		WillReturnRows(sqlmock.NewRows([]string{"length"}).AddRow(0))
+	mock.ExpectExec("ALTER TABLE `token_revoke` MODIFY `created_at` timestamp\\(3\\)").WillReturnResult(sqlmock.NewResult(0, 0))
+	// 旧版本的唯一索引ip改为普通索引, 缺少的索引新增, 已有的不变
+	tableExists("ipblack", 1)
+	expectIndex(mock, "ipblack", "ip", 0)
+	mock.ExpectExec("ALTER TABLE `ipblack` DROP INDEX `ip`, ADD KEY `ip` \\(`ip`\\)").WillReturnResult(sqlmock.NewResult(0, 0))
+	tableExists("ipblack", 1)
+	expectIndex(mock, "ipblack", "kefu_id", -1)
+	mock.ExpectExec("ALTER TABLE `ipblack` ADD KEY `kefu_id` \\(`kefu_id`\\)").WillReturnResult(sqlmock.NewResult(0, 0))
+	tableExists("ipblack", 1)
+	expectIndex(mock, "ipblack", "visitor_id", 1)
+	tableExists("missing", 0)
+
+	executed, err := UpgradeColumns()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(executed) != 5 {
+		t.Fatalf("executed %d statements, want 5: %v", len(executed), executed)
+	}
+}
+
+func TestCheckEncryptionSchema(t *testing.T) {
+	saved := schemaColumns
+	defer func() { schemaColumns = saved }()
+	schemaColumns = []schemaColumn{
+		{Table: "user", Column: "password", Length: 255, Definition: "varchar(255) NOT NULL DEFAULT ''"},
+		{Table: "visitor", Column: "source_ip", Length: 255, Definition: "varchar(255) NOT NULL DEFAULT ''", Encrypted: true},
+		{Table: "visitor_attr", Column: "attr_index", Definition: "varchar(64) NOT NULL DEFAULT ''", Key: true, Encrypted: true},
+	}
+
+	t.Run("outdated", func(t *testing.T) {
+		mock := dbtest.Mock(t, &DB)
+		expectColumnLength(mock, "visitor", "source_ip", 50)
+		if err := CheckEncryptionSchema(); !errors.Is(err, ErrSchemaOutdated) {
+			t.Fatalf("CheckEncryptionSchema on varchar(50) = %v, want ErrSchemaOutdated", err)
+		}
+	})
+	t.Run("missing column", func(t *testing.T) {
+		mock := dbtest.Mock(t, &DB)
+		expectColumnLength(mock, "visitor", "source_ip", 255)
+		expectColumnLength(mock, "visitor_attr", "attr_index", 0)
+		if err := CheckEncryptionSchema(); !errors.Is(err, ErrSchemaOutdated) {
+			t.Fatalf("CheckEncryptionSchema without attr_index = %v, want ErrSchemaOutdated", err)
+		}
+	})
+	t.Run("upgraded", func(t *testing.T) {
+		mock := dbtest.Mock(t, &DB)
+		expectColumnLength(mock, "visitor", "source_ip", 255)
+		expectColumnLength(mock, "visitor_attr", "attr_index", 64)
+		if err := CheckEncryptionSchema(); err != nil {
+			t.Fatal(err)
+		}
+	})
+}
+
+// TestSchemaColumnsMatchImportSql 升级后的字段定义与新安装的相同
+func TestSchemaColumnsMatchImportSql(t *testing.T) {
+	data, err := os.ReadFile("../import.sql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, col := range schemaColumns {
+		table := regexp.MustCompile("(?s)CREATE TABLE `" + col.Table + "` \\((.*?)\\) ENGINE").FindSubmatch(data)
+		if table == nil {
+			t.Errorf("import.sql has no table %s", col.Table)
+			continue
+		}
+		if !regexp.MustCompile("(?m)^ `" + col.Column + "` " + regexp.QuoteMeta(col.Definition) + ",$").Match(table[1]) {
+			t.Errorf("%s.%s is not defined as %q in import.sql", col.Table, col.Column, col.Definition)
+		}
+	}
+}
+
+// TestSchemaIndexesMatchImportSql 升级后的索引与新安装的相同
+func TestSchemaIndexesMatchImportSql(t *testing.T) {
+	data, err := os.ReadFile("../import.sql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, index := range schemaIndexes {
+		table := regexp.MustCompile("(?s)CREATE TABLE `" + index.Table + "` \\((.*?)\\) ENGINE").FindSubmatch(data)
+		key := "KEY"
+		if index.Unique {
+			key = "UNIQUE KEY"
+		}
+		if table == nil || !regexp.MustCompile("(?m)^ "+key+" `"+index.Name+"` "+regexp.QuoteMeta("("+index.Columns+")")+",?$").Match(table[1]) {
+			t.Errorf("%s index %s is not defined as %s %s in import.sql", index.Table, index.Name, key, index.Columns)
+		}
+	}
+}
@@ -0,0 +1,117 @@
+package models
+
+import (
+	"errors"
+	"goflylivechat/common"
+	"goflylivechat/tools"
+	"log"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// UploadBlob 按SHA-256内容寻址保存的文件, 相同内容只保存一份
+// RefCount 为引用该文件的上传记录数, 减到0时删除文件
+type UploadBlob struct {
+	ID        uint      `gorm:"primary_key" json:"id"`
+	Hash      string    `json:"hash"`
+	Path      string    `json:"path"`
+	Size      int64     `json:"size"`
+	RefCount  int64     `json:"ref_count"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// AcquireUploadBlob 引用内容为hash的文件, 已存在时引用计数加一并返回true
+// 不存在时调用put保存到key后新建记录, 保存失败不创建记录
+func AcquireUploadBlob(hash string, key string, size int64, put func() error) (UploadBlob, bool, error) {
+	var blob UploadBlob
+	var err error
+	// 并发上传相同内容时唯一索引冲突, 重试一次即可引用对方创建的记录
+	for i := 0; i < 2; i++ {
+		var exists bool
+		blob, exists, err = acquireUploadBlob(hash, key, size, put)
+		if err != errUploadBlobConflict {
+			return blob, exists, err
+		}
+	}
+	return blob, false, err
+}
+
+var errUploadBlobConflict = errors.New("upload blob is being created")
+
+func acquireUploadBlob(hash string, key string, size int64, put func() error) (UploadBlob, bool, error) {
+	var blob UploadBlob
+	tx := DB.Begin()
+	err := tx.Set("gorm:query_option", "FOR UPDATE").Where("hash = ?", hash).First(&blob).Error
+	if err == nil {
+		if err := tx.Model(&UploadBlob{}).Where("id = ?", blob.ID).UpdateColumn("ref_count", gorm.Expr("ref_count + 1")).Error; err != nil {
+			tx.Rollback()
+			return blob, false, err
+		}
+		blob.RefCount++
+		return blob, true, tx.Commit().Error
+	}
+	if !gorm.IsRecordNotFoundError(err) {
+		tx.Rollback()
+		return blob, false, err
+	}
+	blob = UploadBlob{
+		Hash:      hash,
+		Path:      common.Upload + key,
+		Size:      size,
+		RefCount:  1,
+		CreatedAt: time.Now(),
+	}
+	if err := tx.Create(&blob).Error; err != nil {
+		tx.Rollback()
+		return blob, false, errUploadBlobConflict
+	}
+	// 保存文件时持有记录的锁, 避免与删除同一文件的操作交错
+	if err := put(); err != nil {
+		tx.Rollback()
+		return blob, false, err
+	}
+	return blob, false, tx.Commit().Error
+}
+
+// ReleaseUploadBlob 取消一次引用, 引用计数为0时删除文件和记录
+func ReleaseUploadBlob(hash string) error {
+	tx := DB.Begin()
+	var blob UploadBlob
+	err := tx.Set("gorm:query_option", "FOR UPDATE").Where("hash = ?", hash).First(&blob).Error
+	if gorm.IsRecordNotFoundError(err) {
+		tx.Rollback()
+		return nil
+	}
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	if blob.RefCount > 1 {
+		if err := tx.Model(&UploadBlob{}).Where("id = ?", blob.ID).UpdateColumn("ref_count", gorm.Expr("ref_count - 1")).Error; err != nil {
+			tx.Rollback()
+			return err
+		}
+		return tx.Commit().Error
+	}
+	if key, ok := tools.UploadFileKey(common.Upload, blob.Path); ok {
+		if err := common.GetStorage().Delete(key); err != nil {
+			log.Printf("delete upload blob %s error: %s", blob.Path, err)
+		}
+	}
+	if err := tx.Where("id = ?", blob.ID).Delete(UploadBlob{}).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit().Error
+}
+
+// UploadBlobStats 去重后实际保存的文件数和字节数
+func UploadBlobStats() (int64, int64) {
+	var stats struct {
+		Files int64
+		Bytes int64
+	}
+	DB.Model(&UploadBlob{}).Select("count(*) as files, coalesce(sum(size),0) as bytes").Scan(&stats)
+	return stats.Files, stats.Bytes
+}
@@ -0,0 +1,186 @@
+package models
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"goflylivechat/common"
+	"goflylivechat/models/dbtest"
+)
+
+// useUploadDir 把上传目录换成临时目录, 并写入一个文件
+func useUploadDir(t *testing.T, key string) string {
+	dir := t.TempDir() + "/"
+	old := common.Upload
+	common.Upload = dir
+	t.Cleanup(func() { common.Upload = old })
+	p := filepath.Join(dir, filepath.FromSlash(key))
+	if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(p, []byte("data"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func blobRows(refCount int64) *sqlmock.Rows {
+	return sqlmock.NewRows([]string{"id", "hash", "path", "size", "ref_count"}).
+		AddRow(7, "ab12", common.Upload+"ab/ab12.png", 4, refCount)
+}
+
+func TestAcquireUploadBlobNew(t *testing.T) {
+	mock := dbtest.Mock(t, &DB)
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT \\* FROM `upload_blob` WHERE \\(hash = \\?\\) .* FOR UPDATE").WithArgs("ab12").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	mock.ExpectExec("INSERT INTO `upload_blob`").WillReturnResult(sqlmock.NewResult(7, 1))
+	mock.ExpectCommit()
+	puts := 0
+	blob, exists, err := AcquireUploadBlob("ab12", "ab/ab12.png", 4, func() error {
+		puts++
+		return nil
+	})
+	if err != nil || exists || puts != 1 || blob.RefCount != 1 || blob.Path != common.Upload+"ab/ab12.png" {
+		t.Fatalf("AcquireUploadBlob() == %+v, %v, %v, puts %d", blob, exists, err, puts)
+	}
+}
+
+func TestAcquireUploadBlobExisting(t *testing.T) {
+	mock := dbtest.Mock(t, &DB)
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT \\* FROM `upload_blob` WHERE \\(hash = \\?\\) .* FOR UPDATE").WithArgs("ab12").
+		WillReturnRows(blobRows(1))
+	mock.ExpectExec("UPDATE `upload_blob` SET `ref_count` = ref_count \\+ 1").WithArgs(7).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	blob, exists, err := AcquireUploadBlob("ab12", "ab/ab12.png", 4, func() error {
+		t.Error("AcquireUploadBlob saved an existing blob again")
+		return nil
+	})
+	if err != nil || !exists || blob.RefCount != 2 {
+		t.Fatalf("AcquireUploadBlob() == %+v, %v, %v", blob, exists, err)
+	}
+}
+
+// 保存文件失败时不创建记录
+func TestAcquireUploadBlobPutError(t *testing.T) {
+	mock := dbtest.Mock(t, &DB)
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT \\* FROM `upload_blob`").WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	mock.ExpectExec("INSERT INTO `upload_blob`").WillReturnResult(sqlmock.NewResult(7, 1))
+	mock.ExpectRollback()
+	putErr := errors.New("disk full")
+	if _, _, err := AcquireUploadBlob("ab12", "ab/ab12.png", 4, func() error { return putErr }); err != putErr {
+		t.Fatalf("AcquireUploadBlob() error == %v, want %v", err, putErr)
+	}
+}
+
+// 删除原始上传记录时文件仍被其他记录引用, 只减少引用计数
+func TestReleaseUploadBlobStillReferenced(t *testing.T) {
+	p := useUploadDir(t, "ab/ab12.png")
+	mock := dbtest.Mock(t, &DB)
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT \\* FROM `upload_blob` WHERE \\(hash = \\?\\) .* FOR UPDATE").WithArgs("ab12").
+		WillReturnRows(blobRows(2))
+	mock.ExpectExec("UPDATE `upload_blob` SET `ref_count` = ref_count - 1").WithArgs(7).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	if err := ReleaseUploadBlob("ab12"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(p); err != nil {
+		t.Errorf("ReleaseUploadBlob deleted a referenced file: %v", err)
+	}
+}
+
+func TestReleaseUploadBlobLastReference(t *testing.T) {
+	p := useUploadDir(t, "ab/ab12.png")
+	mock := dbtest.Mock(t, &DB)
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT \\* FROM `upload_blob`").WithArgs("ab12").WillReturnRows(blobRows(1))
+	mock.ExpectExec("DELETE FROM `upload_blob` WHERE \\(id = \\?\\)").WithArgs(7).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	if err := ReleaseUploadBlob("ab12"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(p); !os.IsNotExist(err) {
+		t.Errorf("ReleaseUploadBlob kept the file of the last reference: %v", err)
+	}
+}
+
+// 没有记录的旧文件不处理
+func TestReleaseUploadBlobMissing(t *testing.T) {
+	mock := dbtest.Mock(t, &DB)
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT \\* FROM `upload_blob`").WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	mock.ExpectRollback()
+	if err := ReleaseUploadBlob("ab12"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestUploadPathQuarantined(t *testing.T) {
+	cases := []struct {
+		total, quarantined int
+		want               bool
+	}{
+		{0, 0, false},
+		{2, 2, true},
+		{2, 1, false},
+	}
+	for _, tc := range cases {
+		mock := dbtest.Mock(t, &DB)
+		mock.ExpectQuery("SELECT count\\(\\*\\) FROM `upload_file` WHERE .*\\(path = \\?\\)").WithArgs("static/upload/a.zip").
+			WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(tc.total))
+		mock.ExpectQuery("SELECT count\\(\\*\\) FROM `upload_file` WHERE .*\\(path = \\? and scan_status = \\?\\)").
+			WithArgs("static/upload/a.zip", common.ScanQuarantined).
+			WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(tc.quarantined))
+		if got := UploadPathQuarantined("static/upload/a.zip"); got != tc.want {
+			t.Errorf("UploadPathQuarantined() with %d of %d quarantined == %v", tc.quarantined, tc.total, got)
+		}
+	}
+}
+
+func TestUploadPathName(t *testing.T) {
+	mock := dbtest.Mock(t, &DB)
+	mock.ExpectQuery("SELECT distinct name FROM `upload_file`").WithArgs("static/upload/a.zip").
+		WillReturnRows(sqlmock.NewRows([]string{"name"}).AddRow("report.zip"))
+	mock.ExpectQuery("SELECT distinct name FROM `upload_file`").WithArgs("static/upload/a.zip").
+		WillReturnRows(sqlmock.NewRows([]string{"name"}).AddRow("report.zip").AddRow("salary.zip"))
+	if name := UploadPathName("static/upload/a.zip"); name != "report.zip" {
+		t.Errorf("UploadPathName() == %q", name)
+	}
+	if name := UploadPathName("static/upload/a.zip"); name != "" {
+		t.Errorf("UploadPathName() with different names == %q, want empty", name)
+	}
+}
+
+// 客服头像和快捷回复中引用的文件不按保留期限删除
+func TestPurgeUploadFilesBeforeInUse(t *testing.T) {
+	mock := dbtest.Mock(t, &DB)
+	mock.ExpectQuery("SELECT \\* FROM `upload_file` WHERE \\(created_at < \\? and id > \\?\\)").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "path", "size"}).
+			AddRow(1, common.Upload+"ab/avatar.png", 4).
+			AddRow(2, common.Upload+"ab/reply.png", 5).
+			AddRow(3, common.Upload+"ab/old.png", 6))
+	mock.ExpectQuery("SELECT count\\(\\*\\) FROM `user` WHERE .*\\(avator like \\?\\)").WithArgs("%ab/avatar.png").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+	mock.ExpectQuery("SELECT count\\(\\*\\) FROM `user` WHERE .*\\(avator like \\?\\)").WithArgs("%ab/reply.png").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+	mock.ExpectQuery("SELECT count\\(\\*\\) FROM `reply_item` WHERE \\(content like \\?\\)").WithArgs("%ab/reply.png%").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+	mock.ExpectQuery("SELECT count\\(\\*\\) FROM `user` WHERE .*\\(avator like \\?\\)").WithArgs("%ab/old.png").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+	mock.ExpectQuery("SELECT count\\(\\*\\) FROM `reply_item` WHERE \\(content like \\?\\)").WithArgs("%ab/old.png%").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+	result, err := PurgeUploadFilesBefore(time.Now(), 10, true)
+	if err != nil || result.Files != 1 || result.Bytes != 6 {
+		t.Fatalf("PurgeUploadFilesBefore() == %+v, %v, want only the unused file", result, err)
+	}
+}
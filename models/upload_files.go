@@ -0,0 +1,244 @@
+package models
+
+import (
+	"goflylivechat/common"
+	"goflylivechat/tools"
+	"log"
+	"sort"
+	"time"
+)
+
+// UploadFile 上传文件记录, 上传者为访客或客服
+// ScanStatus 为病毒扫描状态, 发现病毒被拒绝的文件只有记录, Path 为空
+// Hash 不为空时文件为去重保存的 UploadBlob, 相同内容的多条记录 Path 相同, ParentId 为缩略图对应的原图记录
+type UploadFile struct {
+	ID         uint      `gorm:"primary_key" json:"id"`
+	Path       string    `json:"path"`
+	Name       string    `json:"name"`
+	Mime       string    `json:"mime"`
+	Size       int64     `json:"size"`
+	Hash       string    `json:"hash"`
+	ParentId   uint      `json:"parent_id"`
+	VisitorId  string    `json:"visitor_id"`
+	KefuId     string    `json:"kefu_id"`
+	ScanStatus string    `json:"scan_status"`
+	ScanResult string    `json:"scan_result"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+func CreateUploadFile(file *UploadFile) {
+	file.CreatedAt = time.Now()
+	DB.Create(file)
+}
+func FindUploadFileByPath(path string) UploadFile {
+	var file UploadFile
+	if path == "" {
+		return file
+	}
+	DB.Where("path = ?", path).First(&file)
+	return file
+}
+
+// FindKefuUploadFile 客服自己上传的文件记录
+func FindKefuUploadFile(kefuName string, path string) UploadFile {
+	var file UploadFile
+	if kefuName == "" || path == "" {
+		return file
+	}
+	DB.Where("path = ? and kefu_id = ?", path, kefuName).First(&file)
+	return file
+}
+
+// UploadPathName 文件的全部上传记录使用同一个原文件名时返回该文件名
+// 相同内容的文件共用一个路径, 文件名不同时不能把其他人上传时的文件名返回给下载者
+func UploadPathName(path string) string {
+	var names []string
+	if path == "" {
+		return ""
+	}
+	DB.Model(&UploadFile{}).Where("path = ?", path).Limit(2).Pluck("distinct name", &names)
+	if len(names) != 1 {
+		return ""
+	}
+	return names[0]
+}
+
+// UploadPathQuarantined 文件的全部上传记录都在隔离中, 没有记录的旧文件不隔离
+func UploadPathQuarantined(path string) bool {
+	var total, quarantined uint
+	DB.Model(&UploadFile{}).Where("path = ?", path).Count(&total)
+	DB.Model(&UploadFile{}).Where("path = ? and scan_status = ?", path, common.ScanQuarantined).Count(&quarantined)
+	return total > 0 && total == quarantined
+}
+func FindUploadFileById(id uint) UploadFile {
+	var file UploadFile
+	DB.Where("id = ?", id).First(&file)
+	return file
+}
+func FindUploadFiles(page uint, pagesize uint, query interface{}, args ...interface{}) []UploadFile {
+	offset := (page - 1) * pagesize
+	var files []UploadFile
+	DB.Where(query, args...).Offset(offset).Limit(pagesize).Order("id desc").Find(&files)
+	return files
+}
+func CountUploadFiles(query interface{}, args ...interface{}) uint {
+	var count uint
+	DB.Model(&UploadFile{}).Where(query, args...).Count(&count)
+	return count
+}
+func UpdateUploadFileScanStatus(id uint, status string) {
+	DB.Model(&UploadFile{}).Where("id = ?", id).Update("scan_status", status)
+}
+
+// DeleteUploadFile 删除上传记录, 去重保存的文件没有其他引用时才删除
+func DeleteUploadFile(file UploadFile) {
+	DB.Where("id = ?", file.ID).Delete(UploadFile{})
+	releaseUploadFile(file)
+}
+
+// releaseUploadFile 上传记录删除后释放文件
+func releaseUploadFile(file UploadFile) bool {
+	if file.Hash == "" {
+		return file.Path != "" && removeUploadFile(file.Path)
+	}
+	if err := ReleaseUploadBlob(file.Hash); err != nil {
+		log.Printf("release upload blob %s error: %s", file.Hash, err)
+		return false
+	}
+	return true
+}
+
+// UploadPathInUse 客服头像和快捷回复中引用的文件一直使用, 不按保留期限删除
+// 路径中的哈希是唯一的, 按上传目录下的相对路径匹配, 不区分地址是否带有路由前缀
+func UploadPathInUse(path string) bool {
+	key, ok := tools.UploadFileKey(common.Upload, path)
+	if !ok {
+		return false
+	}
+	var count int
+	DB.Model(&User{}).Where("avator like ?", "%"+key).Count(&count)
+	if count > 0 {
+		return true
+	}
+	DB.Model(&ReplyItem{}).Where("content like ?", "%"+key+"%").Count(&count)
+	return count > 0
+}
+
+// PurgeUploadFilesBefore 分批删除早于before的上传记录和文件, 删除失败的文件保留记录, 下次再删除
+// 仍在使用的头像和快捷回复中的文件跳过
+func PurgeUploadFilesBefore(before time.Time, batch int, dryRun bool) (tools.PurgeResult, error) {
+	var result tools.PurgeResult
+	storage := common.GetStorage()
+	var lastId uint
+	for {
+		var files []UploadFile
+		if err := DB.Where("created_at < ? and id > ?", before, lastId).Order("id asc").Limit(batch).Find(&files).Error; err != nil {
+			return result, err
+		}
+		ids := make([]uint, 0, len(files))
+		released := make([]UploadFile, 0, len(files))
+		for _, file := range files {
+			lastId = file.ID
+			if UploadPathInUse(file.Path) {
+				continue
+			}
+			// 去重保存的文件在记录删除后按引用计数释放
+			if !dryRun && file.Hash == "" {
+				key, ok := tools.UploadFileKey(common.Upload, file.Path)
+				if ok {
+					if err := storage.Delete(key); err != nil {
+						log.Printf("delete upload file %s error: %s", file.Path, err)
+						continue
+					}
+				}
+			}
+			ids = append(ids, file.ID)
+			if file.Hash != "" {
+				released = append(released, file)
+			}
+			result.Files++
+			result.Bytes += file.Size
+		}
+		if !dryRun && len(ids) > 0 {
+			if err := DB.Where("id in (?)", ids).Delete(UploadFile{}).Error; err != nil {
+				return result, err
+			}
+			for _, file := range released {
+				releaseUploadFile(file)
+			}
+		}
+		if len(files) < batch {
+			return result, nil
+		}
+		time.Sleep(retentionBatchPause)
+	}
+}
+
+// UploadQuotaUsed 访客或客服从since开始上传的文件数和字节数, 不含缩略图
+func UploadQuotaUsed(column string, id string, since time.Time) (int64, int64) {
+	var used struct {
+		Files int64
+		Bytes int64
+	}
+	DB.Model(&UploadFile{}).Select("count(*) as files, coalesce(sum(size),0) as bytes").
+		Where(column+" = ? and parent_id = 0 and created_at >= ?", id, since).Scan(&used)
+	return used.Files, used.Bytes
+}
+
+// UploadFileStats 全部上传记录的文件数和字节数, 即去重前的大小
+func UploadFileStats() (int64, int64) {
+	var stats struct {
+		Files int64
+		Bytes int64
+	}
+	DB.Model(&UploadFile{}).Select("count(*) as files, coalesce(sum(size),0) as bytes").Where("path <> ''").Scan(&stats)
+	return stats.Files, stats.Bytes
+}
+
+// UploadUsage 客服的上传存储统计, Visitor 开头的为该客服接待的访客上传的文件
+type UploadUsage struct {
+	KefuId       string `json:"kefu_id"`
+	Files        int64  `json:"files"`
+	Bytes        int64  `json:"bytes"`
+	VisitorFiles int64  `json:"visitor_files"`
+	VisitorBytes int64  `json:"visitor_bytes"`
+}
+
+// FindUploadUsage 按客服统计上传文件, 包括缩略图, 不含被拒绝的文件
+func FindUploadUsage() []UploadUsage {
+	type row struct {
+		KefuId string
+		Files  int64
+		Bytes  int64
+	}
+	var own, visitors []row
+	DB.Model(&UploadFile{}).Select("kefu_id, count(*) as files, coalesce(sum(size),0) as bytes").
+		Where("kefu_id <> '' and path <> ''").Group("kefu_id").Scan(&own)
+	DB.Table("upload_file").Select("visitor.to_id as kefu_id, count(*) as files, coalesce(sum(upload_file.size),0) as bytes").
+		Joins("join visitor on visitor.visitor_id = upload_file.visitor_id").
+		Where("upload_file.visitor_id <> '' and upload_file.path <> ''").Group("visitor.to_id").Scan(&visitors)
+	usage := make(map[string]*UploadUsage)
+	list := make([]UploadUsage, 0)
+	get := func(kefuId string) *UploadUsage {
+		if u, ok := usage[kefuId]; ok {
+			return u
+		}
+		usage[kefuId] = &UploadUsage{KefuId: kefuId}
+		return usage[kefuId]
+	}
+	for _, r := range own {
+		u := get(r.KefuId)
+		u.Files, u.Bytes = r.Files, r.Bytes
+	}
+	for _, r := range visitors {
+		u := get(r.KefuId)
+		u.VisitorFiles, u.VisitorBytes = r.Files, r.Bytes
+	}
+	for _, u := range usage {
+		list = append(list, *u)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Bytes+list[i].VisitorBytes > list[j].Bytes+list[j].VisitorBytes
+	})
+	return list
+}
@@ -22,6 +22,17 @@ func CreateUserRole(userId uint, roleId uint) {
 	}
 	DB.Create(uRole)
 }
+
+// SaveUserRole 设置用户角色,一个用户只有一个角色
+func SaveUserRole(userId uint, roleId uint) {
+	DeleteRoleByUserId(userId)
+	CreateUserRole(userId, roleId)
+}
+func CountUserRoleByRoleId(roleId interface{}) uint {
+	var count uint
+	DB.Model(&User_role{}).Where("role_id = ?", roleId).Count(&count)
+	return count
+}
 func DeleteRoleByUserId(userId interface{}) {
 	DB.Where("user_id = ?", userId).Delete(User_role{})
 }
@@ -0,0 +1,76 @@
+package models
+
+import (
+	"strings"
+	"time"
+)
+
+// 客服两步验证, Enabled 为0表示已生成密钥但尚未完成绑定
+// RecoveryCodes 保存恢复码的sha256, 逗号分隔, 使用后删除
+type UserTotp struct {
+	ID            uint      `gorm:"primary_key" json:"id"`
+	UserName      string    `json:"user_name"`
+	Secret        string    `json:"-"`
+	Enabled       uint      `json:"enabled"`
+	RecoveryCodes string    `json:"-"`
+	LastCounter   uint64    `json:"-"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
+
+func FindUserTotp(userName string) UserTotp {
+	var t UserTotp
+	DB.Where("user_name = ?", userName).First(&t)
+	return t
+}
+
+// SaveUserTotpSecret 生成新的待绑定密钥,覆盖未完成的绑定
+func SaveUserTotpSecret(userName string, secret string) {
+	DeleteUserTotp(userName)
+	DB.Create(&UserTotp{
+		UserName:  userName,
+		Secret:    secret,
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+	})
+}
+func EnableUserTotp(userName string, recoveryHashes []string) {
+	DB.Model(&UserTotp{}).Where("user_name = ?", userName).Updates(map[string]interface{}{
+		"enabled":        1,
+		"recovery_codes": strings.Join(recoveryHashes, ","),
+		"updated_at":     time.Now(),
+	})
+}
+func UpdateUserTotpRecoveryCodes(userName string, recoveryHashes []string) {
+	DB.Model(&UserTotp{}).Where("user_name = ?", userName).Updates(map[string]interface{}{
+		"recovery_codes": strings.Join(recoveryHashes, ","),
+		"updated_at":     time.Now(),
+	})
+}
+
+// UseUserTotpCode 记录最后使用的验证码时间窗口序号
+// 同一窗口和更早窗口的验证码都不能再使用, 不同验证码交替重放也会被拒绝
+func UseUserTotpCode(userName string, counter uint64) bool {
+	return DB.Model(&UserTotp{}).Where("user_name = ? and last_counter < ?", userName, counter).
+		Update("last_counter", counter).RowsAffected > 0
+}
+
+// UseUserTotpRecoveryCode 使用一次性恢复码
+func UseUserTotpRecoveryCode(userName string, hash string) bool {
+	t := FindUserTotp(userName)
+	if t.ID == 0 || hash == "" {
+		return false
+	}
+	codes := strings.Split(t.RecoveryCodes, ",")
+	for i, c := range codes {
+		if c == hash {
+			codes = append(codes[:i], codes[i+1:]...)
+			return DB.Model(&UserTotp{}).Where("id = ? and recovery_codes = ?", t.ID, t.RecoveryCodes).
+				Update("recovery_codes", strings.Join(codes, ",")).RowsAffected > 0
+		}
+	}
+	return false
+}
+func DeleteUserTotp(userName string) {
+	DB.Where("user_name = ?", userName).Delete(UserTotp{})
+}
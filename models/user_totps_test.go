@@ -0,0 +1,34 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"goflylivechat/models/dbtest"
+)
+
+// TestUseUserTotpCode 已使用的时间窗口和更早窗口的验证码都不能再次使用
+func TestUseUserTotpCode(t *testing.T) {
+	mock := dbtest.Mock(t, &DB)
+	cases := []struct {
+		counter  uint64
+		affected int64
+	}{
+		{100, 1},
+		{100, 0},
+		{99, 0},
+		{101, 1},
+	}
+	for _, tc := range cases {
+		mock.ExpectBegin()
+		mock.ExpectExec("UPDATE `user_totp` SET `last_counter` = \\?, `updated_at` = \\? WHERE \\(user_name = \\? and last_counter < \\?\\)").
+			WithArgs(tc.counter, sqlmock.AnyArg(), "kefu1", tc.counter).
+			WillReturnResult(sqlmock.NewResult(0, tc.affected))
+		mock.ExpectCommit()
+	}
+	for _, tc := range cases {
+		if got := UseUserTotpCode("kefu1", tc.counter); got != (tc.affected > 0) {
+			t.Errorf("UseUserTotpCode(%d) == %v", tc.counter, got)
+		}
+	}
+}
@@ -8,11 +8,19 @@ import (
 type User struct {
 	Model
 	Name     string `json:"name"`
-	Password string `json:"password"`
+	Password string `json:"-"`
 	Nickname string `json:"nickname"`
 	Avator   string `json:"avator"`
 	RoleName string `json:"role_name" sql:"-"`
 	RoleId   string `json:"role_id" sql:"-"`
+	// 通过邀请注册的客服需要验证邮箱后才能登录
+	Email           string     `json:"email"`
+	EmailVerifiedAt *time.Time `json:"email_verified_at"`
+}
+
+// EmailUnverified 填写了邮箱但尚未验证
+func (u User) EmailUnverified() bool {
+	return u.Email != "" && u.EmailVerifiedAt == nil
 }
 
 func CreateUser(name string, password string, avator string, nickname string) uint {
@@ -37,12 +45,26 @@ func UpdateUser(name string, password string, avator string, nickname string) {
 	}
 	DB.Model(&User{}).Where("name = ?", name).Update(user)
 }
-func UpdateUserPass(name string, pass string) {
+func UpdateUserEmail(name string, email string) {
+	DB.Model(&User{}).Where("name = ?", name).Updates(map[string]interface{}{"email": email, "email_verified_at": nil})
+}
+
+// VerifyUserEmail 邮箱与验证链接中的一致时标记为已验证
+func VerifyUserEmail(name string, email string) bool {
+	return DB.Model(&User{}).Where("name = ? and email = ?", name, email).
+		Update("email_verified_at", time.Now()).RowsAffected == 1
+}
+
+// UpdateUserPass 修改密码, 密码字段保存不下哈希时不修改
+func UpdateUserPass(name string, pass string) error {
+	if err := CheckPasswordColumn(pass); err != nil {
+		return err
+	}
 	user := &User{
 		Password: pass,
 	}
 	user.UpdatedAt = time.Now()
-	DB.Model(user).Where("name = ?", name).Update("Password", pass)
+	return DB.Model(user).Where("name = ?", name).Update("Password", pass).Error
 }
 func UpdateUserAvator(name string, avator string) {
 	user := &User{
@@ -61,6 +83,11 @@ func FindUserById(id interface{}) User {
 	DB.Select("user.*,role.name role_name,role.id role_id").Joins("join user_role on user.id=user_role.user_id").Joins("join role on user_role.role_id=role.id").Where("user.id = ?", id).First(&user)
 	return user
 }
+func FindUserByUid(id interface{}) User {
+	var user User
+	DB.Where("id = ?", id).First(&user)
+	return user
+}
 func DeleteUserById(id string) {
 	DB.Where("id = ?", id).Delete(User{})
 }
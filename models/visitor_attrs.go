@@ -0,0 +1,80 @@
+package models
+
+import (
+	"goflylivechat/tools"
+	"time"
+)
+
+type VisitorAttr struct {
+	ID        uint      `gorm:"primary_key" json:"id"`
+	VisitorId string    `json:"visitor_id"`
+	AttrKey   string    `json:"attr_key"`
+	AttrLabel string    `json:"attr_label"`
+	AttrType  string    `json:"attr_type"`
+	AttrValue string    `json:"attr_value"`
+	AttrIndex string    `json:"-"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// SaveVisitorAttr 保存访客自定义属性,已存在则覆盖
+func SaveVisitorAttr(visitorId, key, label, attrType, value string) error {
+	encrypted, err := encryptField(value)
+	if err != nil {
+		return err
+	}
+	var attr VisitorAttr
+	DB.Where("visitor_id = ? and attr_key = ?", visitorId, key).First(&attr)
+	if attr.ID != 0 {
+		return DB.Model(&VisitorAttr{}).Where("id = ?", attr.ID).Updates(map[string]interface{}{
+			"attr_label": label,
+			"attr_type":  attrType,
+			"attr_value": encrypted,
+			"attr_index": tools.BlindIndex(value),
+			"updated_at": time.Now(),
+		}).Error
+	}
+	return DB.Create(&VisitorAttr{
+		VisitorId: visitorId,
+		AttrKey:   key,
+		AttrLabel: label,
+		AttrType:  attrType,
+		AttrValue: encrypted,
+		AttrIndex: tools.BlindIndex(value),
+		UpdatedAt: time.Now(),
+	}).Error
+}
+func FindVisitorAttrs(visitorId string) []VisitorAttr {
+	var attrs []VisitorAttr
+	DB.Where("visitor_id = ?", visitorId).Order("id asc").Find(&attrs)
+	return attrs
+}
+func FindVisitorAttr(visitorId string, key string) VisitorAttr {
+	var attr VisitorAttr
+	DB.Where("visitor_id = ? and attr_key = ?", visitorId, key).First(&attr)
+	return attr
+}
+
+// FindVisitorsByAttr 按自定义属性搜索客服名下的访客, 配置了盲索引时只能按完整值搜索
+func FindVisitorsByAttr(kefuId string, key string, value string, page uint, pagesize uint) []Visitor {
+	offset := (page - 1) * pagesize
+	if offset < 0 {
+		offset = 0
+	}
+	var visitors []Visitor
+	query := DB.Table("visitor").Select("distinct visitor.*").
+		Joins("join visitor_attr on visitor_attr.visitor_id=visitor.visitor_id").
+		Where("visitor.to_id = ?", kefuId)
+	if tools.BlindIndexEnabled() {
+		query = query.Where("visitor_attr.attr_index = ?", tools.BlindIndex(value))
+	} else {
+		query = query.Where("visitor_attr.attr_value like ?", "%"+value+"%")
+	}
+	if key != "" {
+		query = query.Where("visitor_attr.attr_key = ?", key)
+	}
+	query.Offset(offset).Limit(pagesize).Order("visitor.updated_at desc").Find(&visitors)
+	return visitors
+}
+func DeleteVisitorAttrs(visitorId string) {
+	DB.Where("visitor_id = ?", visitorId).Delete(VisitorAttr{})
+}
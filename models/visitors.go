@@ -6,20 +6,25 @@ import (
 
 type Visitor struct {
 	Model
-	Name        string `json:"name"`
-	Avator      string `json:"avator"`
-	SourceIp    string `json:"source_ip"`
-	ToId        string `json:"to_id"`
-	VisitorId   string `json:"visitor_id"`
-	Status      uint   `json:"status"`
-	Refer       string `json:"refer"`
-	City        string `json:"city"`
-	ClientIp    string `json:"client_ip"`
-	LastMessage string `json:"last_message"`
-	Extra       string `json:"extra"`
+	Name        string        `json:"name"`
+	Avator      string        `json:"avator"`
+	SourceIp    string        `json:"source_ip"`
+	ToId        string        `json:"to_id"`
+	VisitorId   string        `json:"visitor_id"`
+	Status      uint          `json:"status"`
+	Refer       string        `json:"refer"`
+	City        string        `json:"city"`
+	ClientIp    string        `json:"client_ip"`
+	LastMessage string        `json:"last_message"`
+	Extra       string        `json:"extra"`
+	Attrs       []VisitorAttr `json:"attrs" sql:"-"`
+	Token       string        `json:"token,omitempty" sql:"-"`
 }
 
-func CreateVisitor(name, avator, sourceIp, toId, visitorId, refer, city, clientIp, extra string) {
+func CreateVisitor(name, avator, sourceIp, toId, visitorId, refer, city, clientIp, extra string) error {
+	if err := encryptFields(&sourceIp, &clientIp, &extra); err != nil {
+		return err
+	}
 	v := &Visitor{
 		Name:      name,
 		Avator:    avator,
@@ -33,7 +38,7 @@ func CreateVisitor(name, avator, sourceIp, toId, visitorId, refer, city, clientI
 		Extra:     extra,
 	}
 	v.UpdatedAt = time.Now()
-	DB.Create(v)
+	return DB.Create(v).Error
 }
 func FindVisitorByVistorId(visitorId string) Visitor {
 	var v Visitor
@@ -65,15 +70,22 @@ func FindVisitorsOnline() []Visitor {
 	DB.Where("status = ?", 1).Find(&visitors)
 	return visitors
 }
-func UpdateVisitorLastMessage(visitorId, lastMessage string) {
+func UpdateVisitorLastMessage(visitorId, lastMessage string) error {
+	lastMessage, err := encryptField(lastMessage)
+	if err != nil {
+		return err
+	}
 	visitor := Visitor{}
-	DB.Model(&visitor).Where("visitor_id = ?", visitorId).Update("last_message", lastMessage)
+	return DB.Model(&visitor).Where("visitor_id = ?", visitorId).Update("last_message", lastMessage).Error
 }
 func UpdateVisitorStatus(visitorId string, status uint) {
 	visitor := Visitor{}
 	DB.Model(&visitor).Where("visitor_id = ?", visitorId).Update("status", status)
 }
-func UpdateVisitor(name, avator, visitorId string, status uint, clientIp string, sourceIp string, refer, extra string) {
+func UpdateVisitor(name, avator, visitorId string, status uint, clientIp string, sourceIp string, refer, extra string) error {
+	if err := encryptFields(&clientIp, &sourceIp, &extra); err != nil {
+		return err
+	}
 	visitor := &Visitor{
 		Status:   status,
 		ClientIp: clientIp,
@@ -84,7 +96,7 @@ func UpdateVisitor(name, avator, visitorId string, status uint, clientIp string,
 		Avator:   avator,
 	}
 	visitor.UpdatedAt = time.Now()
-	DB.Model(visitor).Where("visitor_id = ?", visitorId).Update(visitor)
+	return DB.Model(visitor).Where("visitor_id = ?", visitorId).Update(visitor).Error
 }
 func UpdateVisitorKefu(visitorId string, kefuId string) {
 	visitor := Visitor{}
@@ -18,35 +18,52 @@ func InitApiRouter(engine *gin.Engine) {
 		v2WithPrefix := engine.Group(prefix + "/2")
 		{
 			//获取消息
-			v2WithPrefix.GET("/messages", controller.GetMessagesV2)
+			v2WithPrefix.GET("/messages", middleware.VisitorAuth, middleware.DomainLimitMiddleware, controller.GetMessagesV2)
 			//发送单条信息
-			v2WithPrefix.POST("/message", middleware.Ipblack, controller.SendMessageV2)
+			v2WithPrefix.POST("/message", middleware.Ipblack, middleware.VisitorAuth, middleware.DomainLimitMiddleware, controller.SendMessageV2)
 			//关闭连接
-			v2WithPrefix.GET("/message_close", controller.SendCloseMessageV2)
+			v2WithPrefix.GET("/message_close", middleware.VisitorAuth, middleware.DomainLimitMiddleware, controller.SendCloseMessageV2)
 			//分页查询消息
-			v2WithPrefix.GET("/messagesPages", controller.GetMessagespages)
+			v2WithPrefix.GET("/messagesPages", middleware.VisitorAuth, middleware.DomainLimitMiddleware, controller.GetMessagespages)
 		}
 
 		engine.GET(prefix+"/captcha", controller.GetCaptcha)
+		engine.GET(prefix+"/captcha_id", controller.GetCaptchaId)
 		engine.POST(prefix+"/check", controller.LoginCheckPass)
+		engine.POST(prefix+"/token_refresh", controller.PostTokenRefresh)
+		engine.POST(prefix+"/logout", middleware.JwtApiMiddleware, controller.PostLogout)
+		engine.POST(prefix+"/check_totp", controller.PostCheckTotp)
+		engine.GET(prefix+"/totp", middleware.JwtApiMiddleware, middleware.RbacAuth, controller.GetTotp)
+		engine.POST(prefix+"/totp_setup", middleware.JwtApiMiddleware, middleware.RbacAuth, controller.PostTotpSetup)
+		engine.POST(prefix+"/totp_enable", middleware.JwtApiMiddleware, middleware.RbacAuth, controller.PostTotpEnable)
+		engine.POST(prefix+"/totp_recovery", middleware.JwtApiMiddleware, middleware.RbacAuth, controller.PostTotpRecovery)
+		engine.POST(prefix+"/totp_disable", middleware.JwtApiMiddleware, middleware.RbacAuth, controller.PostTotpDisable)
+		engine.POST(prefix+"/totp_reset", middleware.JwtApiMiddleware, middleware.RbacAuth, controller.PostTotpReset)
+		engine.POST(prefix+"/totp_policy", middleware.JwtApiMiddleware, middleware.RbacAuth, controller.PostTotpPolicy)
+		engine.GET(prefix+"/login_attempts", middleware.JwtApiMiddleware, middleware.RbacAuth, controller.GetLoginAttempts)
+		engine.POST(prefix+"/login_unlock", middleware.JwtApiMiddleware, middleware.RbacAuth, controller.PostLoginUnlock)
 
 		engine.GET(prefix+"/userinfo", middleware.JwtApiMiddleware, controller.GetKefuInfoAll)
 		engine.POST(prefix+"/register", middleware.Ipblack, controller.PostKefuRegister)
+		engine.GET(prefix+"/verify_email", controller.GetVerifyEmail)
+		engine.GET(prefix+"/register_invites", middleware.JwtApiMiddleware, middleware.RbacAuth, controller.GetRegisterInvites)
+		engine.POST(prefix+"/register_invite", middleware.JwtApiMiddleware, middleware.RbacAuth, controller.PostRegisterInvite)
+		engine.DELETE(prefix+"/register_invite", middleware.JwtApiMiddleware, middleware.RbacAuth, controller.DeleteRegisterInvite)
 		engine.POST(prefix+"/install", controller.PostInstall)
 		//前后聊天
 		engine.GET(prefix+"/ws_kefu", middleware.JwtApiMiddleware, ws.NewKefuServer)
-		engine.GET(prefix+"/ws_visitor", middleware.Ipblack, ws.NewVisitorServer)
+		engine.GET(prefix+"/ws_visitor", middleware.Ipblack, middleware.VisitorAuth, middleware.DomainLimitMiddleware, ws.NewVisitorServer)
 
-		engine.GET(prefix+"/messages", controller.GetVisitorMessage)
-		engine.GET(prefix+"/message_notice", controller.SendVisitorNotice)
+		engine.GET(prefix+"/messages", middleware.VisitorAuth, middleware.DomainLimitMiddleware, controller.GetVisitorMessage)
+		engine.GET(prefix+"/message_notice", middleware.JwtApiMiddleware, controller.SendVisitorNotice)
 		//上传文件
-		engine.POST(prefix+"/uploadimg", middleware.Ipblack, controller.UploadImg)
+		engine.POST(prefix+"/uploadimg", middleware.UploadLimit, middleware.Ipblack, middleware.VisitorAuth, middleware.DomainLimitMiddleware, controller.UploadImg)
 		//上传文件
-		engine.POST(prefix+"/uploadfile", middleware.Ipblack, controller.UploadFile)
+		engine.POST(prefix+"/uploadfile", middleware.UploadLimit, middleware.Ipblack, middleware.VisitorAuth, middleware.DomainLimitMiddleware, controller.UploadFile)
 		//获取未读消息数
-		engine.GET(prefix+"/message_status", controller.GetVisitorMessage)
+		engine.GET(prefix+"/message_status", middleware.VisitorAuth, middleware.DomainLimitMiddleware, controller.GetVisitorMessage)
 		//设置消息已读
-		engine.POST(prefix+"/message_status", controller.GetVisitorMessage)
+		engine.POST(prefix+"/message_status", middleware.VisitorAuth, middleware.DomainLimitMiddleware, controller.GetVisitorMessage)
 
 		//获取客服信息
 		engine.POST(prefix+"/kefuinfo_client", middleware.JwtApiMiddleware, controller.PostKefuClient)
@@ -62,15 +79,52 @@ func InitApiRouter(engine *gin.Engine) {
 		//角色列表
 		engine.GET(prefix+"/roles", middleware.JwtApiMiddleware, middleware.RbacAuth, controller.GetRoleList)
 		engine.POST(prefix+"/role", middleware.JwtApiMiddleware, middleware.RbacAuth, controller.PostRole)
+		engine.DELETE(prefix+"/role", middleware.JwtApiMiddleware, middleware.RbacAuth, controller.DelRole)
+		engine.GET(prefix+"/permissions", middleware.JwtApiMiddleware, middleware.RbacAuth, controller.GetPermissions)
+		engine.POST(prefix+"/user_role", middleware.JwtApiMiddleware, middleware.RbacAuth, controller.PostUserRole)
 
 		engine.GET(prefix+"/visitors_online", controller.GetVisitorOnlines)
 		engine.GET(prefix+"/visitors_kefu_online", middleware.JwtApiMiddleware, controller.GetKefusVisitorOnlines)
 		engine.GET(prefix+"/clear_online_tcp", controller.DeleteOnlineTcp)
-		engine.POST(prefix+"/visitor_login", middleware.Ipblack, controller.PostVisitorLogin)
+		engine.POST(prefix+"/visitor_login", middleware.Ipblack, middleware.DomainLimitMiddleware, controller.PostVisitorLogin)
+		//售前表单
+		engine.GET(prefix+"/prechat_form", middleware.DomainLimitMiddleware, controller.GetPrechatForm)
+		engine.GET(prefix+"/prechat_fields", middleware.JwtApiMiddleware, controller.GetPrechatFields)
+		engine.POST(prefix+"/prechat_field", middleware.JwtApiMiddleware, middleware.RbacAuth, controller.PostPrechatField)
+		engine.DELETE(prefix+"/prechat_field", middleware.JwtApiMiddleware, middleware.RbacAuth, controller.DelPrechatField)
+		engine.GET(prefix+"/visitors_search", middleware.JwtApiMiddleware, controller.GetVisitorsByAttr)
 		//engine.POST("/visitor", controller.PostVisitor)
 		engine.GET(prefix+"/visitor", middleware.JwtApiMiddleware, controller.GetVisitor)
 		engine.GET(prefix+"/visitors", middleware.JwtApiMiddleware, controller.GetVisitors)
 		engine.GET(prefix+"/statistics", middleware.JwtApiMiddleware, controller.GetStatistics)
+		//满意度评价
+		engine.POST(prefix+"/rate", middleware.Ipblack, middleware.VisitorAuth, middleware.DomainLimitMiddleware, controller.PostRate)
+		engine.GET(prefix+"/rates", middleware.JwtApiMiddleware, controller.GetRates)
+		engine.GET(prefix+"/csat_statistics", middleware.JwtApiMiddleware, middleware.RbacAuth, controller.GetCsatStatistics)
+		engine.GET(prefix+"/audits", middleware.JwtApiMiddleware, middleware.RbacAuth, controller.GetAudits)
+		engine.GET(prefix+"/audits_export", middleware.JwtApiMiddleware, middleware.RbacAuth, controller.GetAuditsExport)
+		engine.GET(prefix+"/visitor_data_export", middleware.JwtApiMiddleware, middleware.RbacAuth, controller.GetVisitorDataExport)
+		engine.DELETE(prefix+"/visitor_data", middleware.JwtApiMiddleware, middleware.RbacAuth, controller.DeleteVisitorData)
+		engine.GET(prefix+"/upload_scans", middleware.JwtApiMiddleware, middleware.RbacAuth, controller.GetUploadScans)
+		engine.POST(prefix+"/upload_scan_approve", middleware.JwtApiMiddleware, middleware.RbacAuth, controller.PostUploadScanApprove)
+		engine.DELETE(prefix+"/upload_scan", middleware.JwtApiMiddleware, middleware.RbacAuth, controller.DeleteUploadScan)
+		engine.GET(prefix+"/upload_scan_file", middleware.JwtApiMiddleware, middleware.RbacAuth, controller.GetUploadScanFile)
+		engine.GET(prefix+"/upload_usage", middleware.JwtApiMiddleware, middleware.RbacAuth, controller.GetUploadUsage)
+		//留言工单
+		engine.POST(prefix+"/ticket", middleware.Ipblack, middleware.VisitorAuth, middleware.DomainLimitMiddleware, controller.PostTicket)
+		engine.POST(prefix+"/ticket_inbound", controller.PostTicketInbound)
+		engine.GET(prefix+"/tickets", middleware.JwtApiMiddleware, controller.GetTickets)
+		engine.GET(prefix+"/ticket", middleware.JwtApiMiddleware, controller.GetTicket)
+		engine.POST(prefix+"/ticket_update", middleware.JwtApiMiddleware, controller.PostTicketUpdate)
+		engine.POST(prefix+"/ticket_reply", middleware.JwtApiMiddleware, controller.PostTicketReply)
+		//主动邀请
+		engine.POST(prefix+"/visitor_pageview", middleware.Ipblack, middleware.VisitorAuth, middleware.DomainLimitMiddleware, controller.PostVisitorPageview)
+		engine.GET(prefix+"/invite_rules", middleware.JwtApiMiddleware, controller.GetInviteRules)
+		engine.POST(prefix+"/invite_rule", middleware.JwtApiMiddleware, middleware.RbacAuth, controller.PostInviteRule)
+		engine.DELETE(prefix+"/invite_rule", middleware.JwtApiMiddleware, middleware.RbacAuth, controller.DelInviteRule)
+		engine.POST(prefix+"/schedule_message", middleware.JwtApiMiddleware, controller.PostScheduleMessage)
+		engine.GET(prefix+"/schedule_messages", middleware.JwtApiMiddleware, controller.GetScheduleMessages)
+		engine.DELETE(prefix+"/schedule_message", middleware.JwtApiMiddleware, controller.DelScheduleMessage)
 		//前台接口
 		engine.GET(prefix+"/about", controller.GetAbout)
 		engine.POST(prefix+"/about", middleware.JwtApiMiddleware, middleware.RbacAuth, controller.PostAbout)
@@ -78,10 +132,13 @@ func InitApiRouter(engine *gin.Engine) {
 		engine.GET(prefix+"/notice", controller.GetNotice)
 		engine.POST(prefix+"/ipblack", middleware.JwtApiMiddleware, middleware.Ipblack, controller.PostIpblack)
 		engine.DELETE(prefix+"/ipblack", middleware.JwtApiMiddleware, middleware.RbacAuth, controller.DelIpblack)
-		engine.GET(prefix+"/ipblacks_all", middleware.JwtApiMiddleware, controller.GetIpblacks)
+		engine.GET(prefix+"/ipblacks_all", middleware.JwtApiMiddleware, middleware.RbacAuth, controller.GetIpblacks)
 		engine.GET(prefix+"/ipblacks", middleware.JwtApiMiddleware, controller.GetIpblacksByKefuId)
 		engine.GET(prefix+"/configs", middleware.JwtApiMiddleware, middleware.RbacAuth, controller.GetConfigs)
 		engine.POST(prefix+"/config", middleware.JwtApiMiddleware, middleware.RbacAuth, controller.PostConfig)
+		engine.POST(prefix+"/visitor_identity_secret", middleware.JwtApiMiddleware, middleware.RbacAuth, controller.PostVisitorIdentitySecret)
+		engine.GET(prefix+"/site_domains", middleware.JwtApiMiddleware, middleware.RbacAuth, controller.GetSiteDomains)
+		engine.POST(prefix+"/site_domains", middleware.JwtApiMiddleware, middleware.RbacAuth, controller.PostSiteDomains)
 		engine.GET(prefix+"/config", controller.GetConfig)
 		engine.GET(prefix+"/autoreply", controller.GetAutoReplys)
 		engine.GET(prefix+"/replys", middleware.JwtApiMiddleware, controller.GetReplys)
@@ -107,35 +164,52 @@ func InitApiRouter(engine *gin.Engine) {
 	v2 := engine.Group("/2")
 	{
 		//获取消息
-		v2.GET("/messages", controller.GetMessagesV2)
+		v2.GET("/messages", middleware.VisitorAuth, middleware.DomainLimitMiddleware, controller.GetMessagesV2)
 		//发送单条信息
-		v2.POST("/message", middleware.Ipblack, controller.SendMessageV2)
+		v2.POST("/message", middleware.Ipblack, middleware.VisitorAuth, middleware.DomainLimitMiddleware, controller.SendMessageV2)
 		//关闭连接
-		v2.GET("/message_close", controller.SendCloseMessageV2)
+		v2.GET("/message_close", middleware.VisitorAuth, middleware.DomainLimitMiddleware, controller.SendCloseMessageV2)
 		//分页查询消息
-		v2.GET("/messagesPages", controller.GetMessagespages)
+		v2.GET("/messagesPages", middleware.VisitorAuth, middleware.DomainLimitMiddleware, controller.GetMessagespages)
 	}
 
 	engine.GET("/captcha", controller.GetCaptcha)
+	engine.GET("/captcha_id", controller.GetCaptchaId)
 	engine.POST("/check", controller.LoginCheckPass)
+	engine.POST("/token_refresh", controller.PostTokenRefresh)
+	engine.POST("/logout", middleware.JwtApiMiddleware, controller.PostLogout)
+	engine.POST("/check_totp", controller.PostCheckTotp)
+	engine.GET("/totp", middleware.JwtApiMiddleware, middleware.RbacAuth, controller.GetTotp)
+	engine.POST("/totp_setup", middleware.JwtApiMiddleware, middleware.RbacAuth, controller.PostTotpSetup)
+	engine.POST("/totp_enable", middleware.JwtApiMiddleware, middleware.RbacAuth, controller.PostTotpEnable)
+	engine.POST("/totp_recovery", middleware.JwtApiMiddleware, middleware.RbacAuth, controller.PostTotpRecovery)
+	engine.POST("/totp_disable", middleware.JwtApiMiddleware, middleware.RbacAuth, controller.PostTotpDisable)
+	engine.POST("/totp_reset", middleware.JwtApiMiddleware, middleware.RbacAuth, controller.PostTotpReset)
+	engine.POST("/totp_policy", middleware.JwtApiMiddleware, middleware.RbacAuth, controller.PostTotpPolicy)
+	engine.GET("/login_attempts", middleware.JwtApiMiddleware, middleware.RbacAuth, controller.GetLoginAttempts)
+	engine.POST("/login_unlock", middleware.JwtApiMiddleware, middleware.RbacAuth, controller.PostLoginUnlock)
 
 	engine.GET("/userinfo", middleware.JwtApiMiddleware, controller.GetKefuInfoAll)
 	engine.POST("/register", middleware.Ipblack, controller.PostKefuRegister)
+	engine.GET("/verify_email", controller.GetVerifyEmail)
+	engine.GET("/register_invites", middleware.JwtApiMiddleware, middleware.RbacAuth, controller.GetRegisterInvites)
+	engine.POST("/register_invite", middleware.JwtApiMiddleware, middleware.RbacAuth, controller.PostRegisterInvite)
+	engine.DELETE("/register_invite", middleware.JwtApiMiddleware, middleware.RbacAuth, controller.DeleteRegisterInvite)
 	engine.POST("/install", controller.PostInstall)
 	//前后聊天
 	engine.GET("/ws_kefu", middleware.JwtApiMiddleware, ws.NewKefuServer)
-	engine.GET("/ws_visitor", middleware.Ipblack, ws.NewVisitorServer)
+	engine.GET("/ws_visitor", middleware.Ipblack, middleware.VisitorAuth, middleware.DomainLimitMiddleware, ws.NewVisitorServer)
 
-	engine.GET("/messages", controller.GetVisitorMessage)
-	engine.GET("/message_notice", controller.SendVisitorNotice)
+	engine.GET("/messages", middleware.VisitorAuth, middleware.DomainLimitMiddleware, controller.GetVisitorMessage)
+	engine.GET("/message_notice", middleware.JwtApiMiddleware, controller.SendVisitorNotice)
 	//上传文件
-	engine.POST("/uploadimg", middleware.Ipblack, controller.UploadImg)
+	engine.POST("/uploadimg", middleware.UploadLimit, middleware.Ipblack, middleware.VisitorAuth, middleware.DomainLimitMiddleware, controller.UploadImg)
 	//上传文件
-	engine.POST("/uploadfile", middleware.Ipblack, controller.UploadFile)
+	engine.POST("/uploadfile", middleware.UploadLimit, middleware.Ipblack, middleware.VisitorAuth, middleware.DomainLimitMiddleware, controller.UploadFile)
 	//获取未读消息数
-	engine.GET("/message_status", controller.GetVisitorMessage)
+	engine.GET("/message_status", middleware.VisitorAuth, middleware.DomainLimitMiddleware, controller.GetVisitorMessage)
 	//设置消息已读
-	engine.POST("/message_status", controller.GetVisitorMessage)
+	engine.POST("/message_status", middleware.VisitorAuth, middleware.DomainLimitMiddleware, controller.GetVisitorMessage)
 
 	//获取客服信息
 	engine.POST("/kefuinfo_client", middleware.JwtApiMiddleware, controller.PostKefuClient)
@@ -151,15 +225,52 @@ func InitApiRouter(engine *gin.Engine) {
 	//角色列表
 	engine.GET("/roles", middleware.JwtApiMiddleware, middleware.RbacAuth, controller.GetRoleList)
 	engine.POST("/role", middleware.JwtApiMiddleware, middleware.RbacAuth, controller.PostRole)
+	engine.DELETE("/role", middleware.JwtApiMiddleware, middleware.RbacAuth, controller.DelRole)
+	engine.GET("/permissions", middleware.JwtApiMiddleware, middleware.RbacAuth, controller.GetPermissions)
+	engine.POST("/user_role", middleware.JwtApiMiddleware, middleware.RbacAuth, controller.PostUserRole)
 
 	engine.GET("/visitors_online", controller.GetVisitorOnlines)
 	engine.GET("/visitors_kefu_online", middleware.JwtApiMiddleware, controller.GetKefusVisitorOnlines)
 	engine.GET("/clear_online_tcp", controller.DeleteOnlineTcp)
-	engine.POST("/visitor_login", middleware.Ipblack, controller.PostVisitorLogin)
+	engine.POST("/visitor_login", middleware.Ipblack, middleware.DomainLimitMiddleware, controller.PostVisitorLogin)
+	//售前表单
+	engine.GET("/prechat_form", middleware.DomainLimitMiddleware, controller.GetPrechatForm)
+	engine.GET("/prechat_fields", middleware.JwtApiMiddleware, controller.GetPrechatFields)
+	engine.POST("/prechat_field", middleware.JwtApiMiddleware, middleware.RbacAuth, controller.PostPrechatField)
+	engine.DELETE("/prechat_field", middleware.JwtApiMiddleware, middleware.RbacAuth, controller.DelPrechatField)
+	engine.GET("/visitors_search", middleware.JwtApiMiddleware, controller.GetVisitorsByAttr)
 	//engine.POST("/visitor", controller.PostVisitor)
 	engine.GET("/visitor", middleware.JwtApiMiddleware, controller.GetVisitor)
 	engine.GET("/visitors", middleware.JwtApiMiddleware, controller.GetVisitors)
 	engine.GET("/statistics", middleware.JwtApiMiddleware, controller.GetStatistics)
+	//满意度评价
+	engine.POST("/rate", middleware.Ipblack, middleware.VisitorAuth, middleware.DomainLimitMiddleware, controller.PostRate)
+	engine.GET("/rates", middleware.JwtApiMiddleware, controller.GetRates)
+	engine.GET("/csat_statistics", middleware.JwtApiMiddleware, middleware.RbacAuth, controller.GetCsatStatistics)
+	engine.GET("/audits", middleware.JwtApiMiddleware, middleware.RbacAuth, controller.GetAudits)
+	engine.GET("/audits_export", middleware.JwtApiMiddleware, middleware.RbacAuth, controller.GetAuditsExport)
+	engine.GET("/visitor_data_export", middleware.JwtApiMiddleware, middleware.RbacAuth, controller.GetVisitorDataExport)
+	engine.DELETE("/visitor_data", middleware.JwtApiMiddleware, middleware.RbacAuth, controller.DeleteVisitorData)
+	engine.GET("/upload_scans", middleware.JwtApiMiddleware, middleware.RbacAuth, controller.GetUploadScans)
+	engine.POST("/upload_scan_approve", middleware.JwtApiMiddleware, middleware.RbacAuth, controller.PostUploadScanApprove)
+	engine.DELETE("/upload_scan", middleware.JwtApiMiddleware, middleware.RbacAuth, controller.DeleteUploadScan)
+	engine.GET("/upload_scan_file", middleware.JwtApiMiddleware, middleware.RbacAuth, controller.GetUploadScanFile)
+	engine.GET("/upload_usage", middleware.JwtApiMiddleware, middleware.RbacAuth, controller.GetUploadUsage)
+	//留言工单
+	engine.POST("/ticket", middleware.Ipblack, middleware.VisitorAuth, middleware.DomainLimitMiddleware, controller.PostTicket)
+	engine.POST("/ticket_inbound", controller.PostTicketInbound)
+	engine.GET("/tickets", middleware.JwtApiMiddleware, controller.GetTickets)
+	engine.GET("/ticket", middleware.JwtApiMiddleware, controller.GetTicket)
+	engine.POST("/ticket_update", middleware.JwtApiMiddleware, controller.PostTicketUpdate)
+	engine.POST("/ticket_reply", middleware.JwtApiMiddleware, controller.PostTicketReply)
+	//主动邀请
+	engine.POST("/visitor_pageview", middleware.Ipblack, middleware.VisitorAuth, middleware.DomainLimitMiddleware, controller.PostVisitorPageview)
+	engine.GET("/invite_rules", middleware.JwtApiMiddleware, controller.GetInviteRules)
+	engine.POST("/invite_rule", middleware.JwtApiMiddleware, middleware.RbacAuth, controller.PostInviteRule)
+	engine.DELETE("/invite_rule", middleware.JwtApiMiddleware, middleware.RbacAuth, controller.DelInviteRule)
+	engine.POST("/schedule_message", middleware.JwtApiMiddleware, controller.PostScheduleMessage)
+	engine.GET("/schedule_messages", middleware.JwtApiMiddleware, controller.GetScheduleMessages)
+	engine.DELETE("/schedule_message", middleware.JwtApiMiddleware, controller.DelScheduleMessage)
 	//前台接口
 	engine.GET("/about", controller.GetAbout)
 	engine.POST("/about", middleware.JwtApiMiddleware, middleware.RbacAuth, controller.PostAbout)
@@ -167,10 +278,13 @@ func InitApiRouter(engine *gin.Engine) {
 	engine.GET("/notice", controller.GetNotice)
 	engine.POST("/ipblack", middleware.JwtApiMiddleware, middleware.Ipblack, controller.PostIpblack)
 	engine.DELETE("/ipblack", middleware.JwtApiMiddleware, middleware.RbacAuth, controller.DelIpblack)
-	engine.GET("/ipblacks_all", middleware.JwtApiMiddleware, controller.GetIpblacks)
+	engine.GET("/ipblacks_all", middleware.JwtApiMiddleware, middleware.RbacAuth, controller.GetIpblacks)
 	engine.GET("/ipblacks", middleware.JwtApiMiddleware, controller.GetIpblacksByKefuId)
 	engine.GET("/configs", middleware.JwtApiMiddleware, middleware.RbacAuth, controller.GetConfigs)
 	engine.POST("/config", middleware.JwtApiMiddleware, middleware.RbacAuth, controller.PostConfig)
+	engine.POST("/visitor_identity_secret", middleware.JwtApiMiddleware, middleware.RbacAuth, controller.PostVisitorIdentitySecret)
+	engine.GET("/site_domains", middleware.JwtApiMiddleware, middleware.RbacAuth, controller.GetSiteDomains)
+	engine.POST("/site_domains", middleware.JwtApiMiddleware, middleware.RbacAuth, controller.PostSiteDomains)
 	engine.GET("/config", controller.GetConfig)
 	engine.GET("/autoreply", controller.GetAutoReplys)
 	engine.GET("/replys", middleware.JwtApiMiddleware, controller.GetReplys)
@@ -0,0 +1,66 @@
+package router
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"goflylivechat/common"
+)
+
+// TestRbacRoutesHavePermission 经过RbacAuth的路由都要在RoutePermissions中配置权限, 否则任何角色都无法访问
+func TestRbacRoutesHavePermission(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	engine := gin.New()
+	protected := make(map[string]bool)
+	// 在所有路由前记录处理链中是否有RbacAuth, 然后直接结束请求
+	engine.Use(func(c *gin.Context) {
+		for _, name := range c.HandlerNames() {
+			if strings.HasSuffix(name, "middleware.RbacAuth") {
+				protected[c.Request.Method+" "+c.FullPath()] = true
+			}
+		}
+		c.AbortWithStatus(http.StatusNoContent)
+	})
+	InitApiRouter(engine)
+
+	routes := engine.Routes()
+	if len(routes) == 0 {
+		t.Fatal("no routes registered")
+	}
+	for _, route := range routes {
+		parts := strings.Split(route.Path, "/")
+		for i, part := range parts {
+			if strings.HasPrefix(part, ":") || strings.HasPrefix(part, "*") {
+				parts[i] = "1"
+			}
+		}
+		w := httptest.NewRecorder()
+		engine.ServeHTTP(w, httptest.NewRequest(route.Method, strings.Join(parts, "/"), nil))
+		if w.Code != http.StatusNoContent {
+			t.Errorf("%s %s was not routed, status %d", route.Method, route.Path, w.Code)
+		}
+	}
+	if len(protected) == 0 {
+		t.Fatal("no routes use RbacAuth")
+	}
+	prefix := common.GetPrefix()
+	mapped := make(map[string]bool)
+	for route := range protected {
+		method, path, _ := strings.Cut(route, " ")
+		if prefix != "" && strings.HasPrefix(path, prefix+"/") {
+			path = strings.TrimPrefix(path, prefix)
+		}
+		if common.RoutePermission(method, path) == "" {
+			t.Errorf("%s %s uses RbacAuth but has no permission in RoutePermissions", method, path)
+		}
+		mapped[method+" "+path] = true
+	}
+	for route := range common.RoutePermissions {
+		if !mapped[route] {
+			t.Errorf("RoutePermissions has %q but no RbacAuth route uses it", route)
+		}
+	}
+}
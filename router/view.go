@@ -2,6 +2,7 @@ package router
 
 import (
 	"goflylivechat/common"
+	"goflylivechat/middleware"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
@@ -14,19 +15,23 @@ func InitViewRouter(engine *gin.Engine) {
 
 		engine.GET(prefix+"/login", PageLogin)
 		engine.GET(prefix+"/pannel", PagePannel)
-		engine.GET(prefix+"/livechat", PageChat)
+		engine.GET(prefix+"/livechat", middleware.DomainLimitMiddleware, PageChat)
 		engine.GET(prefix+"/main", PageMain)
 		engine.GET(prefix+"/chat_main", PageChatMain)
 		engine.GET(prefix+"/setting", PageSetting)
+		engine.GET(prefix+"/setting_csat", PageSettingCsat)
+		engine.GET(prefix+"/setting_audit", PageSettingAudit)
 	}
 
 	// 注册无前缀的路由（直接访问）
 	engine.GET("/login", PageLogin)
 	engine.GET("/pannel", PagePannel)
-	engine.GET("/livechat", PageChat)
+	engine.GET("/livechat", middleware.DomainLimitMiddleware, PageChat)
 	engine.GET("/main", PageMain)
 	engine.GET("/chat_main", PageChatMain)
 	engine.GET("/setting", PageSetting)
+	engine.GET("/setting_csat", PageSettingCsat)
+	engine.GET("/setting_audit", PageSettingAudit)
 }
 
 // PageLogin Login page
@@ -34,7 +39,8 @@ func PageLogin(c *gin.Context) {
 	basePath := common.GetDynamicBasePath(c)
 
 	c.HTML(http.StatusOK, "login.html", gin.H{
-		"BasePath": basePath,
+		"BasePath":     basePath,
+		"RegisterMode": common.GetSecurity().RegisterMode,
 	})
 }
 
@@ -92,3 +98,21 @@ func PageSetting(c *gin.Context) {
 		"BasePath": basePath,
 	})
 }
+
+// PageSettingCsat Satisfaction report
+func PageSettingCsat(c *gin.Context) {
+	basePath := common.GetDynamicBasePath(c)
+
+	c.HTML(http.StatusOK, "setting_csat.html", gin.H{
+		"BasePath": basePath,
+	})
+}
+
+// PageSettingAudit Audit log
+func PageSettingAudit(c *gin.Context) {
+	basePath := common.GetDynamicBasePath(c)
+
+	c.HTML(http.StatusOK, "setting_audit.html", gin.H{
+		"BasePath": basePath,
+	})
+}
@@ -2,10 +2,14 @@ const CHAT_WIDGET = {
     API_URL: "",
     AGENT_ID: "",
     AUTO_OPEN: true,
+    // 页面打开时在后台加载客服窗口, 用于主动邀请; 每次浏览都会登录访客并通知客服, 默认关闭
+    PROACTIVE: false,
     DISPLAY_MODE: 1,
     USER_ID: "",
     USER_NAME: "",
     USER_AVATAR: "",
+    // 接入网站服务端签名的用户身份, base64编码的json
+    IDENTITY: "",
     isChatOpen: false,
     originalPageTitle: document.title,
     chatWindowTitle: "欢迎使用在线客服咨询!",
@@ -131,6 +135,11 @@ CHAT_WIDGET.createChatButton = function() {
         this.openChatWindow();
     });
 
+    // Load the chat in the background so the agent can send invitations
+    if (this.PROACTIVE) {
+        this.createChatContainer();
+    }
+
     // Open automatically if configured
     if (this.AUTO_OPEN) {
         setTimeout(() => {
@@ -146,6 +155,17 @@ CHAT_WIDGET.openChatWindow = function() {
     badge.style.display = 'none';
     badge.textContent = '0';
 
+    this.createChatContainer();
+
+    // Show the chat window
+    document.getElementById(this.containerId).style.display = 'flex';
+    this.isChatOpen = true;
+
+    // Hide the floating button
+    document.getElementById('chat-widget-button').style.display = 'none';
+};
+
+CHAT_WIDGET.createChatContainer = function() {
     // Create container if it doesn't exist
     if (!document.getElementById(this.containerId)) {
         const container = document.createElement('div');
@@ -164,13 +184,6 @@ CHAT_WIDGET.openChatWindow = function() {
             this.closeChatWindow();
         });
     }
-
-    // Show the chat window
-    document.getElementById(this.containerId).style.display = 'flex';
-    this.isChatOpen = true;
-
-    // Hide the floating button
-    document.getElementById('chat-widget-button').style.display = 'none';
 };
 
 CHAT_WIDGET.closeChatWindow = function() {
@@ -180,7 +193,7 @@ CHAT_WIDGET.closeChatWindow = function() {
 };
 
 CHAT_WIDGET.buildChatUrl = function() {
-    let url = `${this.API_URL}/livechat?user_id=${this.AGENT_ID}`;
+    let url = `${this.API_URL}/livechat?user_id=${this.AGENT_ID}&refer=${encodeURIComponent(window.location.href)}`;
 
     if (this.USER_ID) {
         url += `&user_id=${this.USER_ID}`;
@@ -191,6 +204,9 @@ CHAT_WIDGET.buildChatUrl = function() {
     if (this.USER_AVATAR) {
         url += `&avatar=${encodeURIComponent(this.USER_AVATAR)}`;
     }
+    if (this.IDENTITY) {
+        url += `&identity=${encodeURIComponent(this.IDENTITY)}`;
+    }
 
     return url;
 };
@@ -204,6 +220,9 @@ CHAT_WIDGET.setupEventHandlers = function() {
             case 'new_message':
                 this.handleIncomingMessage(e.data);
                 break;
+            case 'invite':
+                this.openChatWindow();
+                break;
             case 'close_chat':
                 this.closeChatWindow();
                 break;
@@ -130,14 +130,22 @@ function replaceContent (content,baseUrl) {// 转义聊天内容中的特殊字
             var alt = face.replace(/^face/g, '');
             return '<img alt="' + alt + '" title="' + alt + '" src="'+baseUrl + faces[alt] + '">';
         })
-        .replace(/img\[(.*?)\]/g, function (face) {  // 转义图片
-            var src = face.replace(/^img\[/g, '').replace(/\]/g, '');;
-            return '<img onclick="bigPic(src,true)" src="' +baseUrl+ src + '" style="max-width: 150px"/></div>';
+        .replace(/img\[(.*?)\]/g, function (face) {  // 转义图片, 格式为 img[原图|缩略图], 显示缩略图, 点击查看原图
+            var src = face.replace(/^img\[/g, '').replace(/\]/g, '').split('|');
+            var preview = src.length > 1 && src[1] ? src[1] : src[0];
+            return '<img onclick="bigPic(this.getAttribute(\'data-src\'),true)" data-src="' +baseUrl+ src[0] + '" src="' +baseUrl+ preview + '" style="max-width: 150px"/></div>';
         })
         .replace(/\n/g, '<br>'); // 转义换行
     content=replaceAttachment(content);
     return content;
 }
+//上传图片后的消息内容, 有缩略图时带上缩略图地址
+function imageMessage(result){
+    if(result.thumb && result.thumb!=result.path){
+        return 'img[/' + result.path + '|/' + result.thumb + ']';
+    }
+    return 'img[/' + result.path + ']';
+}
 //替换附件展示
 function replaceAttachment(str){
     return str.replace(/attachment\[(.*?)\]/g, function (result) {
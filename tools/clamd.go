@@ -0,0 +1,138 @@
+package tools
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"time"
+)
+
+// ClamdScanner 使用clamd的INSTREAM命令扫描文件, 地址为 tcp://host:port 或 unix:///path/clamd.sock
+type ClamdScanner struct {
+	Network   string
+	Address   string
+	Timeout   time.Duration
+	ChunkSize int
+}
+
+// ScanResult 扫描结果, Infected 为true时 Signature 为病毒名称
+type ScanResult struct {
+	Infected  bool
+	Signature string
+}
+
+// NewClamdScanner 解析clamd地址, 不带协议的地址按tcp处理
+func NewClamdScanner(addr string, timeout time.Duration) (*ClamdScanner, error) {
+	network, address := "tcp", addr
+	switch {
+	case strings.HasPrefix(addr, "tcp://"):
+		address = strings.TrimPrefix(addr, "tcp://")
+	case strings.HasPrefix(addr, "unix://"):
+		network, address = "unix", strings.TrimPrefix(addr, "unix://")
+	case strings.HasPrefix(addr, "/"):
+		network = "unix"
+	}
+	if address == "" {
+		return nil, errors.New("clamd address is empty")
+	}
+	if network == "tcp" {
+		if _, _, err := net.SplitHostPort(address); err != nil {
+			return nil, errors.New("clamd address must be host:port: " + err.Error())
+		}
+	}
+	if timeout <= 0 {
+		timeout = 30 * time.Second
+	}
+	return &ClamdScanner{Network: network, Address: address, Timeout: timeout, ChunkSize: 64 * 1024}, nil
+}
+
+// Ping 检查clamd是否可用
+func (s *ClamdScanner) Ping() error {
+	reply, err := s.command("zPING\x00", nil)
+	if err != nil {
+		return err
+	}
+	if reply != "PONG" {
+		return errors.New("clamd ping: " + reply)
+	}
+	return nil
+}
+
+// Scan 按INSTREAM协议分块发送文件内容, 每块为4字节大端长度加数据, 以长度0结束
+func (s *ClamdScanner) Scan(r io.Reader) (ScanResult, error) {
+	reply, err := s.command("zINSTREAM\x00", func(conn net.Conn) error {
+		size := s.ChunkSize
+		if size <= 0 {
+			size = 64 * 1024
+		}
+		buf := make([]byte, 4+size)
+		for {
+			n, err := io.ReadFull(r, buf[4:])
+			if n > 0 {
+				binary.BigEndian.PutUint32(buf, uint32(n))
+				if _, werr := conn.Write(buf[:4+n]); werr != nil {
+					return werr
+				}
+			}
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				break
+			}
+			if err != nil {
+				return err
+			}
+		}
+		_, err := conn.Write([]byte{0, 0, 0, 0})
+		return err
+	})
+	if err != nil {
+		return ScanResult{}, err
+	}
+	return parseClamdReply(reply)
+}
+
+// command 每个命令使用一个新连接, 读取以\0结尾的回复
+func (s *ClamdScanner) command(cmd string, body func(conn net.Conn) error) (string, error) {
+	conn, err := net.DialTimeout(s.Network, s.Address, s.Timeout)
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(s.Timeout))
+	if _, err := conn.Write([]byte(cmd)); err != nil {
+		return "", err
+	}
+	var bodyErr error
+	if body != nil {
+		bodyErr = body(conn)
+	}
+	// 超过大小限制时clamd先回复错误再关闭连接, 发送失败时仍然读取回复
+	reply, err := bufio.NewReader(conn).ReadString(0)
+	reply = strings.TrimSpace(strings.TrimSuffix(reply, "\x00"))
+	if reply == "" {
+		if bodyErr != nil {
+			return "", bodyErr
+		}
+		if err == nil {
+			err = errors.New("clamd returned an empty reply")
+		}
+		return "", err
+	}
+	return reply, nil
+}
+
+// parseClamdReply 解析 "stream: OK" "stream: Eicar-Signature FOUND" 和 "... ERROR"
+func parseClamdReply(reply string) (ScanResult, error) {
+	if i := strings.Index(reply, ": "); i >= 0 {
+		reply = reply[i+2:]
+	}
+	switch {
+	case reply == "OK":
+		return ScanResult{}, nil
+	case strings.HasSuffix(reply, " FOUND"):
+		return ScanResult{Infected: true, Signature: strings.TrimSuffix(reply, " FOUND")}, nil
+	}
+	return ScanResult{}, errors.New("clamd: " + reply)
+}
@@ -0,0 +1,116 @@
+package tools
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const eicar = `X5O!P%@AP[4\PZX54(P^)7CC)7}$EICAR-STANDARD-ANTIVIRUS-TEST-FILE!$H+H*`
+
+// clamdStub 按clamd协议应答的测试服务, 内容包含EICAR时报告病毒, 超过maxSize时返回错误
+func clamdStub(t *testing.T, network string, address string, maxSize int) net.Listener {
+	ln, err := net.Listen(network, address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func(conn net.Conn) {
+				defer conn.Close()
+				r := bufio.NewReader(conn)
+				cmd, err := r.ReadString(0)
+				if err != nil {
+					return
+				}
+				switch cmd {
+				case "zPING\x00":
+					conn.Write([]byte("PONG\x00"))
+				case "zINSTREAM\x00":
+					var data bytes.Buffer
+					for {
+						var size uint32
+						if binary.Read(r, binary.BigEndian, &size) != nil {
+							return
+						}
+						if size == 0 {
+							break
+						}
+						if data.Len()+int(size) > maxSize {
+							conn.Write([]byte("INSTREAM size limit exceeded. ERROR\x00"))
+							return
+						}
+						if _, err := io.CopyN(&data, r, int64(size)); err != nil {
+							return
+						}
+					}
+					if strings.Contains(data.String(), "EICAR-STANDARD-ANTIVIRUS-TEST-FILE") {
+						conn.Write([]byte("stream: Eicar-Signature FOUND\x00"))
+					} else {
+						conn.Write([]byte("stream: OK\x00"))
+					}
+				default:
+					conn.Write([]byte("UNKNOWN COMMAND\x00"))
+				}
+			}(conn)
+		}
+	}()
+	return ln
+}
+func TestClamdScanner(t *testing.T) {
+	tcp := clamdStub(t, "tcp", "127.0.0.1:0", 1024*1024)
+	defer tcp.Close()
+	sock := filepath.Join(t.TempDir(), "clamd.sock")
+	unix := clamdStub(t, "unix", sock, 1024*1024)
+	defer unix.Close()
+
+	for _, addr := range []string{"tcp://" + tcp.Addr().String(), tcp.Addr().String(), "unix://" + sock} {
+		scanner, err := NewClamdScanner(addr, 5*time.Second)
+		if err != nil {
+			t.Fatal(err)
+		}
+		scanner.ChunkSize = 16
+		if err := scanner.Ping(); err != nil {
+			t.Errorf("%s Ping() == %v", addr, err)
+		}
+		res, err := scanner.Scan(strings.NewReader("hello world, this is a clean file"))
+		if err != nil || res.Infected {
+			t.Errorf("%s Scan(clean) == %v, %v", addr, res, err)
+		}
+		res, err = scanner.Scan(strings.NewReader(eicar))
+		if err != nil || !res.Infected || res.Signature != "Eicar-Signature" {
+			t.Errorf("%s Scan(eicar) == %v, %v", addr, res, err)
+		}
+	}
+}
+func TestClamdScannerErrors(t *testing.T) {
+	ln := clamdStub(t, "tcp", "127.0.0.1:0", 100)
+	scanner, _ := NewClamdScanner(ln.Addr().String(), 5*time.Second)
+	scanner.ChunkSize = 64
+	if _, err := scanner.Scan(bytes.NewReader(make([]byte, 1000))); err == nil || !strings.Contains(err.Error(), "size limit") {
+		t.Errorf("Scan(too large) == %v, want size limit error", err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+	if _, err := scanner.Scan(strings.NewReader("data")); err == nil {
+		t.Error("Scan() without clamd should fail")
+	}
+	for _, bad := range []string{"", "tcp://", "unix://", "127.0.0.1"} {
+		if _, err := NewClamdScanner(bad, 0); err == nil {
+			t.Errorf("NewClamdScanner(%q) should fail", bad)
+		}
+	}
+	if _, err := NewClamdScanner("tcp://"+addr, 0); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,94 @@
+package tools
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// SplitDomains 解析允许的域名列表, 支持逗号、空格、换行分隔
+func SplitDomains(value string) []string {
+	fields := strings.FieldsFunc(value, func(r rune) bool {
+		return r == ',' || r == ';' || r == ' ' || r == '\n' || r == '\r' || r == '\t'
+	})
+	domains := make([]string, 0, len(fields))
+	for _, f := range fields {
+		if d := strings.ToLower(strings.TrimSpace(f)); d != "" {
+			domains = append(domains, d)
+		}
+	}
+	return domains
+}
+
+// OriginHost 从Origin或Referer中取出不含端口的主机名
+func OriginHost(origin string) string {
+	u, err := url.Parse(strings.TrimSpace(origin))
+	if err != nil || u.Host == "" {
+		return ""
+	}
+	return strings.ToLower(u.Hostname())
+}
+
+// MatchDomain 判断主机名是否匹配, pattern 可以是 example.com、*.example.com 或完整地址
+// *.example.com 匹配子域名但不匹配 example.com 本身
+func MatchDomain(pattern string, host string) bool {
+	pattern = strings.ToLower(strings.TrimSpace(pattern))
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+	if pattern == "" || host == "" {
+		return false
+	}
+	if strings.Contains(pattern, "://") {
+		pattern = OriginHost(pattern)
+	} else if h, _, err := net.SplitHostPort(pattern); err == nil {
+		pattern = h
+	}
+	if pattern == "*" {
+		return true
+	}
+	if strings.HasPrefix(pattern, "*.") {
+		return strings.HasSuffix(host, pattern[1:])
+	}
+	return host == pattern
+}
+
+// MatchDomains 主机名是否匹配列表中的任一项
+func MatchDomains(patterns []string, host string) bool {
+	for _, p := range patterns {
+		if MatchDomain(p, host) {
+			return true
+		}
+	}
+	return false
+}
+
+// SameOrigin Origin与请求的Host是否为同一站点, 经过反向代理时也比较X-Forwarded-Host
+func SameOrigin(origin string, r *http.Request) bool {
+	originHost := OriginHost(origin)
+	if originHost == "" {
+		return false
+	}
+	for _, host := range []string{r.Host, r.Header.Get("X-Forwarded-Host")} {
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		if host != "" && originHost == strings.ToLower(host) {
+			return true
+		}
+	}
+	return false
+}
+
+type originAllowedKey struct{}
+
+// WithOriginAllowed 标记请求来源已通过域名校验, 供websocket的CheckOrigin使用
+func WithOriginAllowed(r *http.Request) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), originAllowedKey{}, true))
+}
+
+// OriginAllowed 请求来源是否已通过域名校验
+func OriginAllowed(r *http.Request) bool {
+	allowed, _ := r.Context().Value(originAllowedKey{}).(bool)
+	return allowed
+}
@@ -0,0 +1,75 @@
+package tools
+
+import (
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestMatchDomain(t *testing.T) {
+	cases := []struct {
+		pattern string
+		host    string
+		want    bool
+	}{
+		{"example.com", "example.com", true},
+		{"Example.COM", "example.com", true},
+		{"example.com", "www.example.com", false},
+		{"*.example.com", "www.example.com", true},
+		{"*.example.com", "a.b.example.com", true},
+		{"*.example.com", "example.com", false},
+		{"*.example.com", "badexample.com", false},
+		{"example.com", "example.com.evil.net", false},
+		{"https://app.example.com:8443", "app.example.com", true},
+		{"app.example.com:8443", "app.example.com", true},
+		{"*", "anything.net", true},
+		{"", "example.com", false},
+		{"example.com", "", false},
+	}
+	for _, c := range cases {
+		if got := MatchDomain(c.pattern, c.host); got != c.want {
+			t.Errorf("MatchDomain(%q, %q) == %v, want %v", c.pattern, c.host, got, c.want)
+		}
+	}
+}
+
+func TestOriginHost(t *testing.T) {
+	cases := map[string]string{
+		"https://www.example.com":           "www.example.com",
+		"http://Example.com:8080/page?a=1":  "example.com",
+		"null":                              "",
+		"":                                  "",
+		"www.example.com":                   "",
+		"https://user@example.com/path#top": "example.com",
+	}
+	for origin, want := range cases {
+		if got := OriginHost(origin); got != want {
+			t.Errorf("OriginHost(%q) == %q, want %q", origin, got, want)
+		}
+	}
+}
+
+func TestSplitDomains(t *testing.T) {
+	got := SplitDomains(" example.com,*.Example.org\nfoo.net ; ")
+	want := []string{"example.com", "*.example.org", "foo.net"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("SplitDomains == %v, want %v", got, want)
+	}
+}
+
+func TestSameOrigin(t *testing.T) {
+	r := httptest.NewRequest("GET", "http://chat.example.com:8081/ws_visitor", nil)
+	if !SameOrigin("https://chat.example.com", r) {
+		t.Error("same host rejected")
+	}
+	if SameOrigin("https://evil.net", r) {
+		t.Error("other host accepted")
+	}
+	r.Header.Set("X-Forwarded-Host", "support.example.com")
+	if !SameOrigin("https://support.example.com", r) {
+		t.Error("forwarded host rejected")
+	}
+	if OriginAllowed(r) || !OriginAllowed(WithOriginAllowed(r)) {
+		t.Error("origin allowed flag not carried by the request context")
+	}
+}
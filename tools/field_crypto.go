@@ -0,0 +1,209 @@
+package tools
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"sync"
+)
+
+// 加密字段前缀, 完整格式为 enc:v1:kid:包装后的数据密钥:密文
+const fieldCipherPrefix = "enc:v1:"
+
+// FieldKey 字段加密主密钥, Key 为base64编码的32字节密钥
+type FieldKey struct {
+	Kid string `json:"kid"`
+	Key string `json:"key"`
+}
+
+var fieldKeys = struct {
+	sync.RWMutex
+	keys    map[string][]byte
+	current string
+	index   []byte
+}{keys: make(map[string][]byte)}
+
+// SetFieldKeys 设置字段加密主密钥, current 用于加密新数据, 其余密钥只用于解密旧数据
+// indexKey 为盲索引密钥, 轮换主密钥时不能修改; keys 为空时关闭字段加密
+func SetFieldKeys(keys []FieldKey, current string, indexKey string) error {
+	m := make(map[string][]byte)
+	for _, k := range keys {
+		key, err := base64.StdEncoding.DecodeString(k.Key)
+		if k.Kid == "" || strings.Contains(k.Kid, ":") || err != nil || len(key) != 32 {
+			return errors.New("encryption key " + k.Kid + " must have a kid without ':' and a base64 encoded 32 byte key")
+		}
+		m[k.Kid] = key
+	}
+	if _, ok := m[current]; len(m) > 0 && !ok {
+		return errors.New("encryption current kid " + current + " not found")
+	}
+	var index []byte
+	if indexKey != "" {
+		var err error
+		index, err = base64.StdEncoding.DecodeString(indexKey)
+		if err != nil || len(index) < 16 {
+			return errors.New("blind index key must be base64 encoded and at least 16 bytes")
+		}
+	}
+	fieldKeys.Lock()
+	fieldKeys.keys = m
+	fieldKeys.current = current
+	fieldKeys.index = index
+	fieldKeys.Unlock()
+	return nil
+}
+
+// FieldEncryptionEnabled 是否配置了字段加密密钥
+func FieldEncryptionEnabled() bool {
+	fieldKeys.RLock()
+	defer fieldKeys.RUnlock()
+	return fieldKeys.current != ""
+}
+
+// BlindIndexEnabled 是否配置了盲索引密钥
+func BlindIndexEnabled() bool {
+	fieldKeys.RLock()
+	defer fieldKeys.RUnlock()
+	return fieldKeys.index != nil
+}
+
+// RandomFieldKey 生成base64编码的随机密钥, 用于配置主密钥和盲索引密钥
+func RandomFieldKey() string {
+	b := make([]byte, 32)
+	rand.Read(b)
+	return base64.StdEncoding.EncodeToString(b)
+}
+
+// IsEncryptedField 字段值是否为密文
+func IsEncryptedField(value string) bool {
+	return strings.HasPrefix(value, fieldCipherPrefix)
+}
+
+// EncryptField 信封加密: 每个值使用随机数据密钥AES-GCM加密, 数据密钥再由当前主密钥加密
+// 未配置密钥或值为空时原样返回
+func EncryptField(plain string) (string, error) {
+	fieldKeys.RLock()
+	kid := fieldKeys.current
+	master := fieldKeys.keys[kid]
+	fieldKeys.RUnlock()
+	if master == nil || plain == "" {
+		return plain, nil
+	}
+	dek := make([]byte, 32)
+	if _, err := rand.Read(dek); err != nil {
+		return "", err
+	}
+	wrapped, err := gcmSeal(master, dek)
+	if err != nil {
+		return "", err
+	}
+	data, err := gcmSeal(dek, []byte(plain))
+	if err != nil {
+		return "", err
+	}
+	return fieldCipherPrefix + kid + ":" + base64.RawStdEncoding.EncodeToString(wrapped) + ":" + base64.RawStdEncoding.EncodeToString(data), nil
+}
+
+// DecryptField 解密字段, 明文(加密前写入的旧数据)原样返回
+func DecryptField(value string) (string, error) {
+	if !IsEncryptedField(value) {
+		return value, nil
+	}
+	parts := strings.Split(strings.TrimPrefix(value, fieldCipherPrefix), ":")
+	if len(parts) != 3 {
+		return "", errors.New("encrypted field is malformed")
+	}
+	fieldKeys.RLock()
+	master := fieldKeys.keys[parts[0]]
+	fieldKeys.RUnlock()
+	if master == nil {
+		return "", errors.New("encryption key " + parts[0] + " not found")
+	}
+	wrapped, err := base64.RawStdEncoding.DecodeString(parts[1])
+	if err != nil {
+		return "", errors.New("encrypted field is malformed")
+	}
+	data, err := base64.RawStdEncoding.DecodeString(parts[2])
+	if err != nil {
+		return "", errors.New("encrypted field is malformed")
+	}
+	dek, err := gcmOpen(master, wrapped)
+	if err != nil {
+		return "", err
+	}
+	plain, err := gcmOpen(dek, data)
+	if err != nil {
+		return "", err
+	}
+	return string(plain), nil
+}
+
+// FieldNeedsRotation 字段是否需要重新加密: 开启加密时明文或旧密钥加密的值, 关闭加密时的密文
+func FieldNeedsRotation(value string) bool {
+	if value == "" {
+		return false
+	}
+	fieldKeys.RLock()
+	current := fieldKeys.current
+	fieldKeys.RUnlock()
+	if current == "" {
+		return IsEncryptedField(value)
+	}
+	return !strings.HasPrefix(value, fieldCipherPrefix+current+":")
+}
+
+// BlindIndex 计算字段的盲索引, 用于在密文上做等值查询, 忽略首尾空白和大小写
+// 未配置盲索引密钥或值为空时返回空字符串
+func BlindIndex(value string) string {
+	fieldKeys.RLock()
+	key := fieldKeys.index
+	fieldKeys.RUnlock()
+	value = strings.ToLower(strings.TrimSpace(value))
+	if key == nil || value == "" {
+		return ""
+	}
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(value))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// gcmSeal 返回 nonce+密文
+func gcmSeal(key []byte, plain []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize(), gcm.NonceSize()+len(plain)+gcm.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return gcm.Seal(nonce, nonce, plain, nil), nil
+}
+func gcmOpen(key []byte, data []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < gcm.NonceSize() {
+		return nil, errors.New("encrypted field is malformed")
+	}
+	plain, err := gcm.Open(nil, data[:gcm.NonceSize()], data[gcm.NonceSize():], nil)
+	if err != nil {
+		return nil, errors.New("encrypted field can not be decrypted")
+	}
+	return plain, nil
+}
@@ -0,0 +1,98 @@
+package tools
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestFieldEncryption(t *testing.T) {
+	defer SetFieldKeys(nil, "", "")
+	if out, _ := EncryptField("127.0.0.1"); out != "127.0.0.1" {
+		t.Fatalf("EncryptField without keys == %q", out)
+	}
+	k1 := FieldKey{Kid: "k1", Key: RandomFieldKey()}
+	k2 := FieldKey{Kid: "k2", Key: RandomFieldKey()}
+	if err := SetFieldKeys([]FieldKey{k1}, "k1", RandomFieldKey()); err != nil {
+		t.Fatal(err)
+	}
+	old, err := EncryptField("你好 hello")
+	if err != nil || !strings.HasPrefix(old, "enc:v1:k1:") {
+		t.Fatalf("EncryptField() == %q, %v", old, err)
+	}
+	if again, _ := EncryptField("你好 hello"); again == old {
+		t.Error("EncryptField is deterministic")
+	}
+	if plain, err := DecryptField(old); err != nil || plain != "你好 hello" {
+		t.Fatalf("DecryptField() == %q, %v", plain, err)
+	}
+	if plain, err := DecryptField("plain text"); err != nil || plain != "plain text" {
+		t.Errorf("DecryptField(plain) == %q, %v", plain, err)
+	}
+	if out, _ := EncryptField(""); out != "" {
+		t.Errorf("EncryptField(\"\") == %q", out)
+	}
+	tampered := old[:len(old)-2] + "AA"
+	if _, err := DecryptField(tampered); err == nil {
+		t.Error("DecryptField accepted a tampered value")
+	}
+
+	// 轮换: 新密钥加密, 旧密钥仍可解密
+	if err := SetFieldKeys([]FieldKey{k1, k2}, "k2", ""); err != nil {
+		t.Fatal(err)
+	}
+	if plain, err := DecryptField(old); err != nil || plain != "你好 hello" {
+		t.Errorf("DecryptField(old key) == %q, %v", plain, err)
+	}
+	current, _ := EncryptField("x")
+	for value, want := range map[string]bool{old: true, current: false, "plain": true, "": false} {
+		if got := FieldNeedsRotation(value); got != want {
+			t.Errorf("FieldNeedsRotation(%q) == %v, want %v", value, got, want)
+		}
+	}
+	if err := SetFieldKeys([]FieldKey{k2}, "k2", ""); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := DecryptField(old); err == nil {
+		t.Error("DecryptField succeeded without the key")
+	}
+	if err := SetFieldKeys(nil, "", ""); err != nil {
+		t.Fatal(err)
+	}
+	if !FieldNeedsRotation(current) || FieldNeedsRotation("plain") {
+		t.Error("FieldNeedsRotation with encryption disabled")
+	}
+}
+func TestSetFieldKeysInvalid(t *testing.T) {
+	defer SetFieldKeys(nil, "", "")
+	cases := []struct {
+		keys    []FieldKey
+		current string
+		index   string
+	}{
+		{[]FieldKey{{Kid: "k1", Key: "short"}}, "k1", ""},
+		{[]FieldKey{{Kid: "a:b", Key: RandomFieldKey()}}, "a:b", ""},
+		{[]FieldKey{{Kid: "k1", Key: RandomFieldKey()}}, "k2", ""},
+		{nil, "", "not base64!"},
+	}
+	for i, c := range cases {
+		if err := SetFieldKeys(c.keys, c.current, c.index); err == nil {
+			t.Errorf("case %d: SetFieldKeys() accepted invalid keys", i)
+		}
+	}
+}
+func TestBlindIndex(t *testing.T) {
+	defer SetFieldKeys(nil, "", "")
+	if BlindIndex("a@b.com") != "" {
+		t.Error("BlindIndex without key is not empty")
+	}
+	key := RandomFieldKey()
+	SetFieldKeys(nil, "", key)
+	a := BlindIndex("A@B.com ")
+	if len(a) != 64 || a != BlindIndex("a@b.com") || a == BlindIndex("a@b.cn") {
+		t.Errorf("BlindIndex() == %q", a)
+	}
+	SetFieldKeys(nil, "", RandomFieldKey())
+	if BlindIndex("a@b.com") == a {
+		t.Error("BlindIndex does not depend on the key")
+	}
+}
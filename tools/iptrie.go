@@ -0,0 +1,121 @@
+package tools
+
+import (
+	"errors"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// IpTrie 按二进制位展开的IP前缀树, IPv4和IPv6各一棵, 用于网段匹配
+type IpTrie struct {
+	v4  *ipTrieNode
+	v6  *ipTrieNode
+	len int
+}
+type ipTrieNode struct {
+	child  [2]*ipTrieNode
+	values []interface{}
+}
+
+func NewIpTrie() *IpTrie {
+	return &IpTrie{v4: &ipTrieNode{}, v6: &ipTrieNode{}}
+}
+
+// ParseIpPrefix 解析单个IP或CIDR网段, 单个IP视为/32或/128, IPv4映射的IPv6地址按IPv4处理
+func ParseIpPrefix(s string) (net.IP, int, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return nil, 0, errors.New("empty ip")
+	}
+	if !strings.Contains(s, "/") {
+		ip := normalizeIp(net.ParseIP(s))
+		if ip == nil {
+			return nil, 0, errors.New("invalid ip: " + s)
+		}
+		return ip, len(ip) * 8, nil
+	}
+	ip, ipnet, err := net.ParseCIDR(s)
+	if err != nil {
+		return nil, 0, errors.New("invalid cidr: " + s)
+	}
+	bits, _ := ipnet.Mask.Size()
+	if ip.To4() != nil && len(ipnet.IP) == net.IPv4len {
+		return ipnet.IP.To4(), bits, nil
+	}
+	return ipnet.IP.To16(), bits, nil
+}
+
+// NormalizeIpPrefix 规范化IP或网段的写法, 单个IP不带掩码, 网段只保留网络地址
+func NormalizeIpPrefix(s string) (string, error) {
+	ip, bits, err := ParseIpPrefix(s)
+	if err != nil {
+		return "", err
+	}
+	if bits == len(ip)*8 {
+		return ip.String(), nil
+	}
+	return ip.String() + "/" + strconv.Itoa(bits), nil
+}
+
+func normalizeIp(ip net.IP) net.IP {
+	if ip == nil {
+		return nil
+	}
+	if v4 := ip.To4(); v4 != nil {
+		return v4
+	}
+	return ip.To16()
+}
+
+// Insert 添加一个IP或网段及其对应的值, 同一网段可以对应多个值
+func (t *IpTrie) Insert(prefix string, value interface{}) error {
+	ip, bits, err := ParseIpPrefix(prefix)
+	if err != nil {
+		return err
+	}
+	node := t.root(ip)
+	for i := 0; i < bits; i++ {
+		b := ipBit(ip, i)
+		if node.child[b] == nil {
+			node.child[b] = &ipTrieNode{}
+		}
+		node = node.child[b]
+	}
+	node.values = append(node.values, value)
+	t.len++
+	return nil
+}
+
+// Lookup 返回包含该IP的所有网段对应的值, 按网段从大到小排列
+func (t *IpTrie) Lookup(s string) []interface{} {
+	ip := normalizeIp(net.ParseIP(strings.TrimSpace(s)))
+	if ip == nil {
+		return nil
+	}
+	var values []interface{}
+	node := t.root(ip)
+	for i := 0; node != nil; i++ {
+		values = append(values, node.values...)
+		if i == len(ip)*8 {
+			break
+		}
+		node = node.child[ipBit(ip, i)]
+	}
+	return values
+}
+
+// Len 已添加的网段数量
+func (t *IpTrie) Len() int {
+	return t.len
+}
+
+func (t *IpTrie) root(ip net.IP) *ipTrieNode {
+	if len(ip) == net.IPv4len {
+		return t.v4
+	}
+	return t.v6
+}
+func ipBit(ip net.IP, i int) int {
+	return int(ip[i/8]>>(7-uint(i%8))) & 1
+}
@@ -0,0 +1,66 @@
+package tools
+
+import "testing"
+
+func TestNormalizeIpPrefix(t *testing.T) {
+	tests := []struct {
+		Arg  string
+		Want string
+		Err  bool
+	}{
+		{"1.2.3.4", "1.2.3.4", false},
+		{" 10.1.2.3/8 ", "10.0.0.0/8", false},
+		{"::ffff:1.2.3.4", "1.2.3.4", false},
+		{"2001:db8::1/32", "2001:db8::/32", false},
+		{"1.2.3.4/32", "1.2.3.4", false},
+		{"1.2.3", "", true},
+		{"1.2.3.4/33", "", true},
+		{"", "", true},
+	}
+	for _, test := range tests {
+		res, err := NormalizeIpPrefix(test.Arg)
+		if res != test.Want || (err != nil) != test.Err {
+			t.Errorf("NormalizeIpPrefix(%q) == %q, %v, want %q", test.Arg, res, err, test.Want)
+		}
+	}
+}
+func TestIpTrieLookup(t *testing.T) {
+	trie := NewIpTrie()
+	for _, prefix := range []string{"10.0.0.0/8", "10.1.0.0/16", "192.168.1.10", "2001:db8::/32", "0.0.0.0/0"} {
+		if err := trie.Insert(prefix, prefix); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if trie.Insert("bad", "bad") == nil {
+		t.Error("Insert(bad) should fail")
+	}
+	tests := []struct {
+		Arg  string
+		Want []string
+	}{
+		{"10.1.2.3", []string{"0.0.0.0/0", "10.0.0.0/8", "10.1.0.0/16"}},
+		{"10.2.0.1", []string{"0.0.0.0/0", "10.0.0.0/8"}},
+		{"192.168.1.10", []string{"0.0.0.0/0", "192.168.1.10"}},
+		{"::ffff:192.168.1.10", []string{"0.0.0.0/0", "192.168.1.10"}},
+		{"192.168.1.11", []string{"0.0.0.0/0"}},
+		{"2001:db8:1::5", []string{"2001:db8::/32"}},
+		{"2001:db9::5", nil},
+		{"not-an-ip", nil},
+	}
+	for _, test := range tests {
+		res := trie.Lookup(test.Arg)
+		if len(res) != len(test.Want) {
+			t.Errorf("Lookup(%s) == %v, want %v", test.Arg, res, test.Want)
+			continue
+		}
+		for i := range res {
+			if res[i] != test.Want[i] {
+				t.Errorf("Lookup(%s) == %v, want %v", test.Arg, res, test.Want)
+				break
+			}
+		}
+	}
+	if trie.Len() != 5 {
+		t.Errorf("Len() == %d, want 5", trie.Len())
+	}
+}
@@ -1,23 +1,121 @@
 package tools
 
 import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
 	"github.com/golang-jwt/jwt"
+	"math"
+	"sync"
+	"time"
 )
 
-const SECRET = "golivechat"
+// 令牌类型
+const (
+	TokenAccess  = "access"
+	TokenRefresh = "refresh"
+	TokenMfa     = "mfa"
+	TokenInvite  = "invite"
+	TokenVerify  = "verify"
+	TokenVisitor = "visitor"
+)
+
+// 签名密钥, Kid 写入令牌头部用于轮换
+type JwtKey struct {
+	Kid    string `json:"kid"`
+	Secret string `json:"secret"`
+}
+
+var jwtKeys = struct {
+	sync.RWMutex
+	keys    map[string][]byte
+	current string
+}{keys: make(map[string][]byte)}
+
+// SetJwtKeys 设置签名密钥, current 为签发新令牌使用的kid, 其余密钥只用于校验旧令牌
+func SetJwtKeys(keys []JwtKey, current string) error {
+	m := make(map[string][]byte)
+	for _, k := range keys {
+		if k.Kid == "" || len(k.Secret) < 16 {
+			return errors.New("jwt key " + k.Kid + " must have a kid and a secret of at least 16 bytes")
+		}
+		m[k.Kid] = []byte(k.Secret)
+	}
+	if _, ok := m[current]; !ok {
+		return errors.New("jwt current kid " + current + " not found")
+	}
+	jwtKeys.Lock()
+	jwtKeys.keys = m
+	jwtKeys.current = current
+	jwtKeys.Unlock()
+	return nil
+}
+
+// RandomJwtKey 生成随机密钥,未配置密钥时使用,重启后已签发令牌全部失效
+func RandomJwtKey() JwtKey {
+	b := make([]byte, 32)
+	rand.Read(b)
+	return JwtKey{Kid: "random", Secret: hex.EncodeToString(b)}
+}
 
-func MakeToken(obj map[string]interface{}) (string, error) {
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims(obj))
-	tokenString, err := token.SignedString([]byte(SECRET))
-	return tokenString, err
+// NewTokenId 生成令牌唯一标识jti
+func NewTokenId() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
 }
-func ParseToken(tokenStr string) map[string]interface{} {
+
+// MakeToken 签发令牌,自动写入typ/jti/iat/exp
+func MakeToken(obj map[string]interface{}, typ string, ttl time.Duration) (string, error) {
+	jwtKeys.RLock()
+	kid := jwtKeys.current
+	secret := jwtKeys.keys[kid]
+	jwtKeys.RUnlock()
+	if secret == nil {
+		return "", errors.New("jwt key is not configured")
+	}
+	now := time.Now()
+	claims := jwt.MapClaims{}
+	for k, v := range obj {
+		claims[k] = v
+	}
+	claims["typ"] = typ
+	claims["jti"] = NewTokenId()
+	// iat 精确到毫秒, 同一秒内吊销全部令牌后重新登录签发的令牌不会被误判为已吊销
+	claims["iat"] = float64(now.UnixMilli()) / 1000
+	claims["exp"] = now.Add(ttl).Unix()
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	token.Header["kid"] = kid
+	return token.SignedString(secret)
+}
+
+// TokenIssuedAt 令牌的签发时间, 精确到毫秒
+func TokenIssuedAt(claims map[string]interface{}) time.Time {
+	iat, _ := claims["iat"].(float64)
+	return time.UnixMilli(int64(math.Round(iat * 1000)))
+}
+
+// ParseToken 校验签名和有效期,typ不一致或缺少exp的令牌视为无效
+func ParseToken(tokenStr string, typ string) map[string]interface{} {
 	token, err := jwt.Parse(tokenStr, func(token *jwt.Token) (i interface{}, e error) {
-		return []byte(SECRET), nil
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, errors.New("unexpected signing method")
+		}
+		kid, _ := token.Header["kid"].(string)
+		jwtKeys.RLock()
+		secret, ok := jwtKeys.keys[kid]
+		jwtKeys.RUnlock()
+		if !ok {
+			return nil, errors.New("unknown kid")
+		}
+		return secret, nil
 	})
-	if err != nil {
+	if err != nil || !token.Valid {
+		return nil
+	}
+	claims := token.Claims.(jwt.MapClaims)
+	if claims["typ"] != typ || !claims.VerifyExpiresAt(time.Now().Unix(), true) {
 		return nil
 	}
-	finToken := token.Claims.(jwt.MapClaims)
-	return finToken
+	return claims
 }
@@ -0,0 +1,80 @@
+package tools
+
+import (
+	"github.com/golang-jwt/jwt"
+	"testing"
+	"time"
+)
+
+func TestJwtKeyRotation(t *testing.T) {
+	oldKey := JwtKey{Kid: "k1", Secret: "0123456789abcdef-old"}
+	newKey := JwtKey{Kid: "k2", Secret: "0123456789abcdef-new"}
+	if err := SetJwtKeys([]JwtKey{oldKey}, "k1"); err != nil {
+		t.Fatal(err)
+	}
+	oldToken, err := MakeToken(map[string]interface{}{"kefu_name": "agent"}, TokenAccess, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := SetJwtKeys([]JwtKey{oldKey, newKey}, "k2"); err != nil {
+		t.Fatal(err)
+	}
+	newToken, _ := MakeToken(map[string]interface{}{"kefu_name": "agent"}, TokenAccess, time.Hour)
+	if claims := ParseToken(oldToken, TokenAccess); claims == nil || claims["kefu_name"] != "agent" {
+		t.Errorf("old token rejected while k1 is still in the keyring")
+	}
+	if ParseToken(newToken, TokenAccess) == nil {
+		t.Errorf("new token rejected")
+	}
+	if ParseToken(newToken, TokenRefresh) != nil {
+		t.Errorf("access token accepted as refresh token")
+	}
+	SetJwtKeys([]JwtKey{newKey}, "k2")
+	if ParseToken(oldToken, TokenAccess) != nil {
+		t.Errorf("old token accepted after k1 was removed")
+	}
+}
+
+func TestParseTokenRejects(t *testing.T) {
+	key := JwtKey{Kid: "k1", Secret: "0123456789abcdef"}
+	SetJwtKeys([]JwtKey{key}, "k1")
+	expired, _ := MakeToken(nil, TokenAccess, -time.Minute)
+	if ParseToken(expired, TokenAccess) != nil {
+		t.Error("expired token accepted")
+	}
+	noExp := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"typ": TokenAccess})
+	noExp.Header["kid"] = "k1"
+	s, _ := noExp.SignedString([]byte(key.Secret))
+	if ParseToken(s, TokenAccess) != nil {
+		t.Error("token without exp accepted")
+	}
+	noKid := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"typ": TokenAccess, "exp": time.Now().Add(time.Hour).Unix()})
+	s, _ = noKid.SignedString([]byte(key.Secret))
+	if ParseToken(s, TokenAccess) != nil {
+		t.Error("token without kid accepted")
+	}
+	none := jwt.NewWithClaims(jwt.SigningMethodNone, jwt.MapClaims{"typ": TokenAccess, "exp": time.Now().Add(time.Hour).Unix()})
+	none.Header["kid"] = "k1"
+	s, _ = none.SignedString(jwt.UnsafeAllowNoneSignatureType)
+	if ParseToken(s, TokenAccess) != nil {
+		t.Error("unsigned token accepted")
+	}
+	if err := SetJwtKeys([]JwtKey{{Kid: "short", Secret: "abc"}}, "short"); err == nil {
+		t.Error("short secret accepted")
+	}
+}
+
+// 签发时间精确到毫秒, 用于和吊销时间比较
+func TestTokenIssuedAt(t *testing.T) {
+	SetJwtKeys([]JwtKey{{Kid: "k1", Secret: "0123456789abcdef"}}, "k1")
+	before := time.Now().Truncate(time.Millisecond)
+	token, err := MakeToken(nil, TokenAccess, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	after := time.Now()
+	issuedAt := TokenIssuedAt(ParseToken(token, TokenAccess))
+	if issuedAt.Before(before) || issuedAt.After(after) || issuedAt.Nanosecond()%int(time.Millisecond) != 0 {
+		t.Errorf("TokenIssuedAt() == %v, want between %v and %v in milliseconds", issuedAt, before, after)
+	}
+}
@@ -0,0 +1,32 @@
+package tools
+
+import "time"
+
+// LoginBackoff 连续失败后下次允许尝试前需要等待的时间, 第2次失败起按2的幂递增, 最多max
+func LoginBackoff(failures int, max time.Duration) time.Duration {
+	if failures < 2 {
+		return 0
+	}
+	delay := time.Second
+	for i := 2; i < failures && delay < max; i++ {
+		delay *= 2
+	}
+	if delay > max {
+		delay = max
+	}
+	return delay
+}
+
+// LoginRetryAfter 根据失败次数和最后一次失败时间计算还需等待多久, 达到上限时锁定到窗口结束
+func LoginRetryAfter(failures int, maxFailures int, lastFailure time.Time, window time.Duration, now time.Time) time.Duration {
+	var wait time.Duration
+	if failures >= maxFailures {
+		wait = lastFailure.Add(window).Sub(now)
+	} else {
+		wait = lastFailure.Add(LoginBackoff(failures, time.Minute)).Sub(now)
+	}
+	if wait < 0 {
+		return 0
+	}
+	return wait
+}
@@ -0,0 +1,51 @@
+package tools
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLoginBackoff(t *testing.T) {
+	cases := []struct {
+		failures int
+		want     time.Duration
+	}{
+		{0, 0},
+		{1, 0},
+		{2, time.Second},
+		{3, 2 * time.Second},
+		{4, 4 * time.Second},
+		{7, 32 * time.Second},
+		{8, time.Minute},
+		{50, time.Minute},
+	}
+	for _, c := range cases {
+		got := LoginBackoff(c.failures, time.Minute)
+		if got != c.want {
+			t.Errorf("LoginBackoff(%d) == %v, want %v", c.failures, got, c.want)
+		}
+	}
+}
+
+func TestLoginRetryAfter(t *testing.T) {
+	now := time.Unix(1600000000, 0)
+	window := 15 * time.Minute
+	cases := []struct {
+		failures int
+		last     time.Time
+		want     time.Duration
+	}{
+		{0, time.Time{}, 0},
+		{1, now, 0},
+		{3, now.Add(-time.Second), time.Second},
+		{3, now.Add(-5 * time.Second), 0},
+		{5, now.Add(-time.Minute), 14 * time.Minute},
+		{6, now.Add(-16 * time.Minute), 0},
+	}
+	for _, c := range cases {
+		got := LoginRetryAfter(c.failures, 5, c.last, window, now)
+		if got != c.want {
+			t.Errorf("LoginRetryAfter(%d, %v) == %v, want %v", c.failures, c.last, got, c.want)
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package tools
+
+import (
+	"encoding/json"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+var (
+	messageImgReg        = regexp.MustCompile(`img\[([^\[\]]+)\]`)
+	messageAttachmentReg = regexp.MustCompile(`attachment\[(\{[^\[\]]*\})\]`)
+)
+
+// MessageFiles 消息内容中引用的图片和附件地址, 格式为 img[path]、img[path|thumb] 和 attachment[{"path":...}]
+func MessageFiles(content string) []string {
+	files := make([]string, 0)
+	for _, m := range messageImgReg.FindAllStringSubmatch(content, -1) {
+		for _, ref := range strings.Split(m[1], "|") {
+			if ref != "" {
+				files = append(files, ref)
+			}
+		}
+	}
+	for _, m := range messageAttachmentReg.FindAllStringSubmatch(content, -1) {
+		var attachment struct {
+			Path string `json:"path"`
+		}
+		if json.Unmarshal([]byte(m[1]), &attachment) == nil && attachment.Path != "" {
+			files = append(files, attachment.Path)
+		}
+	}
+	return files
+}
+
+// UploadFilePath 把消息中的文件地址转换为上传目录下的本地路径, 不在上传目录下的地址返回false
+func UploadFilePath(uploadDir string, ref string) (string, bool) {
+	key, ok := UploadFileKey(uploadDir, ref)
+	if !ok {
+		return "", false
+	}
+	return filepath.Join(filepath.Clean(uploadDir), filepath.FromSlash(key)), true
+}
+
+// UploadFileKey 消息中的文件地址在文件存储中的key, 即上传目录下的相对路径
+func UploadFileKey(uploadDir string, ref string) (string, bool) {
+	uploadDir = filepath.ToSlash(filepath.Clean(uploadDir))
+	if i := strings.Index(ref, "://"); i >= 0 {
+		ref = ref[i+3:]
+		if j := strings.Index(ref, "/"); j >= 0 {
+			ref = ref[j:]
+		}
+	}
+	if i := strings.IndexAny(ref, "?#"); i >= 0 {
+		ref = ref[:i]
+	}
+	// 地址可能带有路由前缀, 从上传目录开始截取
+	i := strings.Index(ref, uploadDir+"/")
+	if i < 0 {
+		return "", false
+	}
+	p := path.Clean(ref[i:])
+	if !strings.HasPrefix(p, uploadDir+"/") {
+		return "", false
+	}
+	return strings.TrimPrefix(p, uploadDir+"/"), true
+}
@@ -0,0 +1,42 @@
+package tools
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestMessageFiles(t *testing.T) {
+	content := `hello img[/static/upload/2024May/a.png] img[/static/upload/2024May/c.png|/static/upload/2024May/c_200.jpg] and attachment[{"name":"b.pdf","ext":".pdf","size":10,"path":"/static/upload/2024May/b.pdf"}] img[]`
+	want := []string{"/static/upload/2024May/a.png", "/static/upload/2024May/c.png", "/static/upload/2024May/c_200.jpg", "/static/upload/2024May/b.pdf"}
+	if res := MessageFiles(content); !reflect.DeepEqual(res, want) {
+		t.Errorf("MessageFiles() == %v, want %v", res, want)
+	}
+	if res := MessageFiles("plain text"); len(res) != 0 {
+		t.Errorf("MessageFiles(plain text) == %v, want empty", res)
+	}
+}
+func TestUploadFilePath(t *testing.T) {
+	tests := []struct {
+		Arg  string
+		Want string
+		Ok   bool
+	}{
+		{"/static/upload/2024May/a.png", "static/upload/2024May/a.png", true},
+		{"/chat/static/upload/2024May/a.png?t=1", "static/upload/2024May/a.png", true},
+		{"https://example.com/static/upload/2024May/a.png", "static/upload/2024May/a.png", true},
+		{"/static/upload/../../config/mysql.json", "", false},
+		{"/static/images/2.png", "", false},
+		{"/static/upload/", "", false},
+	}
+	for _, test := range tests {
+		res, ok := UploadFilePath("static/upload/", test.Arg)
+		if res != test.Want || ok != test.Ok {
+			t.Errorf("UploadFilePath(%q) == %q, %v, want %q, %v", test.Arg, res, ok, test.Want, test.Ok)
+		}
+		key, ok := UploadFileKey("static/upload/", test.Arg)
+		if key != strings.TrimPrefix(test.Want, "static/upload/") || ok != test.Ok {
+			t.Errorf("UploadFileKey(%q) == %q, %v", test.Arg, key, ok)
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package tools
+
+import (
+	"crypto/subtle"
+	"errors"
+	"golang.org/x/crypto/bcrypt"
+	"regexp"
+	"unicode"
+)
+
+// 密码哈希算法
+type PasswordHasher interface {
+	Hash(password string) (string, error)
+	Verify(hash, password string) bool
+	// NeedsRehash 判断哈希是否需要按当前参数重新生成
+	NeedsRehash(hash string) bool
+}
+
+type BcryptHasher struct {
+	Cost int
+}
+
+func (h BcryptHasher) Hash(password string) (string, error) {
+	b, err := bcrypt.GenerateFromPassword([]byte(password), h.Cost)
+	return string(b), err
+}
+func (h BcryptHasher) Verify(hash, password string) bool {
+	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil
+}
+func (h BcryptHasher) NeedsRehash(hash string) bool {
+	cost, err := bcrypt.Cost([]byte(hash))
+	return err != nil || cost != h.Cost
+}
+
+var Hasher PasswordHasher = BcryptHasher{Cost: bcrypt.DefaultCost}
+
+var legacyMd5Regexp = regexp.MustCompile(`^[0-9a-f]{32}$`)
+
+// HashPassword 使用当前算法生成密码哈希
+func HashPassword(password string) (string, error) {
+	return Hasher.Hash(password)
+}
+
+// VerifyPassword 校验密码,兼容旧版无盐md5, rehash为true时调用方应保存新哈希
+func VerifyPassword(hash, password string) (ok bool, rehash bool) {
+	if legacyMd5Regexp.MatchString(hash) {
+		ok = subtle.ConstantTimeCompare([]byte(hash), []byte(Md5(password))) == 1
+		return ok, ok
+	}
+	if !Hasher.Verify(hash, password) {
+		return false, false
+	}
+	return true, Hasher.NeedsRehash(hash)
+}
+
+// CheckPasswordPolicy 密码至少8位,同时包含字母和数字, bcrypt只使用前72字节
+func CheckPasswordPolicy(password string) error {
+	if len(password) < 8 {
+		return errors.New("password must be at least 8 characters")
+	}
+	if len(password) > 72 {
+		return errors.New("password must be at most 72 bytes")
+	}
+	var letter, digit bool
+	for _, r := range password {
+		switch {
+		case unicode.IsLetter(r):
+			letter = true
+		case unicode.IsDigit(r):
+			digit = true
+		}
+	}
+	if !letter || !digit {
+		return errors.New("password must contain both letters and digits")
+	}
+	return nil
+}
@@ -0,0 +1,53 @@
+package tools
+
+import (
+	"golang.org/x/crypto/bcrypt"
+	"testing"
+)
+
+func TestVerifyPassword(t *testing.T) {
+	hash, err := HashPassword("secret123")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ok, rehash := VerifyPassword(hash, "secret123"); !ok || rehash {
+		t.Errorf("VerifyPassword(bcrypt, right) == %v, %v, want true, false", ok, rehash)
+	}
+	if ok, _ := VerifyPassword(hash, "secret124"); ok {
+		t.Error("VerifyPassword(bcrypt, wrong) == true")
+	}
+	legacy := Md5("secret123")
+	if ok, rehash := VerifyPassword(legacy, "secret123"); !ok || !rehash {
+		t.Errorf("VerifyPassword(md5, right) == %v, %v, want true, true", ok, rehash)
+	}
+	if ok, rehash := VerifyPassword(legacy, "secret124"); ok || rehash {
+		t.Errorf("VerifyPassword(md5, wrong) == %v, %v, want false, false", ok, rehash)
+	}
+	weak, _ := BcryptHasher{Cost: bcrypt.MinCost}.Hash("secret123")
+	if ok, rehash := VerifyPassword(weak, "secret123"); !ok || !rehash {
+		t.Errorf("VerifyPassword(low cost) == %v, %v, want true, true", ok, rehash)
+	}
+	if ok, _ := VerifyPassword("", ""); ok {
+		t.Error("VerifyPassword(empty) == true")
+	}
+}
+
+func TestCheckPasswordPolicy(t *testing.T) {
+	cases := []struct {
+		in string
+		ok bool
+	}{
+		{"abc123", false},
+		{"abcdefgh", false},
+		{"12345678", false},
+		{"abcd1234", true},
+		{"密码密码1234", true},
+		{string(make([]byte, 73)), false},
+	}
+	for _, c := range cases {
+		err := CheckPasswordPolicy(c.in)
+		if (err == nil) != c.ok {
+			t.Errorf("CheckPasswordPolicy(%q) == %v, want ok=%v", c.in, err, c.ok)
+		}
+	}
+}
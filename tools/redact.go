@@ -0,0 +1,265 @@
+package tools
+
+import (
+	"errors"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// 敏感信息处理策略: mask打码 reject拒绝发送 encrypt原文加密存储, 其他地方打码
+const (
+	RedactMask    = "mask"
+	RedactReject  = "reject"
+	RedactEncrypt = "encrypt"
+)
+
+// 内置规则名称
+const (
+	RedactCard   = "card"
+	RedactIdCard = "id_card"
+	RedactPhone  = "phone"
+)
+
+// RedactRule 敏感信息规则, 内置规则只需要 Name 和 Policy, 自定义规则需要 Regex
+type RedactRule struct {
+	Name   string `json:"name"`
+	Label  string `json:"label"`
+	Regex  string `json:"regex"`
+	Policy string `json:"policy"`
+}
+
+// RedactResult 检测结果, Content 为打码后的内容, Store 为需要保存到数据库的内容
+// Rejected 不为空时为拒绝发送的规则
+type RedactResult struct {
+	Content  string
+	Store    string
+	Rejected *RedactRule
+	Matched  []string
+}
+
+type redactRule struct {
+	RedactRule
+	re    *regexp.Regexp
+	valid func(string) bool
+	mask  func(string) string
+}
+
+var (
+	cardRegexp   = regexp.MustCompile(`\b\d(?:[ -]?\d){12,18}\b`)
+	idCardRegexp = regexp.MustCompile(`\b\d{17}[\dXx]\b`)
+	mobileRegexp = regexp.MustCompile(`(?:\+86[ -]?|\b)1[3-9]\d(?:[ -]?\d{4}){2}\b`)
+)
+
+var redactRules = struct {
+	sync.RWMutex
+	rules []redactRule
+}{}
+
+// SetRedactRules 设置敏感信息规则, 规则按顺序匹配, 已被前面规则匹配的内容不再匹配
+func SetRedactRules(rules []RedactRule) error {
+	list := make([]redactRule, 0, len(rules))
+	for _, r := range rules {
+		if r.Policy != RedactMask && r.Policy != RedactReject && r.Policy != RedactEncrypt {
+			return errors.New("redact rule " + r.Name + " has an unknown policy " + r.Policy)
+		}
+		rule := redactRule{RedactRule: r}
+		switch {
+		case r.Regex != "":
+			re, err := regexp.Compile(r.Regex)
+			if err != nil {
+				return errors.New("redact rule " + r.Name + " has an invalid regex: " + err.Error())
+			}
+			rule.re = re
+			rule.mask = func(s string) string { return MaskString(s, 0, 4) }
+		case r.Name == RedactCard:
+			rule.re = cardRegexp
+			rule.valid = func(s string) bool {
+				digits := onlyDigits(s)
+				return len(digits) >= 13 && len(digits) <= 19 && LuhnValid(digits)
+			}
+			rule.mask = func(s string) string { return MaskString(s, 0, 4) }
+		case r.Name == RedactIdCard:
+			rule.re = idCardRegexp
+			rule.valid = IdCardValid
+			rule.mask = func(s string) string { return MaskString(s, 3, 4) }
+		case r.Name == RedactPhone:
+			rule.re = mobileRegexp
+			rule.mask = func(s string) string { return MaskString(s, len(onlyDigits(s))-8, 4) }
+		default:
+			return errors.New("redact rule " + r.Name + " needs a regex")
+		}
+		list = append(list, rule)
+	}
+	redactRules.Lock()
+	redactRules.rules = list
+	redactRules.Unlock()
+	return nil
+}
+
+// Redact 检测并打码内容中的敏感信息, 未设置规则时原样返回
+// encrypt 策略在开启字段加密时保存原文(由数据库层加密), 否则保存打码后的内容
+func Redact(content string) RedactResult {
+	result := RedactResult{Content: content, Store: content}
+	redactRules.RLock()
+	rules := redactRules.rules
+	redactRules.RUnlock()
+	if len(rules) == 0 || content == "" {
+		return result
+	}
+	type match struct {
+		start, end int
+		rule       *redactRule
+	}
+	matches := make([]match, 0)
+	overlaps := func(start, end int) bool {
+		for _, m := range matches {
+			if start < m.end && end > m.start {
+				return true
+			}
+		}
+		return false
+	}
+	// 带+86区号的手机号也能通过Luhn校验, 银行卡号规则跳过完整落在手机号中的内容
+	phones := mobileRegexp.FindAllStringIndex(content, -1)
+	inPhone := func(start, end int) bool {
+		for _, loc := range phones {
+			if loc[0] <= start && end <= loc[1] {
+				return true
+			}
+		}
+		return false
+	}
+	for i := range rules {
+		rule := &rules[i]
+		for _, loc := range rule.re.FindAllStringIndex(content, -1) {
+			value := content[loc[0]:loc[1]]
+			if overlaps(loc[0], loc[1]) || (rule.valid != nil && !rule.valid(value)) {
+				continue
+			}
+			if rule.Name == RedactCard && rule.Regex == "" && inPhone(loc[0], loc[1]) {
+				continue
+			}
+			matches = append(matches, match{loc[0], loc[1], rule})
+		}
+	}
+	if len(matches) == 0 {
+		return result
+	}
+	sort.Slice(matches, func(i, j int) bool { return matches[i].start < matches[j].start })
+	var b strings.Builder
+	last := 0
+	keepOriginal := true
+	seen := make(map[string]bool)
+	for _, m := range matches {
+		b.WriteString(content[last:m.start])
+		b.WriteString(m.rule.mask(content[m.start:m.end]))
+		last = m.end
+		if m.rule.Policy == RedactReject && result.Rejected == nil {
+			rule := m.rule.RedactRule
+			result.Rejected = &rule
+		}
+		if m.rule.Policy != RedactEncrypt {
+			keepOriginal = false
+		}
+		if !seen[m.rule.Name] {
+			seen[m.rule.Name] = true
+			result.Matched = append(result.Matched, m.rule.Name)
+		}
+	}
+	b.WriteString(content[last:])
+	result.Content = b.String()
+	// 同时命中打码规则时原文不能保存
+	if !keepOriginal || !FieldEncryptionEnabled() {
+		result.Store = result.Content
+	}
+	return result
+}
+
+// RedactText 只返回打码后的内容, 用于日志和通知
+func RedactText(content string) string {
+	return Redact(content).Content
+}
+
+// MaskString 保留前keepStart个和后keepEnd个字母数字, 中间的字母数字替换为*, 全部保留时整体打码, 分隔符保持不变
+func MaskString(s string, keepStart int, keepEnd int) string {
+	runes := []rune(s)
+	total := 0
+	for _, r := range runes {
+		if isAlnum(r) {
+			total++
+		}
+	}
+	if keepStart+keepEnd >= total {
+		keepStart, keepEnd = 0, 0
+	}
+	n := 0
+	for i, r := range runes {
+		if !isAlnum(r) {
+			continue
+		}
+		if n >= keepStart && n < total-keepEnd {
+			runes[i] = '*'
+		}
+		n++
+	}
+	return string(runes)
+}
+
+// LuhnValid 银行卡号Luhn校验
+func LuhnValid(digits string) bool {
+	if digits == "" {
+		return false
+	}
+	sum := 0
+	double := false
+	for i := len(digits) - 1; i >= 0; i-- {
+		d := int(digits[i] - '0')
+		if d < 0 || d > 9 {
+			return false
+		}
+		if double {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		double = !double
+	}
+	return sum%10 == 0
+}
+
+// IdCardValid 校验18位居民身份证号的出生月份和校验码
+func IdCardValid(id string) bool {
+	if len(id) != 18 {
+		return false
+	}
+	weights := []int{7, 9, 10, 5, 8, 4, 2, 1, 6, 3, 7, 9, 10, 5, 8, 4, 2}
+	sum := 0
+	for i, w := range weights {
+		if id[i] < '0' || id[i] > '9' {
+			return false
+		}
+		sum += int(id[i]-'0') * w
+	}
+	month := id[10:12]
+	if month < "01" || month > "12" {
+		return false
+	}
+	return strings.ToUpper(id[17:]) == string("10X98765432"[sum%11])
+}
+func onlyDigits(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		if r >= '0' && r <= '9' {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+func isAlnum(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
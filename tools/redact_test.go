@@ -0,0 +1,85 @@
+package tools
+
+import "testing"
+
+func TestLuhnAndIdCard(t *testing.T) {
+	for digits, want := range map[string]bool{"4111111111111111": true, "4111111111111112": false, "": false} {
+		if LuhnValid(digits) != want {
+			t.Errorf("LuhnValid(%q) != %v", digits, want)
+		}
+	}
+	for id, want := range map[string]bool{"11010519491231002X": true, "11010519491231002x": true, "110105194912310021": false, "110105194913310020": false} {
+		if IdCardValid(id) != want {
+			t.Errorf("IdCardValid(%q) != %v", id, want)
+		}
+	}
+}
+func TestRedact(t *testing.T) {
+	defer SetRedactRules(nil)
+	if err := SetRedactRules([]RedactRule{
+		{Name: RedactIdCard, Policy: RedactMask},
+		{Name: RedactCard, Policy: RedactMask},
+		{Name: RedactPhone, Policy: RedactMask},
+		{Name: "order", Regex: `SN-\d{6}`, Policy: RedactReject},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	cases := map[string]string{
+		"卡号4111 1111 1111 1111谢谢":          "卡号**** **** **** 1111谢谢",
+		"卡号 4111111111111112":              "卡号 4111111111111112",
+		"身份证11010519491231002X":            "身份证110***********002X",
+		"电话13812345678, +86 138-1234-5678": "电话138****5678, +86 138-****-5678",
+		"订单123456789":                      "订单123456789",
+	}
+	for in, want := range cases {
+		res := Redact(in)
+		if res.Content != want || res.Store != want || res.Rejected != nil {
+			t.Errorf("Redact(%q) == %+v, want %q", in, res, want)
+		}
+	}
+	res := Redact("my order SN-123456")
+	if res.Rejected == nil || res.Rejected.Name != "order" {
+		t.Errorf("Redact(order) == %+v, want rejected", res)
+	}
+}
+
+// TestRedactRejectCardPhone 带区号的手机号不能被当作银行卡号拒绝发送
+func TestRedactRejectCardPhone(t *testing.T) {
+	defer SetRedactRules(nil)
+	if err := SetRedactRules([]RedactRule{
+		{Name: RedactCard, Policy: RedactReject},
+		{Name: RedactPhone, Policy: RedactMask},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	res := Redact("请回电 +86 138-1234-5678")
+	if res.Rejected != nil || res.Content != "请回电 +86 138-****-5678" {
+		t.Errorf("Redact(phone) == %+v, want phone masked", res)
+	}
+	res = Redact("卡号4111111111111111 电话+8613812345678")
+	if res.Rejected == nil || res.Rejected.Name != RedactCard {
+		t.Errorf("Redact(card and phone) == %+v, want card rejected", res)
+	}
+}
+func TestRedactEncrypt(t *testing.T) {
+	defer SetRedactRules(nil)
+	defer SetFieldKeys(nil, "", "")
+	SetRedactRules([]RedactRule{{Name: RedactCard, Policy: RedactEncrypt}, {Name: RedactPhone, Policy: RedactMask}})
+	in := "4111111111111111"
+	if res := Redact(in); res.Store != "************1111" {
+		t.Errorf("Redact() without encryption stores %q", res.Store)
+	}
+	SetFieldKeys([]FieldKey{{Kid: "k1", Key: RandomFieldKey()}}, "k1", "")
+	if res := Redact(in); res.Store != in || res.Content != "************1111" {
+		t.Errorf("Redact() == %+v, want original stored", res)
+	}
+	if res := Redact(in + " 13812345678"); res.Store != res.Content {
+		t.Errorf("Redact() stored original with a mask match: %+v", res)
+	}
+	if err := SetRedactRules([]RedactRule{{Name: "x", Regex: "(", Policy: RedactMask}}); err == nil {
+		t.Error("SetRedactRules accepted an invalid regex")
+	}
+	if err := SetRedactRules([]RedactRule{{Name: RedactCard, Policy: "drop"}}); err == nil {
+		t.Error("SetRedactRules accepted an unknown policy")
+	}
+}
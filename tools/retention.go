@@ -0,0 +1,89 @@
+package tools
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// PurgeResult 清理文件的统计
+type PurgeResult struct {
+	Files int64 `json:"files"`
+	Bytes int64 `json:"bytes"`
+}
+
+// PurgeOldFiles 删除目录下修改时间早于before的文件, match为nil时匹配全部文件
+// dryRun 只统计不删除, 删除后留下的空子目录一并删除
+func PurgeOldFiles(dir string, before time.Time, match func(path string) bool, dryRun bool) (PurgeResult, error) {
+	var result PurgeResult
+	dirs := make([]string, 0)
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if info.IsDir() {
+			if path != dir {
+				dirs = append(dirs, path)
+			}
+			return nil
+		}
+		if !info.Mode().IsRegular() || !info.ModTime().Before(before) || (match != nil && !match(path)) {
+			return nil
+		}
+		if !dryRun {
+			if err := os.Remove(path); err != nil {
+				return err
+			}
+		}
+		result.Files++
+		result.Bytes += info.Size()
+		return nil
+	})
+	if err != nil || dryRun {
+		return result, err
+	}
+	// 从最深的目录开始删除, 非空目录删除失败直接忽略
+	sort.Sort(sort.Reverse(sort.StringSlice(dirs)))
+	for _, d := range dirs {
+		os.Remove(d)
+	}
+	return result, nil
+}
+
+// JsonlArchive 以gzip压缩的json lines格式归档数据, 每行一条记录
+type JsonlArchive struct {
+	file *os.File
+	gz   *gzip.Writer
+	enc  *json.Encoder
+	Path string
+}
+
+// NewJsonlArchive 在dir下创建 name-时间.jsonl.gz 归档文件
+func NewJsonlArchive(dir string, name string) (*JsonlArchive, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	path := filepath.Join(dir, name+"-"+time.Now().Format("20060102150405")+".jsonl.gz")
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, err
+	}
+	gz := gzip.NewWriter(f)
+	return &JsonlArchive{file: f, gz: gz, enc: json.NewEncoder(gz), Path: path}, nil
+}
+func (a *JsonlArchive) Write(v interface{}) error {
+	return a.enc.Encode(v)
+}
+func (a *JsonlArchive) Close() error {
+	if err := a.gz.Close(); err != nil {
+		a.file.Close()
+		return err
+	}
+	return a.file.Close()
+}
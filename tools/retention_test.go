@@ -0,0 +1,76 @@
+package tools
+
+import (
+	"bufio"
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPurgeOldFiles(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Now()
+	files := map[string]time.Time{
+		"2024May/old.png":  now.AddDate(0, 0, -40),
+		"2024May/old.log":  now.AddDate(0, 0, -40),
+		"2024Jun/new.png":  now,
+		"2024Apr/old2.png": now.AddDate(0, 0, -60),
+	}
+	for name, mtime := range files {
+		path := filepath.Join(dir, name)
+		os.MkdirAll(filepath.Dir(path), 0700)
+		os.WriteFile(path, []byte("12345"), 0600)
+		os.Chtimes(path, mtime, mtime)
+	}
+	pngOnly := func(path string) bool {
+		return strings.HasSuffix(path, ".png")
+	}
+	res, err := PurgeOldFiles(dir, now.AddDate(0, 0, -30), pngOnly, true)
+	if err != nil || res.Files != 2 || res.Bytes != 10 {
+		t.Fatalf("PurgeOldFiles(dryRun) == %+v, %v, want 2 files", res, err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "2024May/old.png")); err != nil {
+		t.Fatal("dry run removed a file")
+	}
+	res, err = PurgeOldFiles(dir, now.AddDate(0, 0, -30), pngOnly, false)
+	if err != nil || res.Files != 2 {
+		t.Fatalf("PurgeOldFiles() == %+v, %v, want 2 files", res, err)
+	}
+	for name, want := range map[string]bool{"2024May/old.png": false, "2024May/old.log": true, "2024Jun/new.png": true, "2024Apr": false} {
+		_, err := os.Stat(filepath.Join(dir, name))
+		if (err == nil) != want {
+			t.Errorf("%s exists == %v, want %v", name, err == nil, want)
+		}
+	}
+	if res, err := PurgeOldFiles(filepath.Join(dir, "missing"), now, nil, false); err != nil || res.Files != 0 {
+		t.Errorf("PurgeOldFiles(missing) == %+v, %v", res, err)
+	}
+}
+func TestJsonlArchive(t *testing.T) {
+	a, err := NewJsonlArchive(t.TempDir(), "message")
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.Write(map[string]int{"id": 1})
+	a.Write(map[string]int{"id": 2})
+	if err := a.Close(); err != nil {
+		t.Fatal(err)
+	}
+	f, _ := os.Open(a.Path)
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var lines []string
+	scanner := bufio.NewScanner(gz)
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+	if strings.Join(lines, ",") != `{"id":1},{"id":2}` {
+		t.Errorf("archive lines == %v", lines)
+	}
+}
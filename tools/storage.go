@@ -0,0 +1,101 @@
+package tools
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+var ErrStorageNotFound = errors.New("file not found")
+
+// Storage 上传文件存储, key 为上传目录下的相对路径, 如 2024May/xxx.png
+type Storage interface {
+	Put(key string, r io.Reader, size int64, meta StorageMeta) error
+	Get(key string) (io.ReadCloser, error)
+	Delete(key string) error
+	// SignedURL disposition 不为空时替换下载响应的Content-Disposition
+	SignedURL(key string, expire time.Duration, disposition string) (string, error)
+}
+
+// StorageMeta 文件的响应头, 对象存储直接返回给浏览器
+type StorageMeta struct {
+	ContentType        string
+	ContentDisposition string
+}
+
+// CleanStorageKey 校验并规范化key, 不允许绝对路径和..
+func CleanStorageKey(key string) (string, error) {
+	key = path.Clean("/" + strings.ReplaceAll(key, "\\", "/"))[1:]
+	if key == "" || key == "." {
+		return "", errors.New("storage key is empty")
+	}
+	return key, nil
+}
+
+// LocalStorage 本地磁盘存储, 文件由程序的上传文件接口输出, 地址不会过期
+type LocalStorage struct {
+	Dir     string
+	BaseURL string
+}
+
+func (l *LocalStorage) filePath(key string) (string, error) {
+	key, err := CleanStorageKey(key)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(l.Dir, filepath.FromSlash(key)), nil
+}
+
+func (l *LocalStorage) Put(key string, r io.Reader, size int64, meta StorageMeta) error {
+	p, err := l.filePath(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(p, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(f, r)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(p)
+	}
+	return err
+}
+func (l *LocalStorage) Get(key string) (io.ReadCloser, error) {
+	p, err := l.filePath(key)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(p)
+	if os.IsNotExist(err) {
+		return nil, ErrStorageNotFound
+	}
+	return f, err
+}
+func (l *LocalStorage) Delete(key string) error {
+	p, err := l.filePath(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(p); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+func (l *LocalStorage) SignedURL(key string, expire time.Duration, disposition string) (string, error) {
+	key, err := CleanStorageKey(key)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(l.BaseURL, "/") + "/" + key, nil
+}
@@ -0,0 +1,271 @@
+package tools
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	s3Algorithm      = "AWS4-HMAC-SHA256"
+	s3UnsignedBody   = "UNSIGNED-PAYLOAD"
+	s3MaxPresignTime = 7 * 24 * time.Hour
+)
+
+// S3Storage 兼容S3的对象存储, 使用AWS Signature V4签名, MinIO 需要开启 PathStyle
+type S3Storage struct {
+	Endpoint  string
+	Region    string
+	Bucket    string
+	AccessKey string
+	SecretKey string
+	PathStyle bool
+	Prefix    string
+	Client    *http.Client
+	now       func() time.Time
+}
+
+// NewS3Storage 校验配置并创建对象存储, endpoint 为 https://s3.amazonaws.com 或 http://127.0.0.1:9000
+func NewS3Storage(endpoint, region, bucket, accessKey, secretKey string, pathStyle bool, prefix string) (*S3Storage, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, errors.New("s3 endpoint must be an http or https url")
+	}
+	if bucket == "" || accessKey == "" || secretKey == "" {
+		return nil, errors.New("s3 bucket, access key and secret key are required")
+	}
+	if region == "" {
+		region = "us-east-1"
+	}
+	return &S3Storage{
+		Endpoint:  strings.TrimSuffix(endpoint, "/"),
+		Region:    region,
+		Bucket:    bucket,
+		AccessKey: accessKey,
+		SecretKey: secretKey,
+		PathStyle: pathStyle,
+		Prefix:    strings.Trim(prefix, "/"),
+		Client:    &http.Client{Timeout: 5 * time.Minute},
+	}, nil
+}
+
+func (s *S3Storage) Put(key string, r io.Reader, size int64, meta StorageMeta) error {
+	req, err := s.newRequest("PUT", key, r)
+	if err != nil {
+		return err
+	}
+	req.ContentLength = size
+	if meta.ContentType != "" {
+		req.Header.Set("Content-Type", meta.ContentType)
+	}
+	if meta.ContentDisposition != "" {
+		req.Header.Set("Content-Disposition", meta.ContentDisposition)
+	}
+	resp, err := s.do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+func (s *S3Storage) Get(key string) (io.ReadCloser, error) {
+	req, err := s.newRequest("GET", key, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := s.do(req)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+func (s *S3Storage) Delete(key string) error {
+	req, err := s.newRequest("DELETE", key, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := s.do(req)
+	if err == ErrStorageNotFound {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// SignedURL 预签名的下载地址, 有效期最长7天
+// 相同内容的文件共用一个对象, 下载文件名通过 response-content-disposition 参数按请求指定
+func (s *S3Storage) SignedURL(key string, expire time.Duration, disposition string) (string, error) {
+	if expire <= 0 || expire > s3MaxPresignTime {
+		expire = s3MaxPresignTime
+	}
+	u, err := s.objectURL(key)
+	if err != nil {
+		return "", err
+	}
+	now := s.currentTime()
+	amzDate := now.Format("20060102T150405Z")
+	query := url.Values{}
+	query.Set("X-Amz-Algorithm", s3Algorithm)
+	query.Set("X-Amz-Credential", s.AccessKey+"/"+s.scope(amzDate))
+	query.Set("X-Amz-Date", amzDate)
+	query.Set("X-Amz-Expires", strconv.Itoa(int(expire/time.Second)))
+	query.Set("X-Amz-SignedHeaders", "host")
+	if disposition != "" {
+		query.Set("response-content-disposition", disposition)
+	}
+	canonical := strings.Join([]string{
+		"GET",
+		u.EscapedPath(),
+		s3CanonicalQuery(query),
+		"host:" + u.Host + "\n",
+		"host",
+		s3UnsignedBody,
+	}, "\n")
+	u.RawQuery = s3CanonicalQuery(query) + "&X-Amz-Signature=" + s.signature(amzDate, canonical)
+	return u.String(), nil
+}
+
+func (s *S3Storage) currentTime() time.Time {
+	if s.now != nil {
+		return s.now().UTC()
+	}
+	return time.Now().UTC()
+}
+
+// objectURL 对象地址, 路径按S3规则逐段编码
+func (s *S3Storage) objectURL(key string) (*url.URL, error) {
+	key, err := CleanStorageKey(key)
+	if err != nil {
+		return nil, err
+	}
+	if s.Prefix != "" {
+		key = s.Prefix + "/" + key
+	}
+	u, err := url.Parse(s.Endpoint)
+	if err != nil {
+		return nil, err
+	}
+	objectPath := "/" + key
+	if s.PathStyle {
+		objectPath = "/" + s.Bucket + objectPath
+	} else {
+		u.Host = s.Bucket + "." + u.Host
+	}
+	u.Path = objectPath
+	u.RawPath = s3EscapePath(objectPath)
+	return u, nil
+}
+func (s *S3Storage) newRequest(method string, key string, body io.Reader) (*http.Request, error) {
+	u, err := s.objectURL(key)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest(method, u.String(), body)
+	if err != nil {
+		return nil, err
+	}
+	return req, nil
+}
+
+// do 签名后发送请求, 404返回 ErrStorageNotFound
+func (s *S3Storage) do(req *http.Request) (*http.Response, error) {
+	s.signRequest(req)
+	resp, err := s.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		resp.Body.Close()
+		return nil, ErrStorageNotFound
+	}
+	if resp.StatusCode/100 != 2 {
+		msg, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+		resp.Body.Close()
+		return nil, fmt.Errorf("s3 %s %s: %s %s", req.Method, req.URL.Path, resp.Status, msg)
+	}
+	return resp, nil
+}
+
+// signRequest 请求头签名, 请求体不参与签名
+func (s *S3Storage) signRequest(req *http.Request) {
+	amzDate := s.currentTime().Format("20060102T150405Z")
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", s3UnsignedBody)
+	signedHeaders := "host;x-amz-content-sha256;x-amz-date"
+	canonical := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		s3CanonicalQuery(req.URL.Query()),
+		"host:" + req.URL.Host + "\nx-amz-content-sha256:" + s3UnsignedBody + "\nx-amz-date:" + amzDate + "\n",
+		signedHeaders,
+		s3UnsignedBody,
+	}, "\n")
+	req.Header.Set("Authorization", s3Algorithm+" Credential="+s.AccessKey+"/"+s.scope(amzDate)+
+		", SignedHeaders="+signedHeaders+", Signature="+s.signature(amzDate, canonical))
+}
+func (s *S3Storage) scope(amzDate string) string {
+	return amzDate[:8] + "/" + s.Region + "/s3/aws4_request"
+}
+func (s *S3Storage) signature(amzDate string, canonicalRequest string) string {
+	hash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := s3Algorithm + "\n" + amzDate + "\n" + s.scope(amzDate) + "\n" + hex.EncodeToString(hash[:])
+	key := s3Hmac([]byte("AWS4"+s.SecretKey), amzDate[:8])
+	key = s3Hmac(key, s.Region)
+	key = s3Hmac(key, "s3")
+	key = s3Hmac(key, "aws4_request")
+	return hex.EncodeToString(s3Hmac(key, stringToSign))
+}
+func s3Hmac(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// s3CanonicalQuery 按key排序并按RFC3986编码的查询参数
+func s3CanonicalQuery(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for k := range query {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	parts := make([]string, 0, len(keys))
+	for _, k := range keys {
+		values := append([]string{}, query[k]...)
+		sort.Strings(values)
+		for _, v := range values {
+			parts = append(parts, s3Escape(k, true)+"="+s3Escape(v, true))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+func s3EscapePath(p string) string {
+	return s3Escape(p, false)
+}
+
+// s3Escape 除字母数字和 -_.~ 外全部编码, encodeSlash 为false时保留 /
+func s3Escape(s string, encodeSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if (c >= 'A' && c <= 'Z') || (c >= 'a' && c <= 'z') || (c >= '0' && c <= '9') ||
+			c == '-' || c == '_' || c == '.' || c == '~' || (c == '/' && !encodeSlash) {
+			b.WriteByte(c)
+			continue
+		}
+		fmt.Fprintf(&b, "%%%02X", c)
+	}
+	return b.String()
+}
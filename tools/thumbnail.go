@@ -0,0 +1,153 @@
+package tools
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+	_ "image/gif"
+	"image/jpeg"
+	"image/png"
+	"path"
+	"sort"
+	"strings"
+)
+
+// DefaultThumbnailSizes 默认缩略图尺寸, 为长边的最大像素
+var DefaultThumbnailSizes = []int{200, 800}
+
+// 解码前按图片头部的宽高限制像素数, 避免超大图片占满内存
+// 解码后的图片和RGBA副本每像素约占7字节, 20M像素约140M内存
+const maxThumbnailPixels = 20 * 1000 * 1000
+
+// 同时生成缩略图的数量, 多个大图同时上传时排队解码
+var thumbnailSlots = make(chan struct{}, 2)
+
+// 可以生成缩略图的图片类型
+var thumbnailTypes = map[string]bool{"image/png": true, "image/jpeg": true, "image/gif": true}
+
+// CanThumbnail 是否支持为该类型的图片生成缩略图
+func CanThumbnail(ctype string) bool {
+	return thumbnailTypes[ctype]
+}
+
+// Thumbnail 缩略图, 不透明的图片保存为jpeg, 否则为png
+type Thumbnail struct {
+	Size   int
+	Width  int
+	Height int
+	Data   []byte
+	Mime   string
+	Ext    string
+}
+
+// MakeThumbnails 按长边生成多个尺寸的缩略图, 支持png jpeg和gif的第一帧
+// 图片不大于该尺寸时不生成, 返回的缩略图按尺寸从小到大排列
+func MakeThumbnails(data []byte, sizes []int) ([]Thumbnail, error) {
+	conf, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	if conf.Width <= 0 || conf.Height <= 0 || conf.Width*conf.Height > maxThumbnailPixels {
+		return nil, errors.New("image is too large to make thumbnails")
+	}
+	list := make([]int, 0, len(sizes))
+	for _, size := range sizes {
+		if size > 0 && (size < conf.Width || size < conf.Height) {
+			list = append(list, size)
+		}
+	}
+	if len(list) == 0 {
+		return nil, nil
+	}
+	thumbnailSlots <- struct{}{}
+	defer func() { <-thumbnailSlots }()
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	src := image.NewRGBA(image.Rect(0, 0, img.Bounds().Dx(), img.Bounds().Dy()))
+	draw.Draw(src, src.Bounds(), img, img.Bounds().Min, draw.Src)
+	opaque := src.Opaque()
+	// 从大到小生成, 小尺寸由上一个缩略图缩小, 减少计算量
+	sort.Sort(sort.Reverse(sort.IntSlice(list)))
+	thumbs := make([]Thumbnail, 0, len(list))
+	for _, size := range list {
+		w, h := thumbnailBounds(src.Bounds().Dx(), src.Bounds().Dy(), size)
+		src = resizeImage(src, w, h)
+		thumb := Thumbnail{Size: size, Width: w, Height: h}
+		var buf bytes.Buffer
+		if opaque {
+			err = jpeg.Encode(&buf, src, &jpeg.Options{Quality: 85})
+			thumb.Mime, thumb.Ext = "image/jpeg", ".jpg"
+		} else {
+			err = png.Encode(&buf, src)
+			thumb.Mime, thumb.Ext = "image/png", ".png"
+		}
+		if err != nil {
+			return nil, err
+		}
+		thumb.Data = buf.Bytes()
+		thumbs = append([]Thumbnail{thumb}, thumbs...)
+	}
+	return thumbs, nil
+}
+
+// ThumbnailKey 缩略图与原图保存在同一目录, 如 2024May/abc.png => 2024May/abc_200.jpg
+func ThumbnailKey(key string, size int, ext string) string {
+	return strings.TrimSuffix(key, path.Ext(key)) + fmt.Sprintf("_%d", size) + ext
+}
+
+// thumbnailBounds 等比缩放后的宽高, 长边为size
+func thumbnailBounds(width int, height int, size int) (int, int) {
+	if width >= height {
+		h := height * size / width
+		if h < 1 {
+			h = 1
+		}
+		return size, h
+	}
+	w := width * size / height
+	if w < 1 {
+		w = 1
+	}
+	return w, size
+}
+
+// resizeImage 按区域平均缩小图片, 颜色为预乘alpha, 透明边缘不会变黑
+func resizeImage(src *image.RGBA, width int, height int) *image.RGBA {
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	sw, sh := src.Bounds().Dx(), src.Bounds().Dy()
+	for y := 0; y < height; y++ {
+		y0 := y * sh / height
+		y1 := (y + 1) * sh / height
+		if y1 <= y0 {
+			y1 = y0 + 1
+		}
+		for x := 0; x < width; x++ {
+			x0 := x * sw / width
+			x1 := (x + 1) * sw / width
+			if x1 <= x0 {
+				x1 = x0 + 1
+			}
+			var r, g, b, a, n uint64
+			for sy := y0; sy < y1; sy++ {
+				row := src.Pix[sy*src.Stride+x0*4 : sy*src.Stride+x1*4]
+				for i := 0; i < len(row); i += 4 {
+					r += uint64(row[i])
+					g += uint64(row[i+1])
+					b += uint64(row[i+2])
+					a += uint64(row[i+3])
+					n++
+				}
+			}
+			i := dst.PixOffset(x, y)
+			dst.Pix[i] = uint8(r / n)
+			dst.Pix[i+1] = uint8(g / n)
+			dst.Pix[i+2] = uint8(b / n)
+			dst.Pix[i+3] = uint8(a / n)
+		}
+	}
+	return dst
+}
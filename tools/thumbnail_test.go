@@ -0,0 +1,111 @@
+package tools
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"testing"
+)
+
+func testImage(width int, height int, alpha uint8) *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.SetNRGBA(x, y, color.NRGBA{R: uint8(x), G: uint8(y), B: 200, A: alpha})
+		}
+	}
+	return img
+}
+func TestMakeThumbnails(t *testing.T) {
+	var buf bytes.Buffer
+	png.Encode(&buf, testImage(1000, 500, 255))
+	thumbs, err := MakeThumbnails(buf.Bytes(), []int{800, 200, 2000})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(thumbs) != 2 {
+		t.Fatalf("MakeThumbnails() returned %d thumbnails, want 2", len(thumbs))
+	}
+	want := [][2]int{{200, 100}, {800, 400}}
+	for i, thumb := range thumbs {
+		if thumb.Mime != "image/jpeg" || thumb.Ext != ".jpg" {
+			t.Errorf("thumbnail %d type == %s %s, want image/jpeg .jpg", i, thumb.Mime, thumb.Ext)
+		}
+		img, err := jpeg.Decode(bytes.NewReader(thumb.Data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if b := img.Bounds(); b.Dx() != want[i][0] || b.Dy() != want[i][1] || thumb.Width != want[i][0] || thumb.Height != want[i][1] {
+			t.Errorf("thumbnail %d bounds == %v, want %v", i, b, want[i])
+		}
+	}
+
+	// 透明图片保存为png
+	buf.Reset()
+	png.Encode(&buf, testImage(300, 600, 128))
+	thumbs, err = MakeThumbnails(buf.Bytes(), []int{200})
+	if err != nil || len(thumbs) != 1 || thumbs[0].Ext != ".png" {
+		t.Fatalf("MakeThumbnails(transparent) == %v, %v", thumbs, err)
+	}
+	img, err := png.Decode(bytes.NewReader(thumbs[0].Data))
+	if err != nil || img.Bounds().Dx() != 100 || img.Bounds().Dy() != 200 {
+		t.Errorf("transparent thumbnail bounds == %v, %v", img, err)
+	}
+
+	// gif使用第一帧
+	buf.Reset()
+	palette := color.Palette{color.Black, color.White}
+	anim := &gif.GIF{}
+	for i := 0; i < 2; i++ {
+		frame := image.NewPaletted(image.Rect(0, 0, 400, 400), palette)
+		anim.Image = append(anim.Image, frame)
+		anim.Delay = append(anim.Delay, 10)
+	}
+	gif.EncodeAll(&buf, anim)
+	thumbs, err = MakeThumbnails(buf.Bytes(), []int{200})
+	if err != nil || len(thumbs) != 1 || thumbs[0].Width != 200 {
+		t.Errorf("MakeThumbnails(gif) == %v, %v", thumbs, err)
+	}
+
+	// 小图片不生成
+	buf.Reset()
+	png.Encode(&buf, testImage(100, 100, 255))
+	if thumbs, err = MakeThumbnails(buf.Bytes(), []int{200}); err != nil || len(thumbs) != 0 {
+		t.Errorf("MakeThumbnails(small) == %v, %v", thumbs, err)
+	}
+	if _, err = MakeThumbnails([]byte("not an image"), []int{200}); err == nil {
+		t.Error("MakeThumbnails(text) should fail")
+	}
+}
+
+// TestMakeThumbnailsTooLarge 按头部的宽高拒绝超大图片, 不解码像素, 生成后释放并发名额
+func TestMakeThumbnailsTooLarge(t *testing.T) {
+	var buf bytes.Buffer
+	png.Encode(&buf, testImage(10, 10, 255))
+	data := buf.Bytes()
+	// 把IHDR中的宽高改为5000x5000并重新计算CRC
+	binary.BigEndian.PutUint32(data[16:], 5000)
+	binary.BigEndian.PutUint32(data[20:], 5000)
+	binary.BigEndian.PutUint32(data[29:], crc32.ChecksumIEEE(data[12:29]))
+	if _, err := MakeThumbnails(data, []int{200}); err == nil {
+		t.Error("MakeThumbnails(25M pixels) should fail")
+	}
+	buf.Reset()
+	png.Encode(&buf, testImage(300, 300, 255))
+	if thumbs, err := MakeThumbnails(buf.Bytes(), []int{200}); err != nil || len(thumbs) != 1 {
+		t.Fatalf("MakeThumbnails() == %v, %v", thumbs, err)
+	}
+	if len(thumbnailSlots) != 0 {
+		t.Error("MakeThumbnails did not release its slot")
+	}
+}
+func TestThumbnailKey(t *testing.T) {
+	if key := ThumbnailKey("2024May/abc.png", 200, ".jpg"); key != "2024May/abc_200.jpg" {
+		t.Errorf("ThumbnailKey() == %s", key)
+	}
+}
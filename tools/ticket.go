@@ -0,0 +1,27 @@
+package tools
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+)
+
+var ticketSubjectRegexp = regexp.MustCompile(`\[Ticket #(\d+)\]`)
+
+// TicketSubject 生成带工单号的邮件标题,回复邮件据此归档到同一工单
+func TicketSubject(id uint, subject string) string {
+	return fmt.Sprintf("[Ticket #%d] %s", id, subject)
+}
+
+// ParseTicketId 从邮件标题中解析工单号,没有则返回0
+func ParseTicketId(subject string) uint {
+	match := ticketSubjectRegexp.FindStringSubmatch(subject)
+	if len(match) != 2 {
+		return 0
+	}
+	id, err := strconv.ParseUint(match[1], 10, 32)
+	if err != nil {
+		return 0
+	}
+	return uint(id)
+}
@@ -0,0 +1,23 @@
+package tools
+
+import "testing"
+
+func TestParseTicketId(t *testing.T) {
+	cases := []struct {
+		in   string
+		want uint
+	}{
+		{TicketSubject(42, "Where is my order"), 42},
+		{"Re: [Ticket #7] Where is my order", 7},
+		{"RE: Fwd: [Ticket #1234]", 1234},
+		{"Where is my order", 0},
+		{"[Ticket #abc] hello", 0},
+		{"[Ticket #99999999999] hello", 0},
+	}
+	for _, c := range cases {
+		got := ParseTicketId(c.in)
+		if got != c.want {
+			t.Errorf("ParseTicketId(%q) == %d, want %d", c.in, got, c.want)
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package tools
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// RFC 6238 附录B的SHA1测试向量
+func TestHotpRfc6238(t *testing.T) {
+	key := []byte("12345678901234567890")
+	cases := []struct {
+		unix int64
+		want string
+	}{
+		{59, "94287082"},
+		{1111111109, "07081804"},
+		{1111111111, "14050471"},
+		{1234567890, "89005924"},
+		{2000000000, "69279037"},
+		{20000000000, "65353130"},
+	}
+	for _, c := range cases {
+		got := hotp(key, uint64(c.unix)/TotpPeriod, 8)
+		if got != c.want {
+			t.Errorf("hotp(T=%d) == %s, want %s", c.unix, got, c.want)
+		}
+	}
+}
+
+func TestVerifyTotp(t *testing.T) {
+	secret := totpEncoding.EncodeToString([]byte("12345678901234567890"))
+	now := time.Unix(1111111109, 0)
+	code, err := TotpCode(secret, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if code != "081804" {
+		t.Errorf("TotpCode == %s, want 081804", code)
+	}
+	if counter, ok := VerifyTotp(secret, code, now.Add(25*time.Second), 1); !ok || counter != 1111111109/TotpPeriod {
+		t.Errorf("VerifyTotp within skew == %d, %v", counter, ok)
+	}
+	if _, ok := VerifyTotp(secret, code, now.Add(90*time.Second), 1); ok {
+		t.Error("code accepted outside skew")
+	}
+	_, short := VerifyTotp(secret, "12345", now, 1)
+	_, badSecret := VerifyTotp("not base32!", code, now, 1)
+	if short || badSecret {
+		t.Error("malformed input accepted")
+	}
+	if _, ok := VerifyTotp(strings.ToLower(secret), code, now, 0); !ok {
+		t.Error("lower case secret rejected")
+	}
+}
+
+func TestTotpUri(t *testing.T) {
+	uri := TotpUri("GoflyChat", "agent", "ABC")
+	want := "otpauth://totp/GoflyChat:agent?digits=6&issuer=GoflyChat&period=30&secret=ABC"
+	if uri != want {
+		t.Errorf("TotpUri == %s, want %s", uri, want)
+	}
+	codes := NewRecoveryCodes(10)
+	seen := map[string]bool{}
+	for _, c := range codes {
+		if len(c) != 9 || c[4] != '-' || seen[c] {
+			t.Errorf("bad recovery code %q", c)
+		}
+		seen[c] = true
+	}
+}
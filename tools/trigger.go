@@ -0,0 +1,25 @@
+package tools
+
+import (
+	"regexp"
+	"strings"
+)
+
+// MatchUrlPattern 按通配符匹配页面地址, * 匹配任意字符, 空规则匹配所有页面
+func MatchUrlPattern(pattern string, url string) bool {
+	pattern = strings.TrimSpace(pattern)
+	if pattern == "" || pattern == "*" {
+		return true
+	}
+	for _, p := range strings.Split(pattern, ",") {
+		p = strings.TrimSpace(p)
+		if p == "" {
+			continue
+		}
+		expr := "^" + strings.Replace(regexp.QuoteMeta(p), `\*`, ".*", -1) + "$"
+		if ok, _ := regexp.MatchString(expr, url); ok {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,26 @@
+package tools
+
+import "testing"
+
+func TestMatchUrlPattern(t *testing.T) {
+	cases := []struct {
+		pattern, url string
+		want         bool
+	}{
+		{"", "https://example.com/", true},
+		{"*", "https://example.com/pricing", true},
+		{"*/pricing*", "https://example.com/pricing?plan=pro", true},
+		{"*/pricing*", "https://example.com/about", false},
+		{"https://example.com/", "https://example.com/", true},
+		{"https://example.com/", "https://example.com/a", false},
+		{"*/cart, */checkout*", "https://shop.example.com/checkout/step1", true},
+		{"*.example.com/*", "https://shop.example.com/a", true},
+		{"*.example.com/*", "https://shopexample.com/a", false},
+	}
+	for _, c := range cases {
+		got := MatchUrlPattern(c.pattern, c.url)
+		if got != c.want {
+			t.Errorf("MatchUrlPattern(%q, %q) == %v, want %v", c.pattern, c.url, got, c.want)
+		}
+	}
+}
@@ -0,0 +1,279 @@
+package tools
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// 默认允许上传的文件类型和保存使用的扩展名
+var uploadTypes = map[string]string{
+	"image/png":                     ".png",
+	"image/jpeg":                    ".jpg",
+	"image/gif":                     ".gif",
+	"image/webp":                    ".webp",
+	"image/bmp":                     ".bmp",
+	"application/pdf":               ".pdf",
+	"application/zip":               ".zip",
+	"application/x-gzip":            ".gz",
+	"application/x-rar-compressed":  ".rar",
+	"text/plain":                    ".txt",
+	"audio/mpeg":                    ".mp3",
+	"audio/wave":                    ".wav",
+	"video/mp4":                     ".mp4",
+	"video/webm":                    ".webm",
+	"application/msword":            ".doc",
+	"application/vnd.ms-excel":      ".xls",
+	"application/vnd.ms-powerpoint": ".ppt",
+	"application/vnd.openxmlformats-officedocument.wordprocessingml.document":   ".docx",
+	"application/vnd.openxmlformats-officedocument.spreadsheetml.sheet":         ".xlsx",
+	"application/vnd.openxmlformats-officedocument.presentationml.presentation": ".pptx",
+}
+
+// 内容为zip或OLE格式的Office文档, 只能按扩展名区分
+var (
+	zipOfficeExts = map[string]string{
+		".docx": "application/vnd.openxmlformats-officedocument.wordprocessingml.document",
+		".xlsx": "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
+		".pptx": "application/vnd.openxmlformats-officedocument.presentationml.presentation",
+	}
+	oleOfficeExts = map[string]string{
+		".doc": "application/msword",
+		".xls": "application/vnd.ms-excel",
+		".ppt": "application/vnd.ms-powerpoint",
+	}
+	oleHeader = []byte{0xD0, 0xCF, 0x11, 0xE0, 0xA1, 0xB1, 0x1A, 0xE1}
+	textExts  = map[string]bool{".txt": true, ".csv": true, ".log": true, ".md": true}
+)
+
+// DefaultUploadTypes 默认允许上传的MIME类型
+func DefaultUploadTypes() []string {
+	list := make([]string, 0, len(uploadTypes))
+	for t := range uploadTypes {
+		list = append(list, t)
+	}
+	sort.Strings(list)
+	return list
+}
+
+// SniffUpload 按文件开头的内容判断类型, 返回MIME类型和保存使用的扩展名, 不使用上传的扩展名
+// 只有内容无法区分的Office文档和文本文件才参考原文件扩展名
+func SniffUpload(head []byte, filename string) (string, string) {
+	ctype := http.DetectContentType(head)
+	if i := strings.Index(ctype, ";"); i >= 0 {
+		ctype = ctype[:i]
+	}
+	ext := strings.ToLower(filepath.Ext(filename))
+	switch ctype {
+	case "application/zip":
+		if t, ok := zipOfficeExts[ext]; ok {
+			return t, ext
+		}
+	case "application/octet-stream":
+		if t, ok := oleOfficeExts[ext]; ok && bytes.HasPrefix(head, oleHeader) {
+			return t, ext
+		}
+	case "text/plain":
+		if textExts[ext] {
+			return ctype, ext
+		}
+	}
+	if e, ok := uploadTypes[ctype]; ok {
+		return ctype, e
+	}
+	if exts, _ := mime.ExtensionsByType(ctype); len(exts) > 0 {
+		return ctype, exts[0]
+	}
+	return ctype, ".bin"
+}
+
+// RandomFileName 不可猜测的随机文件名
+func RandomFileName() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// StripImageMetadata 删除图片中的EXIF、XMP、IPTC和注释等元数据, 不重新编码图片
+// 支持jpeg png webp, 其他类型原样返回
+func StripImageMetadata(data []byte, ctype string) ([]byte, error) {
+	switch ctype {
+	case "image/jpeg":
+		return stripJpegMetadata(data)
+	case "image/png":
+		return stripPngMetadata(data)
+	case "image/webp":
+		return stripWebpMetadata(data)
+	}
+	return data, nil
+}
+
+var errImageMalformed = errors.New("image is malformed")
+
+// stripJpegMetadata 删除APP1(EXIF/XMP) APP13(IPTC) 和注释段, 保留APP2中的色彩配置
+// EXIF中的方向标记决定图片的显示方向, 替换为只有方向的EXIF段, 避免手机照片显示为横向
+func stripJpegMetadata(data []byte) ([]byte, error) {
+	if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+		return nil, errImageMalformed
+	}
+	out := make([]byte, 0, len(data))
+	out = append(out, 0xFF, 0xD8)
+	i := 2
+	for i < len(data) {
+		if data[i] != 0xFF {
+			return nil, errImageMalformed
+		}
+		for i < len(data) && data[i] == 0xFF {
+			i++
+		}
+		if i >= len(data) {
+			return nil, errImageMalformed
+		}
+		marker := data[i]
+		i++
+		// 图像数据开始后不再有元数据段
+		if marker == 0xDA || marker == 0xD9 {
+			out = append(out, 0xFF, marker)
+			return append(out, data[i:]...), nil
+		}
+		if (marker >= 0xD0 && marker <= 0xD7) || marker == 0x01 {
+			out = append(out, 0xFF, marker)
+			continue
+		}
+		if i+2 > len(data) {
+			return nil, errImageMalformed
+		}
+		length := int(binary.BigEndian.Uint16(data[i:]))
+		if length < 2 || i+length > len(data) {
+			return nil, errImageMalformed
+		}
+		if marker != 0xE1 && marker != 0xED && marker != 0xFE {
+			out = append(out, 0xFF, marker)
+			out = append(out, data[i:i+length]...)
+		}
+		if marker == 0xE1 {
+			if orientation := exifOrientation(data[i+2 : i+length]); orientation > 1 {
+				out = append(out, orientationExif(orientation)...)
+			}
+		}
+		i += length
+	}
+	return nil, errImageMalformed
+}
+
+// exifOrientation 读取APP1段中IFD0的方向标记, 不是EXIF或没有方向时返回0
+func exifOrientation(seg []byte) uint16 {
+	if !bytes.HasPrefix(seg, []byte("Exif\x00\x00")) {
+		return 0
+	}
+	tiff := seg[6:]
+	if len(tiff) < 8 {
+		return 0
+	}
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 0
+	}
+	ifd := int(order.Uint32(tiff[4:]))
+	if ifd < 8 || ifd+2 > len(tiff) {
+		return 0
+	}
+	count := int(order.Uint16(tiff[ifd:]))
+	for n := 0; n < count; n++ {
+		entry := ifd + 2 + n*12
+		if entry+12 > len(tiff) {
+			return 0
+		}
+		// 0x0112 Orientation, 类型为SHORT
+		if order.Uint16(tiff[entry:]) == 0x0112 && order.Uint16(tiff[entry+2:]) == 3 {
+			if orientation := order.Uint16(tiff[entry+8:]); orientation <= 8 {
+				return orientation
+			}
+			return 0
+		}
+	}
+	return 0
+}
+
+// orientationExif 只包含方向标记的APP1段
+func orientationExif(orientation uint16) []byte {
+	seg := []byte{0xFF, 0xE1, 0, 34}
+	seg = append(seg, "Exif\x00\x00"...)
+	// TIFF头, IFD0从偏移8开始
+	seg = append(seg, 'M', 'M', 0, 42, 0, 0, 0, 8)
+	// 1个条目: Orientation SHORT 1个值, 下一个IFD偏移为0
+	seg = append(seg, 0, 1, 0x01, 0x12, 0, 3, 0, 0, 0, 1)
+	seg = binary.BigEndian.AppendUint16(seg, orientation)
+	return append(seg, 0, 0, 0, 0, 0, 0)
+}
+
+// stripPngMetadata 删除 eXIf tEXt zTXt iTXt tIME 块
+func stripPngMetadata(data []byte) ([]byte, error) {
+	sig := []byte("\x89PNG\r\n\x1a\n")
+	if !bytes.HasPrefix(data, sig) {
+		return nil, errImageMalformed
+	}
+	out := make([]byte, 0, len(data))
+	out = append(out, sig...)
+	i := len(sig)
+	for i+12 <= len(data) {
+		length := int(binary.BigEndian.Uint32(data[i:]))
+		end := i + 12 + length
+		if length < 0 || end > len(data) || end < i {
+			return nil, errImageMalformed
+		}
+		switch string(data[i+4 : i+8]) {
+		case "eXIf", "tEXt", "zTXt", "iTXt", "tIME":
+		default:
+			out = append(out, data[i:end]...)
+		}
+		if string(data[i+4:i+8]) == "IEND" {
+			return out, nil
+		}
+		i = end
+	}
+	return nil, errImageMalformed
+}
+
+// stripWebpMetadata 删除 EXIF 和 XMP 块, 并清除VP8X中对应的标志位
+func stripWebpMetadata(data []byte) ([]byte, error) {
+	if len(data) < 12 || string(data[0:4]) != "RIFF" || string(data[8:12]) != "WEBP" {
+		return nil, errImageMalformed
+	}
+	out := make([]byte, 12, len(data))
+	copy(out, data[:12])
+	i := 12
+	for i+8 <= len(data) {
+		length := int(binary.LittleEndian.Uint32(data[i+4:]))
+		end := i + 8 + length + length%2
+		if length < 0 || end > len(data) || end < i {
+			return nil, errImageMalformed
+		}
+		switch string(data[i : i+4]) {
+		case "EXIF", "XMP ":
+		case "VP8X":
+			start := len(out)
+			out = append(out, data[i:end]...)
+			if length > 0 {
+				out[start+8] &^= 0x08 | 0x04
+			}
+		default:
+			out = append(out, data[i:end]...)
+		}
+		i = end
+	}
+	binary.LittleEndian.PutUint32(out[4:], uint32(len(out)-8))
+	return out, nil
+}
@@ -0,0 +1,116 @@
+package tools
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"testing"
+)
+
+func TestSniffUpload(t *testing.T) {
+	var pngData bytes.Buffer
+	png.Encode(&pngData, image.NewRGBA(image.Rect(0, 0, 2, 2)))
+	cases := []struct {
+		head     []byte
+		name     string
+		wantType string
+		wantExt  string
+	}{
+		{pngData.Bytes(), "photo.gif", "image/png", ".png"},
+		{[]byte("<html><script>alert(1)</script>"), "a.png", "text/html", ""},
+		{[]byte("<svg xmlns=\"http://www.w3.org/2000/svg\"></svg>"), "a.svg", "text/plain", ".txt"},
+		{[]byte("PK\x03\x04rest"), "report.DOCX", "application/vnd.openxmlformats-officedocument.wordprocessingml.document", ".docx"},
+		{[]byte("PK\x03\x04rest"), "a.exe", "application/zip", ".zip"},
+		{[]byte("a,b\n1,2\n"), "data.csv", "text/plain", ".csv"},
+		{[]byte("hello"), "hello.html", "text/plain", ".txt"},
+	}
+	for _, c := range cases {
+		gotType, gotExt := SniffUpload(c.head, c.name)
+		if gotType != c.wantType || (c.wantExt != "" && gotExt != c.wantExt) {
+			t.Errorf("SniffUpload(%q) == %s %s, want %s %s", c.name, gotType, gotExt, c.wantType, c.wantExt)
+		}
+	}
+	if len(RandomFileName()) != 32 || RandomFileName() == RandomFileName() {
+		t.Error("RandomFileName is not random")
+	}
+}
+func TestStripJpegMetadata(t *testing.T) {
+	var buf bytes.Buffer
+	jpeg.Encode(&buf, image.NewRGBA(image.Rect(0, 0, 4, 4)), nil)
+	exif := append([]byte("Exif\x00\x00"), []byte("GPS secret")...)
+	segment := []byte{0xFF, 0xE1, 0, 0}
+	binary.BigEndian.PutUint16(segment[2:], uint16(len(exif)+2))
+	data := append([]byte{0xFF, 0xD8}, append(append(segment, exif...), buf.Bytes()[2:]...)...)
+	out, err := StripImageMetadata(data, "image/jpeg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(out, []byte("GPS secret")) || len(out) != buf.Len() {
+		t.Errorf("StripImageMetadata kept EXIF, len %d want %d", len(out), buf.Len())
+	}
+	if _, err := jpeg.Decode(bytes.NewReader(out)); err != nil {
+		t.Errorf("stripped jpeg can not be decoded: %v", err)
+	}
+	if _, err := StripImageMetadata([]byte("not a jpeg"), "image/jpeg"); err == nil {
+		t.Error("StripImageMetadata accepted a malformed jpeg")
+	}
+}
+
+// TestStripJpegMetadataOrientation 手机竖拍照片的方向标记为6, 删除EXIF后仍要保留
+func TestStripJpegMetadataOrientation(t *testing.T) {
+	var buf bytes.Buffer
+	jpeg.Encode(&buf, image.NewRGBA(image.Rect(0, 0, 4, 2)), nil)
+	// 小端序EXIF, IFD0中有Make和Orientation=6两个条目, 后面跟着GPS数据
+	tiff := []byte{'I', 'I', 42, 0, 8, 0, 0, 0, 2, 0}
+	tiff = append(tiff, 0x0F, 0x01, 2, 0, 4, 0, 0, 0, 'A', 'c', 'm', 0)
+	tiff = append(tiff, 0x12, 0x01, 3, 0, 1, 0, 0, 0, 6, 0, 0, 0)
+	tiff = append(tiff, 0, 0, 0, 0)
+	exif := append(append([]byte("Exif\x00\x00"), tiff...), []byte("GPS secret")...)
+	segment := []byte{0xFF, 0xE1, 0, 0}
+	binary.BigEndian.PutUint16(segment[2:], uint16(len(exif)+2))
+	data := append([]byte{0xFF, 0xD8}, append(append(segment, exif...), buf.Bytes()[2:]...)...)
+
+	out, err := StripImageMetadata(data, "image/jpeg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(out, []byte("GPS secret")) || bytes.Contains(out, []byte("Acm")) {
+		t.Error("StripImageMetadata kept EXIF fields other than Orientation")
+	}
+	i := bytes.Index(out, []byte{0xFF, 0xE1})
+	if i < 0 {
+		t.Fatal("StripImageMetadata dropped the Orientation")
+	}
+	length := int(binary.BigEndian.Uint16(out[i+2:]))
+	if got := exifOrientation(out[i+4 : i+2+length]); got != 6 {
+		t.Errorf("Orientation = %d, want 6", got)
+	}
+	if _, err := jpeg.Decode(bytes.NewReader(out)); err != nil {
+		t.Errorf("stripped jpeg can not be decoded: %v", err)
+	}
+}
+func TestStripPngMetadata(t *testing.T) {
+	var buf bytes.Buffer
+	png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, 4, 4)))
+	src := buf.Bytes()
+	text := []byte("Comment\x00GPS secret")
+	chunk := make([]byte, 8, 12+len(text))
+	binary.BigEndian.PutUint32(chunk, uint32(len(text)))
+	copy(chunk[4:], "tEXt")
+	chunk = append(chunk, text...)
+	crc := make([]byte, 4)
+	binary.BigEndian.PutUint32(crc, crc32.ChecksumIEEE(chunk[4:]))
+	chunk = append(chunk, crc...)
+	// 插入到IHDR之后
+	data := append(append(append([]byte{}, src[:33]...), chunk...), src[33:]...)
+	out, err := StripImageMetadata(data, "image/png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(out, src) {
+		t.Error("StripImageMetadata did not remove the tEXt chunk")
+	}
+}
@@ -0,0 +1,79 @@
+package tools
+
+import (
+	"errors"
+	"net/mail"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// 表单字段类型
+const (
+	FieldText   = "text"
+	FieldEmail  = "email"
+	FieldPhone  = "phone"
+	FieldNumber = "number"
+	FieldSelect = "select"
+)
+
+var phoneRegexp = regexp.MustCompile(`^\+?[0-9][0-9\- ]{5,19}$`)
+
+// IsFieldType 判断是否为支持的字段类型
+func IsFieldType(fieldType string) bool {
+	switch fieldType {
+	case FieldText, FieldEmail, FieldPhone, FieldNumber, FieldSelect:
+		return true
+	}
+	return false
+}
+
+// ValidateField 按字段类型、下拉选项和正则校验表单值
+func ValidateField(fieldType string, value string, options string, pattern string, required bool) error {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		if required {
+			return errors.New("is required")
+		}
+		return nil
+	}
+	if len(value) > 500 {
+		return errors.New("is too long")
+	}
+	switch fieldType {
+	case FieldEmail:
+		addr, err := mail.ParseAddress(value)
+		if err != nil || addr.Address != value {
+			return errors.New("is not a valid email")
+		}
+	case FieldPhone:
+		if !phoneRegexp.MatchString(value) {
+			return errors.New("is not a valid phone number")
+		}
+	case FieldNumber:
+		if _, err := strconv.ParseFloat(value, 64); err != nil {
+			return errors.New("is not a valid number")
+		}
+	case FieldSelect:
+		found := false
+		for _, option := range strings.Split(options, ",") {
+			if strings.TrimSpace(option) == value {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return errors.New("is not a valid option")
+		}
+	}
+	if pattern != "" {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return errors.New("has an invalid pattern")
+		}
+		if !re.MatchString(value) {
+			return errors.New("does not match the required format")
+		}
+	}
+	return nil
+}
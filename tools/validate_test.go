@@ -0,0 +1,32 @@
+package tools
+
+import "testing"
+
+func TestValidateField(t *testing.T) {
+	cases := []struct {
+		fieldType, value, options, pattern string
+		required                           bool
+		ok                                 bool
+	}{
+		{FieldText, "", "", "", true, false},
+		{FieldText, "", "", "", false, true},
+		{FieldText, "Alice", "", "", true, true},
+		{FieldEmail, "alice@example.com", "", "", true, true},
+		{FieldEmail, "alice", "", "", true, false},
+		{FieldPhone, "+86 138-0000-0000", "", "", true, true},
+		{FieldPhone, "call me", "", "", true, false},
+		{FieldNumber, "12.5", "", "", false, true},
+		{FieldNumber, "twelve", "", "", false, false},
+		{FieldSelect, "Sales", "Sales, Support", "", true, true},
+		{FieldSelect, "Billing", "Sales, Support", "", true, false},
+		{FieldText, "A-123", "", `^[A-Z]-\d+$`, true, true},
+		{FieldText, "123", "", `^[A-Z]-\d+$`, true, false},
+		{FieldText, "x", "", `(`, false, false},
+	}
+	for _, c := range cases {
+		err := ValidateField(c.fieldType, c.value, c.options, c.pattern, c.required)
+		if (err == nil) != c.ok {
+			t.Errorf("ValidateField(%q, %q, %q, %q, %v) == %v, want ok=%v", c.fieldType, c.value, c.options, c.pattern, c.required, err, c.ok)
+		}
+	}
+}
@@ -0,0 +1,50 @@
+package tools
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 接入网站传入的已登录用户身份, 使用与客服共享的密钥签名
+type VisitorIdentity struct {
+	UserId    string `json:"user_id"`
+	Name      string `json:"name"`
+	Email     string `json:"email"`
+	Timestamp int64  `json:"timestamp"`
+}
+
+// Payload 签名原文, 按参数名排序的查询字符串:
+// email=...&name=...&timestamp=...&user_id=...
+func (v VisitorIdentity) Payload() string {
+	values := url.Values{}
+	values.Set("user_id", v.UserId)
+	values.Set("name", v.Name)
+	values.Set("email", v.Email)
+	values.Set("timestamp", strconv.FormatInt(v.Timestamp, 10))
+	return values.Encode()
+}
+
+// SignVisitorIdentity 计算身份签名, hex(HMAC-SHA256(secret, payload))
+func SignVisitorIdentity(secret string, v VisitorIdentity) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(v.Payload()))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// VerifyVisitorIdentity 校验签名和签名时间, 超过maxAge的签名视为过期
+func VerifyVisitorIdentity(secret string, v VisitorIdentity, signature string, now time.Time, maxAge time.Duration) bool {
+	if secret == "" || v.UserId == "" || signature == "" {
+		return false
+	}
+	signedAt := time.Unix(v.Timestamp, 0)
+	if now.Sub(signedAt) > maxAge || signedAt.Sub(now) > maxAge {
+		return false
+	}
+	want := SignVisitorIdentity(secret, v)
+	return hmac.Equal([]byte(want), []byte(strings.ToLower(strings.TrimSpace(signature))))
+}
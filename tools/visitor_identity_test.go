@@ -0,0 +1,33 @@
+package tools
+
+import (
+	"testing"
+	"time"
+)
+
+func TestVerifyVisitorIdentity(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	secret := "host-site-secret"
+	v := VisitorIdentity{UserId: "42", Name: "Alice Liu", Email: "alice@example.com", Timestamp: now.Unix()}
+	if p := v.Payload(); p != "email=alice%40example.com&name=Alice+Liu&timestamp=1700000000&user_id=42" {
+		t.Errorf("unexpected payload %q", p)
+	}
+	sig := SignVisitorIdentity(secret, v)
+	if !VerifyVisitorIdentity(secret, v, sig, now, time.Hour) {
+		t.Error("valid signature rejected")
+	}
+	tampered := v
+	tampered.UserId = "43"
+	if VerifyVisitorIdentity(secret, tampered, sig, now, time.Hour) {
+		t.Error("signature accepted for another user_id")
+	}
+	if VerifyVisitorIdentity("other-secret", v, sig, now, time.Hour) {
+		t.Error("signature accepted with the wrong secret")
+	}
+	if VerifyVisitorIdentity(secret, v, sig, now.Add(2*time.Hour), time.Hour) {
+		t.Error("expired signature accepted")
+	}
+	if VerifyVisitorIdentity("", v, SignVisitorIdentity("", v), now, time.Hour) {
+		t.Error("empty secret accepted")
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"github.com/gorilla/websocket"
 	"goflylivechat/common"
 	"goflylivechat/models"
+	"goflylivechat/tools"
 	"log"
 	"strings"
 	"time"
@@ -19,7 +20,7 @@ func NewVisitorServer(c *gin.Context) {
 		return
 	}
 	//获取GET参数,创建WS
-	vistorInfo := models.FindVisitorByVistorId(c.Query("visitor_id"))
+	vistorInfo := models.FindVisitorByVistorId(c.GetString("visitor_id"))
 	if vistorInfo.VisitorId == "" {
 		c.JSON(200, gin.H{
 			"code": 400,
@@ -174,17 +175,95 @@ func VisitorAutoReply(vistorInfo models.Visitor, kefuInfo models.User, content s
 		time.Sleep(1 * time.Second)
 		VisitorMessage(vistorInfo.VisitorId, reply.Content, kefuInfo)
 		KefuMessage(vistorInfo.VisitorId, reply.Content, kefuInfo)
-		models.CreateMessage(kefuInfo.Name, vistorInfo.VisitorId, reply.Content, "kefu")
+		if err := models.CreateMessage(kefuInfo.Name, vistorInfo.VisitorId, reply.Content, "kefu"); err != nil {
+			log.Println("auto reply message error:", err)
+		}
 	}
 	if !ok || kefu == nil {
+		defer VisitorTicketForm(vistorInfo.VisitorId)
 		time.Sleep(1 * time.Second)
 		config := models.FindConfigByUserId(kefuInfo.Name, "OfflineMessage")
 		if config.ConfValue == "" || reply.Content != "" {
 			return
 		}
 		VisitorMessage(vistorInfo.VisitorId, config.ConfValue, kefuInfo)
-		models.CreateMessage(kefuInfo.Name, vistorInfo.VisitorId, config.ConfValue, "kefu")
+		if err := models.CreateMessage(kefuInfo.Name, vistorInfo.VisitorId, config.ConfValue, "kefu"); err != nil {
+			log.Println("offline message error:", err)
+		}
+	}
+}
+
+// 客服离线时提示访客留言
+func VisitorTicketForm(visitorId string) {
+	if !tools.LimitFreqSingle("ticketform:"+visitorId, 1, 600) {
+		return
 	}
+	msg := TypeMessage{
+		Type: "ticket_form",
+		Data: visitorId,
+	}
+	str, _ := json.Marshal(msg)
+	visitor, ok := ClientList[visitorId]
+	if !ok || visitor == nil || visitor.Conn == nil {
+		return
+	}
+	visitor.Mux.Lock()
+	defer visitor.Mux.Unlock()
+	visitor.Conn.WriteMessage(websocket.TextMessage, str)
+}
+
+// 主动邀请访客对话,头像和昵称使用规则指定的客服
+func VisitorInvite(visitorId string, content string, ownerKefu string, fromKefu models.User) bool {
+	visitor, ok := ClientList[visitorId]
+	if !ok || visitor == nil || visitor.Conn == nil {
+		return false
+	}
+	msg := TypeMessage{
+		Type: "invite",
+		Data: ClientMessage{
+			Name:    fromKefu.Nickname,
+			Avator:  fromKefu.Avator,
+			Id:      ownerKefu,
+			Time:    time.Now().Format("2006-01-02 15:04:05"),
+			ToId:    visitorId,
+			Content: content,
+			IsKefu:  "no",
+		},
+	}
+	str, _ := json.Marshal(msg)
+	visitor.Mux.Lock()
+	defer visitor.Mux.Unlock()
+	return visitor.Conn.WriteMessage(websocket.TextMessage, str) == nil
+}
+
+// 会话结束时邀请访客评价,需要客服开启CsatEnable配置
+func VisitorRatePrompt(visitorId string, kefuId string) {
+	enable := models.FindConfigByUserId(kefuId, "CsatEnable")
+	if enable.ConfValue != "true" && enable.ConfValue != "1" {
+		return
+	}
+	visitor, ok := ClientList[visitorId]
+	if !ok || visitor == nil || visitor.Conn == nil || visitor.RateSent {
+		return
+	}
+	visitor.RateSent = true
+	rateType := models.FindConfigByUserId(kefuId, "CsatType").ConfValue
+	if rateType != "thumb" {
+		rateType = "star"
+	}
+	conversationId := tools.Uuid()
+	models.CreateRate(conversationId, visitorId, kefuId, rateType)
+	msg := TypeMessage{
+		Type: "rate",
+		Data: map[string]string{
+			"conversation_id": conversationId,
+			"rate_type":       rateType,
+		},
+	}
+	str, _ := json.Marshal(msg)
+	visitor.Mux.Lock()
+	defer visitor.Mux.Unlock()
+	visitor.Conn.WriteMessage(websocket.TextMessage, str)
 }
 func CleanVisitorExpire() {
 	go func() {
@@ -193,6 +272,7 @@ func CleanVisitorExpire() {
 			for _, user := range ClientList {
 				diff := time.Now().Sub(user.UpdateTime).Seconds()
 				if diff >= common.VisitorExpire {
+					VisitorRatePrompt(user.Id, user.To_id)
 					msg := TypeMessage{
 						Type: "auto_close",
 						Data: user.Id,
@@ -23,6 +23,7 @@ type User struct {
 	Role_id    string
 	Mux        sync.Mutex
 	UpdateTime time.Time
+	RateSent   bool
 }
 type Message struct {
 	conn        *websocket.Conn
@@ -60,12 +61,12 @@ func init() {
 	upgrader = websocket.Upgrader{
 		ReadBufferSize:  1024,
 		WriteBufferSize: 1024,
-		// 解决跨域问题
+		// 同源请求或已通过DomainLimitMiddleware校验的来源才允许连接
 		CheckOrigin: func(r *http.Request) bool {
-			return true
+			origin := r.Header.Get("Origin")
+			return origin == "" || tools.SameOrigin(origin, r) || tools.OriginAllowed(r)
 		},
 	}
-	go UpdateVisitorStatusCron()
 }
 func SendServerJiang(title string, content string, domain string) string {
 	noticeServerJiang, err := strconv.ParseBool(models.FindConfig("NoticeServerJiang"))
@@ -114,7 +115,7 @@ func WsServerBackend() {
 			continue
 		}
 		msgType := typeMsg.Type.(string)
-		log.Println("客户端:", string(message.content))
+		log.Println("客户端:", tools.RedactText(string(message.content)))
 
 		switch msgType {
 		//心跳
@@ -127,12 +128,21 @@ func WsServerBackend() {
 			defer message.Mux.Unlock()
 			conn.WriteMessage(websocket.TextMessage, str)
 		case "inputing":
-			data := typeMsg.Data.(map[string]interface{})
-			from := data["from"].(string)
-			to := data["to"].(string)
+			data, _ := typeMsg.Data.(map[string]interface{})
+			from, _ := data["from"].(string)
+			to, _ := data["to"].(string)
+			//只能以当前连接的访客或客服身份发送
+			if from == "" || (from != message.context.GetString("visitor_id") && from != message.context.GetString("kefu_name")) {
+				continue
+			}
 			//限流
 			if tools.LimitFreqSingle("inputing:"+from, 1, 2) {
-				OneKefuMessage(to, message.content)
+				//正在输入的内容同样打码
+				if content, ok := data["content"].(string); ok {
+					data["content"] = tools.RedactText(content)
+				}
+				str, _ := json.Marshal(TypeMessage{Type: typeMsg.Type, Data: data})
+				OneKefuMessage(to, str)
 			}
 		}
 